@@ -2,15 +2,20 @@ package adapter
 
 import (
 	"context"
+	"errors"
 
 	"github.com/Newt6611/apollo"
 	c "github.com/Newt6611/apollo/constants"
 	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/Transaction"
 	"github.com/Newt6611/apollo/serialization/UTxO"
 	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
 	"github.com/Newt6611/go-minswap/utils"
 )
 
+// ErrPoolNotFound is returned by GetV2PoolByPair when no pool has the pair
+var ErrPoolNotFound = errors.New("pool not found")
+
 type QueryParams struct {
 	Count int
 	Page  int
@@ -24,6 +29,15 @@ type Amount struct {
 	Quantity string
 }
 
+// SpendingTx is the transaction that spent an output
+type SpendingTx struct {
+	// hash of Tx
+	TxHash string
+	Tx     Transaction.Transaction
+	// every utxo spent by Tx, collateral excluded
+	Inputs []UTxO.UTxO
+}
+
 type Adapter interface {
 	NetworkId() c.Network
 	ChainContext() Base.ChainContext
@@ -33,6 +47,12 @@ type Adapter interface {
 	GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error)
 	GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error)
 	GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO
+	// GetV2OrderUtxos returns every unspent output at the V2 order script,
+	// whatever its stake credential, with its inline datum or datum hash
+	GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error)
+	// GetSpendingTx returns the transaction that spent txhash#index, or nil
+	// when the output is not spent yet
+	GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error)
 	GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error)
 	GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error)
 }
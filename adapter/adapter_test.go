@@ -0,0 +1,52 @@
+package adapter_test
+
+import (
+	"testing"
+
+	"github.com/Newt6611/apollo/serialization/AssetName"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/Policy"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+// testPoolTxHash is the ADA/MIN pool utxo shared by the testnet fixtures of every backend
+const testPoolTxHash = "a1d7aaf16f1a8385580d7a3045ddc9b1010eab5949d9ccbd23a2760c11ab3b23"
+
+// checkPoolUtxo checks the utxo fields of the ADA/MIN fixture pool
+func checkPoolUtxo(t *testing.T, pool utils.V2PoolState) {
+	t.Helper()
+	if pool.OutRef.TxHash != testPoolTxHash || pool.OutRef.Index != 0 {
+		t.Errorf("pool OutRef expect %s#0, but get %s#%d\n", testPoolTxHash, pool.OutRef.TxHash, pool.OutRef.Index)
+	}
+	if len(pool.Address.PaymentPart) == 0 {
+		t.Error("pool expect an address")
+	}
+	if pool.ValueAmount(utils.MIN) != 500_000_000 {
+		t.Errorf("pool value expect 500000000 MIN, but get %d\n", pool.ValueAmount(utils.MIN))
+	}
+	if err := pool.VerifyReserves(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFindV2PoolByPair(t *testing.T) {
+	policy, _ := Policy.New("e16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72")
+	minAsset := *Fingerprint.New(*policy, *AssetName.NewAssetNameFromHexString("4d494e"))
+	mipAsset := *Fingerprint.New(*policy, *AssetName.NewAssetNameFromHexString("4d4950"))
+	pools := []utils.V2PoolState{{AssetA: utils.ADA, AssetB: minAsset}, {AssetA: minAsset, AssetB: mipAsset}}
+
+	// units of the same length are sorted, whatever the order they are given in
+	for _, pair := range [][2]Fingerprint.Fingerprint{{minAsset, mipAsset}, {mipAsset, minAsset}} {
+		pool, err := adapter.FindV2PoolByPair(pools, pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pool.AssetB.AssetName.HexString() != "4d4950" {
+			t.Errorf("FindV2PoolByPair expect the MIN/MIP pool, but get %+v\n", pool)
+		}
+	}
+	if _, err := adapter.FindV2PoolByPair(pools, utils.ADA, mipAsset); err != adapter.ErrPoolNotFound {
+		t.Errorf("FindV2PoolByPair expect ErrPoolNotFound, but get %v\n", err)
+	}
+}
@@ -1,35 +1,93 @@
 package adapter
 
 import (
+	"bytes"
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/Newt6611/apollo"
 	c "github.com/Newt6611/apollo/constants"
 	"github.com/Newt6611/apollo/serialization/Address"
 	"github.com/Newt6611/apollo/serialization/Fingerprint"
-	"github.com/Newt6611/apollo/serialization/PlutusData"
 	"github.com/Newt6611/apollo/serialization/UTxO"
 	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
 	"github.com/Newt6611/go-minswap/constants"
 	"github.com/Newt6611/go-minswap/utils"
-	"github.com/blinklabs-io/gouroboros/cbor"
 	"github.com/blockfrost/blockfrost-go"
 )
 
+// BlockFrostLimits configures the retry policy and the rate limiter shared by
+// every request of a BlockFrost adapter
+type BlockFrostLimits struct {
+	// Retries of a GET failing with a network error, 429 or 5xx, defaults to 5.
+	// A submit is only retried on 429 with Retry-After. Negative disables retries
+	MaxRetries int
+	// Backoff before the first retry, doubled on each retry up to MaxBackoff.
+	// Defaults to 250ms and 10s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Sustained requests per second, defaults to 10 as Blockfrost's project quota
+	RequestsPerSecond float64
+	// Requests allowed at once before the rate applies, defaults to 500
+	Burst int
+}
+
 type BlockFrost struct {
-	client       blockfrost.APIClient
-	network      c.Network
-	options      blockfrost.APIClientOptions
-	chainContext Base.ChainContext
+	client     blockfrost.APIClient
+	httpClient *http.Client
+	network    c.Network
+	options    blockfrost.APIClientOptions
+
+	chainContext *BlockFrostChainContext
 }
 
 func NewBlockFrost(options blockfrost.APIClientOptions) (*BlockFrost, error) {
+	return NewBlockFrostWithLimits(options, BlockFrostLimits{})
+}
+
+func NewBlockFrostWithLimits(options blockfrost.APIClientOptions, limits BlockFrostLimits) (*BlockFrost, error) {
+	if limits.MaxRetries == 0 {
+		limits.MaxRetries = 5
+	}
+	if limits.MaxRetries < 0 {
+		limits.MaxRetries = 0
+	}
+	if limits.MinBackoff <= 0 {
+		limits.MinBackoff = 250 * time.Millisecond
+	}
+	if limits.MaxBackoff <= 0 {
+		limits.MaxBackoff = 10 * time.Second
+	}
+	if limits.RequestsPerSecond <= 0 {
+		limits.RequestsPerSecond = 10
+	}
+	if limits.Burst <= 0 {
+		limits.Burst = 500
+	}
+
+	// the SDK and GetDatumByDatumHash share one client, so the limiter sees every request
+	httpClient := &http.Client{}
+	if options.Client != nil {
+		*httpClient = *options.Client
+	}
+	base := httpClient.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	httpClient.Transport = &retryTransport{
+		base:       base,
+		limiter:    newTokenBucket(limits.RequestsPerSecond, limits.Burst),
+		maxRetries: limits.MaxRetries,
+		minBackoff: limits.MinBackoff,
+		maxBackoff: limits.MaxBackoff,
+	}
+	options.Client = httpClient
+
 	client := blockfrost.NewAPIClient(options)
 	// we only need know whether is testnet or mainnet
 	network := c.MAINNET
@@ -40,27 +98,94 @@ func NewBlockFrost(options blockfrost.APIClientOptions) (*BlockFrost, error) {
 		network = c.TESTNET
 	}
 
-	// tmpNetwork decied by server(used only in initialization)
-	tmpNetwork := c.MAINNET
+	// the chain context reports the network decided by server
+	apolloNetwork := c.MAINNET
 	switch options.Server {
 	case blockfrost.CardanoPreProd:
-		tmpNetwork = c.PREPROD
+		apolloNetwork = c.PREPROD
 	case blockfrost.CardanoPreview:
-		tmpNetwork = c.PREVIEW
+		apolloNetwork = c.PREVIEW
 	case blockfrost.CardanoTestNet:
-		tmpNetwork = c.TESTNET
+		apolloNetwork = c.TESTNET
+	}
+
+	b := &BlockFrost{
+		client:     client,
+		httpClient: httpClient,
+		network:    network,
+		options:    options,
+	}
+	b.chainContext = &BlockFrostChainContext{blockfrost: b, network: int(apolloNetwork)}
+	return b, nil
+}
+
+// get decodes the JSON body of a Blockfrost endpoint into result
+func (b *BlockFrost) get(ctx context.Context, path string, result any) error {
+	return b.do(ctx, http.MethodGet, path, "", nil, result)
+}
+
+// post sends body as contentType and decodes the JSON response into result
+func (b *BlockFrost) post(ctx context.Context, path string, contentType string, body []byte, result any) error {
+	return b.do(ctx, http.MethodPost, path, contentType, body, result)
+}
+
+func (b *BlockFrost) do(ctx context.Context, method string, path string, contentType string, body []byte, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
 	}
-	bc, err := apollo.NewBlockfrostBackend(options.ProjectID, tmpNetwork)
+	req, err := http.NewRequestWithContext(ctx, method, b.options.Server+path, reqBody)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	req.Header.Set("project_id", b.options.ProjectID)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("blockfrost %s: status %d: %s", path, resp.StatusCode, string(respBody))
+	}
+	err = json.Unmarshal(respBody, result)
+	if err != nil {
+		return fmt.Errorf("blockfrost %s: unexpected body: %w", path, err)
+	}
+	return nil
+}
 
-	return &BlockFrost{
-		client:       client,
-		network:      network,
-		options:      options,
-		chainContext: &bc,
-	}, nil
+// collectUtxos drains the channel of an SDK *All method. When ctx is done it
+// returns at once and leaves the rest of the channel to a goroutine, since the
+// SDK workers block until their results are read
+func collectUtxos(ctx context.Context, resultChan <-chan blockfrost.AddressUTXOResult) ([]blockfrost.AddressUTXO, []error) {
+	utxos := []blockfrost.AddressUTXO{}
+	errs := []error{}
+	for {
+		select {
+		case <-ctx.Done():
+			go func() {
+				for range resultChan {
+				}
+			}()
+			return utxos, append(errs, ctx.Err())
+		case result, keep := <-resultChan:
+			if !keep {
+				return utxos, errs
+			}
+			if result.Err != nil {
+				errs = append(errs, result.Err)
+			}
+			utxos = append(utxos, result.Res...)
+		}
+	}
 }
 
 func (b *BlockFrost) NetworkId() c.Network {
@@ -72,33 +197,17 @@ func (b *BlockFrost) ChainContext() Base.ChainContext {
 }
 
 func (b *BlockFrost) NewBuilder() *apollo.Apollo {
-	return apollo.New(b.chainContext)
+	return apollo.New(b.ChainContext())
 }
 
 func (b *BlockFrost) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
 	address := constants.V2Config[b.network].PoolScriptHashBech32
 	asset := constants.V2Config[b.network].PoolAuthenAsset
 
-	poolStates := []utils.V2PoolState{}
-	errs := []error{}
-
-	resultChan := b.client.AddressUTXOsAssetAll(ctx, address, asset)
-	for {
-		result, keep := <-resultChan
-		if result.Err != nil {
-			errs = append(errs, result.Err)
-		}
-
-		utxos := result.Res
-		poolState, es := convertUtxosToPoolState(utxos, errs)
-		poolStates = append(poolStates, poolState...)
-		errs = append(errs, es...)
-
-		if !keep {
-			break
-		}
-	}
-	return poolStates, errs
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	utxos, errs := collectUtxos(ctx, b.client.AddressUTXOsAssetAll(ctx, address, asset))
+	return convertUtxosToPoolState(utxos, errs)
 }
 
 func (b *BlockFrost) GetV2Pool(ctx context.Context, params QueryParams) ([]utils.V2PoolState, []error) {
@@ -125,60 +234,130 @@ func (b *BlockFrost) GetV2Pool(ctx context.Context, params QueryParams) ([]utils
 }
 
 func (b *BlockFrost) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
-	normalizedAssetA, normalizedAssetB := normalizeAssets(assetA, assetB)
 	pools, errs := b.GetV2PoolAll(ctx)
 	if len(errs) != 0 {
 		return utils.V2PoolState{}, errs[0]
 	}
 
-	for _, pool := range pools {
-		if pool.AssetA.String() == normalizedAssetA.String() &&
-			pool.AssetB.String() == normalizedAssetB.String() {
-			return pool, nil
-		}
-	}
-
-	return utils.V2PoolState{}, errors.New("pool not found")
+	return FindV2PoolByPair(pools, assetA, assetB)
 }
 
 func (b *BlockFrost) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
-	url := fmt.Sprintf("%s/scripts/datum/%s/cbor", b.options.Server, datumHash)
-
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("project_id", b.options.ProjectID)
-	resp, err := http.DefaultClient.Do(req)
+	var data struct {
+		Cbor string `json:"cbor"`
+	}
+	err := b.get(ctx, fmt.Sprintf("/scripts/datum/%s/cbor", datumHash), &data)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
+	if data.Cbor == "" {
+		return "", errors.New("cannot find datum " + datumHash)
+	}
+	return data.Cbor, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (b *BlockFrost) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	var txUtxos Base.TxUtxos
+	err := b.get(ctx, fmt.Sprintf("/txs/%s/utxos", txhash), &txUtxos)
 	if err != nil {
-		return "", err
+		return nil
+	}
+	for _, output := range txUtxos.Outputs {
+		if output.OutputIndex == index {
+			return output.ToUTxO(txhash)
+		}
 	}
+	return nil
+}
 
-	var data map[string]string
-	err = json.Unmarshal(body, &data)
-	if err != nil {
-		return "", err
+func (b *BlockFrost) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	// Blockfrost takes the bech32 script hash to match every stake credential
+	address := constants.V2Config[b.network].OrderScriptHashBech32
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	utxos, errs := collectUtxos(ctx, b.client.AddressUTXOsAll(ctx, address))
+
+	orderUtxos := make([]UTxO.UTxO, 0, len(utxos))
+	for _, utxo := range utxos {
+		amounts := make([]Base.AddressAmount, 0, len(utxo.Amount))
+		for _, amount := range utxo.Amount {
+			amounts = append(amounts, Base.AddressAmount{Unit: amount.Unit, Quantity: amount.Quantity})
+		}
+		output := Base.Output{
+			Address:     utxo.Address,
+			Amount:      amounts,
+			OutputIndex: utxo.OutputIndex,
+		}
+		if utxo.InlineDatum != nil {
+			output.InlineDatum = *utxo.InlineDatum
+		} else if utxo.DataHash != nil {
+			output.DataHash = *utxo.DataHash
+		}
+		orderUtxos = append(orderUtxos, *output.ToUTxO(utxo.TxHash))
 	}
+	return orderUtxos, errs
+}
 
-	return data["cbor"], nil
+// blockfrostTxUtxos is the body of /txs/{hash}/utxos
+type blockfrostTxUtxos struct {
+	Inputs []struct {
+		Base.Output
+		TxHash    string `json:"tx_hash"`
+		Reference bool   `json:"reference"`
+	} `json:"inputs"`
+	Outputs []struct {
+		OutputIndex  int     `json:"output_index"`
+		ConsumedByTx *string `json:"consumed_by_tx"`
+	} `json:"outputs"`
 }
 
-func (b *BlockFrost) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
-	network := c.MAINNET
-	switch b.options.Server {
-	case blockfrost.CardanoPreProd:
-		network = c.PREPROD
-	case blockfrost.CardanoPreview:
-		network = c.PREVIEW
-	case blockfrost.CardanoTestNet:
-		network = c.TESTNET
+func (b *BlockFrost) GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error) {
+	var created blockfrostTxUtxos
+	err := b.get(ctx, fmt.Sprintf("/txs/%s/utxos", txhash), &created)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	var spender *string
+	for _, output := range created.Outputs {
+		if output.OutputIndex == index {
+			found = true
+			spender = output.ConsumedByTx
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("cannot find output %s#%d", txhash, index)
+	}
+	if spender == nil {
+		return nil, nil
+	}
+
+	var txCbor struct {
+		Cbor string `json:"cbor"`
+	}
+	err = b.get(ctx, fmt.Sprintf("/txs/%s/cbor", *spender), &txCbor)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeTx(txCbor.Cbor)
+	if err != nil {
+		return nil, err
 	}
 
-	apo, _ := apollo.NewBlockfrostBackend(b.options.ProjectID, network)
-	return apo.GetUtxoFromRef(txhash, index)
+	var spent blockfrostTxUtxos
+	err = b.get(ctx, fmt.Sprintf("/txs/%s/utxos", *spender), &spent)
+	if err != nil {
+		return nil, err
+	}
+	inputs := []UTxO.UTxO{}
+	for _, input := range spent.Inputs {
+		if input.Collateral || input.Reference {
+			continue
+		}
+		inputs = append(inputs, *input.Output.ToUTxO(input.TxHash))
+	}
+	return &SpendingTx{TxHash: *spender, Tx: tx, Inputs: inputs}, nil
 }
 
 func (b *BlockFrost) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
@@ -190,49 +369,40 @@ func (b *BlockFrost) GetAllStablePools(ctx context.Context) ([]utils.StablePoolS
 	var errs []error
 	var poolStates []utils.StablePoolState
 	for _, poolAddress := range poolAddresses {
-		resultChan := b.client.AddressUTXOsAll(ctx, poolAddress)
-
-		for {
-			result, keep := <-resultChan
-
-			for _, utxo := range result.Res {
-				var datum string
-				// Find Datum From InlineDatum Or DataHash
-				if utxo.InlineDatum != nil {
-					datum = *utxo.InlineDatum
-
-				} else if utxo.DataHash != nil {
-					s, err := b.GetDatumByDatumHash(ctx, *utxo.DataHash)
-					if err != nil {
-						errs = append(errs, err)
-						continue
-					}
-					datum = s
-
-				} else {
-					errs = append(errs, errors.New("cannot find datum of stable pool " + utxo.Address))
-				}
+		if ctx.Err() != nil {
+			return poolStates, append(errs, ctx.Err())
+		}
+		pageCtx, cancel := context.WithCancel(ctx)
+		utxos, es := collectUtxos(pageCtx, b.client.AddressUTXOsAll(pageCtx, poolAddress))
+		cancel()
+		errs = append(errs, es...)
+
+		for _, utxo := range utxos {
+			var datum string
+			// Find Datum From InlineDatum Or DataHash
+			if utxo.InlineDatum != nil {
+				datum = *utxo.InlineDatum
 
-				// Convert To StablePoolState From Datum
-				if datum != "" {
-					decodedHex, _ := hex.DecodeString(datum)
-					var plutusData PlutusData.PlutusData
-					_, err := cbor.Decode(decodedHex, &plutusData)
-					if err != nil {
-						errs = append(errs, err)
-						continue
-					}
-					poolState, err := utils.ConvertToStablePoolState(plutusData)
-					if err != nil {
-						errs = append(errs, err)
-						continue
-					}
-					poolStates = append(poolStates, poolState)
+			} else if utxo.DataHash != nil {
+				s, err := b.GetDatumByDatumHash(ctx, *utxo.DataHash)
+				if err != nil {
+					errs = append(errs, err)
+					continue
 				}
+				datum = s
+
+			} else {
+				errs = append(errs, errors.New("cannot find datum of stable pool " + utxo.Address))
 			}
 
-			if !keep {
-				break
+			// Convert To StablePoolState From Datum
+			if datum != "" {
+				poolState, err := decodeStablePoolState(datum)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				poolStates = append(poolStates, poolState)
 			}
 		}
 	}
@@ -256,45 +426,34 @@ func (b *BlockFrost) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fin
 	}
 
 	var poolState utils.StablePoolState
-	resultChan := b.client.AddressUTXOsAssetAll(ctx, poolAddress.String(), asset)
-	for {
-		result, keep := <-resultChan
-		if result.Err != nil {
-			return poolState, result.Err
-		}
-
-		for _, utxo := range result.Res {
-			var datum string
+	pageCtx, cancel := context.WithCancel(ctx)
+	utxos, errs := collectUtxos(pageCtx, b.client.AddressUTXOsAssetAll(pageCtx, poolAddress.String(), asset))
+	cancel()
+	if len(errs) != 0 {
+		return poolState, errs[0]
+	}
 
-			// Find Datum From InlineDatum Or DataHash
-			if utxo.InlineDatum != nil {
-				datum = *utxo.InlineDatum
+	for _, utxo := range utxos {
+		var datum string
 
-			} else if utxo.DataHash != nil {
-				s, err := b.GetDatumByDatumHash(ctx, *utxo.DataHash)
-				if err != nil {
-					return poolState, err
-				}
-				datum = s
+		// Find Datum From InlineDatum Or DataHash
+		if utxo.InlineDatum != nil {
+			datum = *utxo.InlineDatum
 
-			} else {
-				return poolState, errors.New("cannot find datum of stable pool")
+		} else if utxo.DataHash != nil {
+			s, err := b.GetDatumByDatumHash(ctx, *utxo.DataHash)
+			if err != nil {
+				return poolState, err
 			}
+			datum = s
 
-			// Convert To StablePoolState From Datum
-			if datum != "" {
-				decodedHex, _ := hex.DecodeString(datum)
-				var plutusData PlutusData.PlutusData
-				_, err := cbor.Decode(decodedHex, &plutusData)
-				if err != nil {
-					return poolState, err
-				}
-				return utils.ConvertToStablePoolState(plutusData)
-			}
+		} else {
+			return poolState, errors.New("cannot find datum of stable pool")
 		}
 
-		if !keep {
-			break
+		// Convert To StablePoolState From Datum
+		if datum != "" {
+			return decodeStablePoolState(datum)
 		}
 	}
 
@@ -308,21 +467,21 @@ func convertUtxosToPoolState(utxos []blockfrost.AddressUTXO, errs []error) ([]ut
 			continue
 		}
 
-		decodedHex, _ := hex.DecodeString(*utxo.InlineDatum)
-		var plutusData PlutusData.PlutusData
-		_, err := cbor.Decode(decodedHex, &plutusData)
+		pool, err := decodeV2PoolState(*utxo.InlineDatum)
 		if err != nil {
 			errs = append(errs, err)
 			continue
 		}
-
-		pool, err := utils.ConvertToV2PoolState(plutusData)
-		if err != nil {
-			errs = append(errs, err)
-			continue
+		amounts := make([]Base.AddressAmount, 0, len(utxo.Amount))
+		for _, amount := range utxo.Amount {
+			amounts = append(amounts, Base.AddressAmount{Unit: amount.Unit, Quantity: amount.Quantity})
+		}
+		output := Base.Output{
+			Address:     utxo.Address,
+			Amount:      amounts,
+			OutputIndex: utxo.OutputIndex,
 		}
-		pool.Datum = *utxo.InlineDatum
-		poolStates = append(poolStates, pool)
+		poolStates = append(poolStates, withPoolUtxo(pool, output.ToUTxO(utxo.TxHash)))
 	}
 
 	return poolStates, errs
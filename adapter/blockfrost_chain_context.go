@@ -0,0 +1,208 @@
+package adapter
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Newt6611/apollo/serialization"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+)
+
+// blockfrostAddressUtxo is an item of /addresses/{address}/utxos
+type blockfrostAddressUtxo struct {
+	Base.Output
+	TxHash string `json:"tx_hash"`
+}
+
+// blockfrostEvaluation is the body of /utils/txs/evaluate, Blockfrost answers
+// in the Ogmios v5 format
+type blockfrostEvaluation struct {
+	Result struct {
+		EvaluationResult map[string]struct {
+			Memory int64 `json:"memory"`
+			Steps  int64 `json:"steps"`
+		} `json:"EvaluationResult"`
+	} `json:"result"`
+}
+
+// BlockFrostChainContext is an apollo Base.ChainContext backed by the BlockFrost
+// adapter, so the queries of the tx builder share its rate limiter and retries
+type BlockFrostChainContext struct {
+	blockfrost *BlockFrost
+	network    int
+
+	mu              sync.Mutex
+	protocolParams  *Base.ProtocolParameters
+	paramsFetchedAt time.Time
+	genesisParams   *Base.GenesisParameters
+}
+
+func (b *BlockFrostChainContext) GetProtocolParams() Base.ProtocolParameters {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.protocolParams != nil && time.Since(b.paramsFetchedAt) < protocolParamsTTL {
+		return *b.protocolParams
+	}
+
+	var protocolParams Base.ProtocolParameters
+	err := b.blockfrost.get(context.Background(), "/epochs/latest/parameters", &protocolParams)
+	if err != nil {
+		if b.protocolParams != nil {
+			return *b.protocolParams
+		}
+		return Base.ProtocolParameters{}
+	}
+	b.protocolParams = &protocolParams
+	b.paramsFetchedAt = time.Now()
+	return protocolParams
+}
+
+func (b *BlockFrostChainContext) GetGenesisParams() Base.GenesisParameters {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.genesisParams != nil {
+		return *b.genesisParams
+	}
+
+	var genesisParams Base.GenesisParameters
+	err := b.blockfrost.get(context.Background(), "/genesis", &genesisParams)
+	if err != nil {
+		return Base.GenesisParameters{}
+	}
+	b.genesisParams = &genesisParams
+	return genesisParams
+}
+
+func (b *BlockFrostChainContext) Network() int {
+	return b.network
+}
+
+func (b *BlockFrostChainContext) Epoch() int {
+	var epoch Base.Epoch
+	err := b.blockfrost.get(context.Background(), "/epochs/latest", &epoch)
+	if err != nil {
+		return 0
+	}
+	return epoch.Epoch
+}
+
+func (b *BlockFrostChainContext) MaxTxFee() int {
+	protocolParams := b.GetProtocolParams()
+	maxTxExSteps, _ := strconv.Atoi(protocolParams.MaxTxExSteps)
+	maxTxExMem, _ := strconv.Atoi(protocolParams.MaxTxExMem)
+	return Base.Fee(b, protocolParams.MaxTxSize, maxTxExSteps, maxTxExMem)
+}
+
+func (b *BlockFrostChainContext) LastBlockSlot() int {
+	var block Base.Block
+	err := b.blockfrost.get(context.Background(), "/blocks/latest", &block)
+	if err != nil {
+		return 0
+	}
+	return block.Slot
+}
+
+func (b *BlockFrostChainContext) Utxos(address Address.Address) []UTxO.UTxO {
+	ctx := context.Background()
+	utxos := []UTxO.UTxO{}
+	for page := 1; ; page++ {
+		var addressUtxos []blockfrostAddressUtxo
+		err := b.blockfrost.get(ctx, fmt.Sprintf("/addresses/%s/utxos?page=%d", address.String(), page), &addressUtxos)
+		if err != nil || len(addressUtxos) == 0 {
+			return utxos
+		}
+
+		for _, addressUtxo := range addressUtxos {
+			utxo, err := b.toUTxO(ctx, addressUtxo)
+			if err != nil {
+				continue
+			}
+			utxos = append(utxos, *utxo)
+		}
+	}
+}
+
+// toUTxO converts an address utxo, its reference script is fetched by hash
+func (b *BlockFrostChainContext) toUTxO(ctx context.Context, addressUtxo blockfrostAddressUtxo) (*UTxO.UTxO, error) {
+	utxo := addressUtxo.Output.ToUTxO(addressUtxo.TxHash)
+	if addressUtxo.ReferenceScriptHash == "" {
+		return utxo, nil
+	}
+	script, err := b.script(ctx, addressUtxo.ReferenceScriptHash)
+	if err != nil {
+		return nil, err
+	}
+	withScriptRef(utxo, script)
+	return utxo, nil
+}
+
+func (b *BlockFrostChainContext) SubmitTx(tx Transaction.Transaction) (serialization.TransactionId, error) {
+	txBytes, err := tx.Bytes()
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+
+	var txHash string
+	err = b.blockfrost.post(context.Background(), "/tx/submit", "application/cbor", txBytes, &txHash)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	payload, err := hex.DecodeString(txHash)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	return serialization.TransactionId{Payload: payload}, nil
+}
+
+func (b *BlockFrostChainContext) EvaluateTx(tx []uint8) map[string]Redeemer.ExecutionUnits {
+	result := map[string]Redeemer.ExecutionUnits{}
+	var evaluation blockfrostEvaluation
+	// the body is the hex of the transaction despite the content type
+	err := b.blockfrost.post(context.Background(), "/utils/txs/evaluate", "application/cbor", []byte(hex.EncodeToString(tx)), &evaluation)
+	if err != nil {
+		return result
+	}
+
+	for key, budget := range evaluation.Result.EvaluationResult {
+		result[key] = Redeemer.ExecutionUnits{
+			Mem:   budget.Memory,
+			Steps: budget.Steps,
+		}
+	}
+	return result
+}
+
+func (b *BlockFrostChainContext) GetUtxoFromRef(txHash string, txIndex int) *UTxO.UTxO {
+	return b.blockfrost.GetUtxoFromRef(context.Background(), txHash, txIndex)
+}
+
+func (b *BlockFrostChainContext) GetContractCbor(scriptHash string) string {
+	script, err := b.script(context.Background(), scriptHash)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(script)
+}
+
+func (b *BlockFrostChainContext) script(ctx context.Context, scriptHash string) ([]byte, error) {
+	var data struct {
+		Cbor *string `json:"cbor"`
+	}
+	err := b.blockfrost.get(ctx, fmt.Sprintf("/scripts/%s/cbor", scriptHash), &data)
+	if err != nil {
+		return nil, err
+	}
+	if data.Cbor == nil {
+		return nil, errors.New("cannot find script " + scriptHash)
+	}
+	return hex.DecodeString(*data.Cbor)
+}
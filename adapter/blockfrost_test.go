@@ -0,0 +1,256 @@
+package adapter_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/utils"
+	"github.com/blockfrost/blockfrost-go"
+)
+
+const blockfrostFixtures = "testdata/blockfrost"
+
+func newBlockFrostStandIn(t *testing.T, handler http.HandlerFunc, limits adapter.BlockFrostLimits) *adapter.BlockFrost {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	if limits.MinBackoff == 0 {
+		limits.MinBackoff = time.Millisecond
+	}
+	bf, err := adapter.NewBlockFrostWithLimits(blockfrost.APIClientOptions{
+		ProjectID: "preprod-project",
+		Server:    server.URL,
+	}, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bf
+}
+
+func TestBlockFrostRetry(t *testing.T) {
+	var calls atomic.Int32
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("project_id") != "preprod-project" {
+			http.Error(w, "missing project_id", http.StatusForbidden)
+			return
+		}
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("<html>upstream down</html>"))
+		default:
+			w.Write([]byte(`{"cbor":"d87980"}`))
+		}
+	}, adapter.BlockFrostLimits{})
+
+	datum, err := bf.GetDatumByDatumHash(context.Background(), "00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datum != "d87980" {
+		t.Errorf("GetDatumByDatumHash expect d87980, but get %s\n", datum)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("GetDatumByDatumHash expect 3 requests, but get %d\n", calls.Load())
+	}
+}
+
+func TestBlockFrostErrorBodies(t *testing.T) {
+	var calls atomic.Int32
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if strings.Contains(r.URL.Path, "gateway") {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("<html>bad gateway</html>"))
+			return
+		}
+		w.Write([]byte("<html>maintenance</html>"))
+	}, adapter.BlockFrostLimits{MaxRetries: 2})
+
+	_, err := bf.GetDatumByDatumHash(context.Background(), "html")
+	if err == nil || !strings.Contains(err.Error(), "unexpected body") {
+		t.Errorf("GetDatumByDatumHash expect unexpected body error, but get %v\n", err)
+	}
+
+	calls.Store(0)
+	_, err = bf.GetDatumByDatumHash(context.Background(), "gateway")
+	if err == nil || !strings.Contains(err.Error(), "status 502") {
+		t.Errorf("GetDatumByDatumHash expect status 502 error, but get %v\n", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("GetDatumByDatumHash expect 3 requests, but get %d\n", calls.Load())
+	}
+}
+
+func TestBlockFrostGetV2PoolAll(t *testing.T) {
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "1" {
+			w.Write([]byte("[]"))
+			return
+		}
+		b, err := os.ReadFile(filepath.Join(blockfrostFixtures, "utxos_pool.json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}, adapter.BlockFrostLimits{})
+
+	pool, err := bf.GetV2PoolByPair(context.Background(), utils.MIN, utils.ADA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 || pool.TotalLiquidity != 1_000_000_000 {
+		t.Errorf("GetV2PoolByPair unexpected pool %+v\n", pool)
+	}
+	checkPoolUtxo(t, pool)
+}
+
+func TestBlockFrostContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}, adapter.BlockFrostLimits{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, errs := bf.GetV2PoolAll(ctx)
+	if len(errs) == 0 || !errors.Is(errs[len(errs)-1], context.DeadlineExceeded) {
+		t.Errorf("GetV2PoolAll expect context deadline error, but get %v\n", errs)
+	}
+	_, errs = bf.GetAllStablePools(ctx)
+	if len(errs) == 0 {
+		t.Error("GetAllStablePools expect error on a done context")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("canceled calls expect to return at once, but take %s\n", elapsed)
+	}
+}
+
+func TestBlockFrostRateLimit(t *testing.T) {
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cbor":"d87980"}`))
+	}, adapter.BlockFrostLimits{RequestsPerSecond: 20, Burst: 1})
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := bf.GetDatumByDatumHash(context.Background(), "00"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request uses the burst, the other three wait 50ms each
+	if elapsed := time.Since(start); elapsed < 120*time.Millisecond {
+		t.Errorf("4 requests at 20/s expect at least 150ms, but take %s\n", elapsed)
+	}
+}
+
+func TestBlockFrostChainContext(t *testing.T) {
+	const wallet = "addr_test1qpssc0r090a9u0pyvdr9y76sm2xzx04n6d4j0y5hukcx6rxz4dtgkhfdynadkea0qezv99wljdl076xkg2krm96nn8jszmh3w7"
+	var paramsCalls atomic.Int32
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/epochs/latest/parameters":
+			// the builder queries go through the retry transport too
+			if paramsCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte(`{"min_fee_a":44,"min_fee_b":155381,"max_tx_size":16384,"coins_per_utxo_size":"4310"}`))
+		case "/addresses/" + wallet + "/utxos":
+			if r.URL.Query().Get("page") != "1" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`[{"address":"` + wallet + `","tx_hash":"c3f9ccf38f3ca5a7702f9c5267ffe1d3232fcd7b6bfbeedf45c4982e33cd5d45","output_index":1,` +
+				`"amount":[{"unit":"lovelace","quantity":"12000000"}],"data_hash":null,"inline_datum":null,` +
+				`"reference_script_hash":"83a2d61669af82b7eb7d4ad30337951316e8a2729574fc37dfd50aa2"}]`))
+		case "/scripts/83a2d61669af82b7eb7d4ad30337951316e8a2729574fc37dfd50aa2/cbor":
+			w.Write([]byte(`{"cbor":"4e4d01000033222220051200120011"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}, adapter.BlockFrostLimits{})
+	chainContext := bf.ChainContext()
+
+	params := chainContext.GetProtocolParams()
+	if params.MinFeeCoefficient != 44 || params.MinFeeConstant != 155381 {
+		t.Errorf("GetProtocolParams unexpected params %+v\n", params)
+	}
+	chainContext.GetProtocolParams()
+	if paramsCalls.Load() != 2 {
+		t.Errorf("GetProtocolParams expect 2 requests, but get %d\n", paramsCalls.Load())
+	}
+
+	address, err := Address.DecodeAddress(wallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxos := chainContext.Utxos(address)
+	if len(utxos) != 1 {
+		t.Fatalf("Utxos expect 1 utxo, but get %d\n", len(utxos))
+	}
+	if script := hex.EncodeToString(utxos[0].Output.GetScriptRef().Script.Script); script != "4e4d01000033222220051200120011" {
+		t.Errorf("Utxos expect reference script 4e4d01000033222220051200120011, but get %q\n", script)
+	}
+	if chainContext.GetContractCbor("00") != "" {
+		t.Error("GetContractCbor expect empty cbor for an unknown script")
+	}
+}
+
+func TestBlockFrostSubmitRetry(t *testing.T) {
+	var calls atomic.Int32
+	bf := newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			// the node may have taken the transaction, so a 5xx is never retried
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`"c3f9ccf38f3ca5a7702f9c5267ffe1d3232fcd7b6bfbeedf45c4982e33cd5d45"`))
+		}
+	}, adapter.BlockFrostLimits{})
+
+	_, err := bf.ChainContext().SubmitTx(Transaction.Transaction{})
+	if err == nil || !strings.Contains(err.Error(), "status 502") {
+		t.Errorf("SubmitTx expect status 502 error, but get %v\n", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("SubmitTx expect 2 requests, but get %d\n", calls.Load())
+	}
+
+	// a 429 without Retry-After is not retried either
+	bf = newBlockFrostStandIn(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}, adapter.BlockFrostLimits{})
+	calls.Store(0)
+	if _, err := bf.ChainContext().SubmitTx(Transaction.Transaction{}); err == nil {
+		t.Error("SubmitTx expect an error on 429")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("SubmitTx expect 1 request, but get %d\n", calls.Load())
+	}
+}
@@ -0,0 +1,283 @@
+package adapter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const (
+	DefaultCachedPoolTTL         = 30 * time.Second
+	DefaultCachedTipPollInterval = 2 * time.Second
+)
+
+type CachedOptions struct {
+	// How long a pool snapshot is served, defaults to DefaultCachedPoolTTL
+	PoolTTL time.Duration
+	// How often the chain tip is checked, the pool snapshot is dropped once the
+	// tip moves. Defaults to DefaultCachedTipPollInterval, negative disables it
+	TipPollInterval time.Duration
+}
+
+// poolSnapshot is the result of one GetV2PoolAll call on the inner adapter,
+// indexed by pair and by LP asset unit
+type poolSnapshot struct {
+	pools     []utils.V2PoolState
+	errs      []error
+	byPair    map[string]int
+	byLpAsset map[string]int
+	fetchedAt time.Time
+}
+
+// Cached wraps an Adapter, datums are memoized forever since they are immutable
+// and V2 pools are served from a snapshot until PoolTTL passes or a new tip is
+// observed. Paged queries, utxos and stable pools go straight to the inner adapter
+type Cached struct {
+	inner           Adapter
+	poolTTL         time.Duration
+	tipPollInterval time.Duration
+
+	datums sync.Map
+
+	mu       sync.RWMutex
+	snapshot *poolSnapshot
+	// last time the tip was checked and the slot seen then
+	tipCheckedAt time.Time
+	tipSlot      int
+
+	// serializes snapshot refreshes so concurrent misses fetch once
+	refreshMu sync.Mutex
+}
+
+func NewCached(inner Adapter, opts CachedOptions) *Cached {
+	if opts.PoolTTL <= 0 {
+		opts.PoolTTL = DefaultCachedPoolTTL
+	}
+	if opts.TipPollInterval == 0 {
+		opts.TipPollInterval = DefaultCachedTipPollInterval
+	}
+	return &Cached{
+		inner:           inner,
+		poolTTL:         opts.PoolTTL,
+		tipPollInterval: opts.TipPollInterval,
+	}
+}
+
+// Inner returns the wrapped adapter
+func (a *Cached) Inner() Adapter {
+	return a.inner
+}
+
+// Invalidate drops the pool snapshot, datums stay cached
+func (a *Cached) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.snapshot = nil
+}
+
+// pairKey keys a pool by its assets as they are on chain
+func pairKey(assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) string {
+	return assetUnit(assetA) + "." + assetUnit(assetB)
+}
+
+func assetUnit(asset Fingerprint.Fingerprint) string {
+	return asset.PolicyId.Value + asset.AssetName.Value
+}
+
+// lpAssetUnit computes the LP asset of the pool of assetA and assetB, the same
+// way as v2.ComputeLPAsset
+func lpAssetUnit(lpPolicyId string, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (string, error) {
+	k1, err := utils.Sha3(assetUnit(assetA))
+	if err != nil {
+		return "", err
+	}
+	k2, err := utils.Sha3(assetUnit(assetB))
+	if err != nil {
+		return "", err
+	}
+	assetName, err := utils.Sha3(k1 + k2)
+	if err != nil {
+		return "", err
+	}
+	return lpPolicyId + assetName, nil
+}
+
+func newPoolSnapshot(network c.Network, pools []utils.V2PoolState, errs []error) *poolSnapshot {
+	snapshot := &poolSnapshot{
+		pools:     pools,
+		errs:      errs,
+		byPair:    make(map[string]int, len(pools)),
+		byLpAsset: make(map[string]int, len(pools)),
+		fetchedAt: time.Now(),
+	}
+	lpPolicyId := constants.V2Config[normalizeNetwork(network)].LpPolicyId
+	for i, pool := range pools {
+		snapshot.byPair[pairKey(pool.AssetA, pool.AssetB)] = i
+		lpAsset, err := lpAssetUnit(lpPolicyId, pool.AssetA, pool.AssetB)
+		if err != nil {
+			snapshot.errs = append(snapshot.errs, err)
+			continue
+		}
+		snapshot.byLpAsset[lpAsset] = i
+	}
+	return snapshot
+}
+
+// currentSnapshot returns the cached snapshot if it is still fresh
+func (a *Cached) currentSnapshot() *poolSnapshot {
+	a.mu.RLock()
+	snapshot := a.snapshot
+	tipCheckedAt := a.tipCheckedAt
+	a.mu.RUnlock()
+
+	if snapshot == nil || time.Since(snapshot.fetchedAt) >= a.poolTTL {
+		return nil
+	}
+	if a.tipPollInterval < 0 || time.Since(tipCheckedAt) < a.tipPollInterval {
+		return snapshot
+	}
+
+	// only one caller checks the tip, the others keep serving the snapshot
+	a.mu.Lock()
+	if a.tipCheckedAt != tipCheckedAt {
+		a.mu.Unlock()
+		return snapshot
+	}
+	a.tipCheckedAt = time.Now()
+	a.mu.Unlock()
+
+	slot := a.inner.ChainContext().LastBlockSlot()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// chain contexts return 0 when the tip cannot be read, keep the snapshot
+	// until the tip is known again
+	if slot == 0 {
+		return a.snapshot
+	}
+	if a.tipSlot != 0 && slot != a.tipSlot {
+		a.tipSlot = slot
+		a.snapshot = nil
+		return nil
+	}
+	a.tipSlot = slot
+	return a.snapshot
+}
+
+func (a *Cached) poolSnapshot(ctx context.Context) *poolSnapshot {
+	if snapshot := a.currentSnapshot(); snapshot != nil {
+		return snapshot
+	}
+
+	a.refreshMu.Lock()
+	defer a.refreshMu.Unlock()
+	// another caller may have refreshed while we waited
+	if snapshot := a.currentSnapshot(); snapshot != nil {
+		return snapshot
+	}
+
+	slot := 0
+	if a.tipPollInterval >= 0 {
+		slot = a.inner.ChainContext().LastBlockSlot()
+	}
+	pools, errs := a.inner.GetV2PoolAll(ctx)
+	snapshot := newPoolSnapshot(a.inner.NetworkId(), pools, errs)
+	// a failed fetch is not worth keeping, the next call retries
+	if len(pools) == 0 && len(errs) != 0 {
+		return snapshot
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.snapshot = snapshot
+	a.tipSlot = slot
+	a.tipCheckedAt = time.Now()
+	return snapshot
+}
+
+func (a *Cached) NetworkId() c.Network {
+	return a.inner.NetworkId()
+}
+
+func (a *Cached) ChainContext() Base.ChainContext {
+	return a.inner.ChainContext()
+}
+
+func (a *Cached) NewBuilder() *apollo.Apollo {
+	return a.inner.NewBuilder()
+}
+
+func (a *Cached) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	snapshot := a.poolSnapshot(ctx)
+	return append([]utils.V2PoolState{}, snapshot.pools...), snapshot.errs
+}
+
+func (a *Cached) GetV2Pool(ctx context.Context, params QueryParams) ([]utils.V2PoolState, []error) {
+	return a.inner.GetV2Pool(ctx, params)
+}
+
+func (a *Cached) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	snapshot := a.poolSnapshot(ctx)
+	// normalized the same way as FindV2PoolByPair
+	i, ok := snapshot.byPair[pairKey(normalizeAssets(assetA, assetB))]
+	if !ok {
+		if len(snapshot.pools) == 0 && len(snapshot.errs) != 0 {
+			return utils.V2PoolState{}, snapshot.errs[0]
+		}
+		return utils.V2PoolState{}, ErrPoolNotFound
+	}
+	return snapshot.pools[i], nil
+}
+
+// GetV2PoolByLpAsset returns the V2 pool whose LP token is lpAsset
+func (a *Cached) GetV2PoolByLpAsset(ctx context.Context, lpAsset Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	snapshot := a.poolSnapshot(ctx)
+	i, ok := snapshot.byLpAsset[assetUnit(lpAsset)]
+	if !ok {
+		if len(snapshot.pools) == 0 && len(snapshot.errs) != 0 {
+			return utils.V2PoolState{}, snapshot.errs[0]
+		}
+		return utils.V2PoolState{}, ErrPoolNotFound
+	}
+	return snapshot.pools[i], nil
+}
+
+func (a *Cached) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	if datum, ok := a.datums.Load(datumHash); ok {
+		return datum.(string), nil
+	}
+	datum, err := a.inner.GetDatumByDatumHash(ctx, datumHash)
+	if err != nil {
+		return "", err
+	}
+	a.datums.Store(datumHash, datum)
+	return datum, nil
+}
+
+func (a *Cached) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	return a.inner.GetUtxoFromRef(ctx, txhash, index)
+}
+
+// GetV2OrderUtxos is not cached, orders come and go every block
+func (a *Cached) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	return a.inner.GetV2OrderUtxos(ctx)
+}
+
+func (a *Cached) GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error) {
+	return a.inner.GetSpendingTx(ctx, txhash, index)
+}
+
+func (a *Cached) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
+	return a.inner.GetAllStablePools(ctx)
+}
+
+func (a *Cached) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error) {
+	return a.inner.GetStablePoolByNFT(ctx, nft)
+}
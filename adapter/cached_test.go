@@ -0,0 +1,123 @@
+package adapter_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Newt6611/apollo/serialization/AssetName"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/Policy"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/adapter/fake"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+// countingAdapter counts the calls the cache lets through
+type countingAdapter struct {
+	*fake.Adapter
+	poolCalls  int
+	datumCalls int
+}
+
+func (a *countingAdapter) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	a.poolCalls++
+	return a.Adapter.GetV2PoolAll(ctx)
+}
+
+func (a *countingAdapter) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	a.datumCalls++
+	return a.Adapter.GetDatumByDatumHash(ctx, datumHash)
+}
+
+func newCountingAdapter(t *testing.T) *countingAdapter {
+	t.Helper()
+	inner, err := fake.Testnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingAdapter{Adapter: inner}
+}
+
+func TestCachedGetV2PoolByPair(t *testing.T) {
+	inner := newCountingAdapter(t)
+	cached := adapter.NewCached(inner, adapter.CachedOptions{TipPollInterval: -1})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		pool, err := cached.GetV2PoolByPair(ctx, utils.MIN, utils.ADA)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 {
+			t.Errorf("GetV2PoolByPair unexpected pool %+v\n", pool)
+		}
+	}
+	if inner.poolCalls != 1 {
+		t.Errorf("GetV2PoolAll expect 1 call, but get %d\n", inner.poolCalls)
+	}
+
+	lpPolicy, _ := Policy.New("d6aae2059baee188f74917493cf7637e679cd219bdfbbf4dcbeb1d0b")
+	lpAsset := Fingerprint.New(*lpPolicy, *AssetName.NewAssetNameFromHexString("6c3ea488e6ff940bb6fb1b18fd605b5931d9fefde6440117015ba484cf321200"))
+	if _, err := cached.GetV2PoolByLpAsset(ctx, *lpAsset); err != nil {
+		t.Error(err)
+	}
+
+	cached.Invalidate()
+	cached.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if inner.poolCalls != 2 {
+		t.Errorf("GetV2PoolAll expect 2 calls after Invalidate, but get %d\n", inner.poolCalls)
+	}
+}
+
+func TestCachedExpiry(t *testing.T) {
+	inner := newCountingAdapter(t)
+	ctx := context.Background()
+
+	cached := adapter.NewCached(inner, adapter.CachedOptions{PoolTTL: time.Millisecond, TipPollInterval: -1})
+	cached.GetV2PoolAll(ctx)
+	time.Sleep(2 * time.Millisecond)
+	cached.GetV2PoolAll(ctx)
+	if inner.poolCalls != 2 {
+		t.Errorf("GetV2PoolAll expect 2 calls after TTL, but get %d\n", inner.poolCalls)
+	}
+
+	inner.poolCalls = 0
+	cached = adapter.NewCached(inner, adapter.CachedOptions{PoolTTL: time.Hour, TipPollInterval: time.Nanosecond})
+	cached.GetV2PoolAll(ctx)
+	cached.GetV2PoolAll(ctx)
+	inner.FakeChainContext().SetLastBlockSlot(inner.ChainContext().LastBlockSlot() + 20)
+	cached.GetV2PoolAll(ctx)
+	if inner.poolCalls != 2 {
+		t.Errorf("GetV2PoolAll expect 2 calls after new tip, but get %d\n", inner.poolCalls)
+	}
+
+	// the tip cannot be read, the snapshot is kept
+	slot := inner.ChainContext().LastBlockSlot()
+	inner.FakeChainContext().SetLastBlockSlot(0)
+	cached.GetV2PoolAll(ctx)
+	inner.FakeChainContext().SetLastBlockSlot(slot)
+	cached.GetV2PoolAll(ctx)
+	if inner.poolCalls != 2 {
+		t.Errorf("GetV2PoolAll expect 2 calls when the tip read fails, but get %d\n", inner.poolCalls)
+	}
+}
+
+func TestCachedGetDatumByDatumHash(t *testing.T) {
+	inner := newCountingAdapter(t)
+	cached := adapter.NewCached(inner, adapter.CachedOptions{})
+	ctx := context.Background()
+
+	datumHash := "9a1b3c5e7f9a1b3c5d7e9f1a3b5c7d9e1f3a5b7c9d1e3f5a7b9c1d3e5f7a9b1c"
+	for i := 0; i < 3; i++ {
+		if _, err := cached.GetDatumByDatumHash(ctx, datumHash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cached.GetDatumByDatumHash(ctx, "00"); err == nil {
+		t.Error("GetDatumByDatumHash expect error for unknown datum")
+	}
+	if inner.datumCalls != 2 {
+		t.Errorf("GetDatumByDatumHash expect 2 calls, but get %d\n", inner.datumCalls)
+	}
+}
@@ -0,0 +1,252 @@
+package adapter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type CassetteMode int
+
+const (
+	// CassetteReplay serves recorded responses and never touches the network
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord forwards requests and saves every response it can replay
+	CassetteRecord
+)
+
+// cassetteMissError is returned in replay mode for a request that was never
+// recorded. It is not temporary, so retryTransport gives up at once
+type cassetteMissError struct {
+	method string
+	path   string
+}
+
+func (e *cassetteMissError) Error() string {
+	return fmt.Sprintf("cassette: no recording for %s %s", e.method, e.path)
+}
+
+func (e *cassetteMissError) Temporary() bool {
+	return false
+}
+
+// cassetteEntry is one recorded response, request headers such as project_id
+// are never written
+type cassetteEntry struct {
+	Method string              `json:"method"`
+	URL    string              `json:"url"`
+	Status int                 `json:"status"`
+	Header map[string][]string `json:"header,omitempty"`
+	Body   json.RawMessage     `json:"body,omitempty"`
+	// set instead of Body when the response is not JSON
+	RawBody string `json:"raw_body,omitempty"`
+}
+
+// Cassette is an http.RoundTripper that records responses into dir, one file
+// per request, and replays them offline. Pass it as the Transport of
+// blockfrost.APIClientOptions.Client:
+//
+//	cassette := adapter.NewCassette("testdata/cassettes", adapter.CassetteReplay, nil)
+//	bf, err := adapter.NewBlockFrost(blockfrost.APIClientOptions{
+//		Server: blockfrost.CardanoMainNet,
+//		Client: &http.Client{Transport: cassette},
+//	})
+//
+// Requests are keyed by method, path, query and body, the host is ignored.
+// 429 and 5xx responses are not recorded. The Blockfrost SDK fetches pages
+// ahead in parallel and which ones it asks for varies between runs, so in
+// replay mode a page past a recorded last page, one shorter than its count, is
+// served as an empty list. Any other missing page fails, so an incomplete
+// cassette is never mistaken for the end of a listing
+type Cassette struct {
+	dir  string
+	mode CassetteMode
+	base http.RoundTripper
+
+	mu sync.Mutex
+}
+
+// NewCassette returns a Cassette in mode, base is used to record and defaults
+// to http.DefaultTransport
+func NewCassette(dir string, mode CassetteMode, base http.RoundTripper) *Cassette {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Cassette{
+		dir:  dir,
+		mode: mode,
+		base: base,
+	}
+}
+
+var cassetteUnsafe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// cassetteFile names the recording of a request, a readable prefix from the
+// path with long segments such as addresses shortened, followed by a hash of
+// everything the key covers
+func cassetteFile(method string, path string, query string, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", method, path, query)
+	hash.Write(body)
+	sum := hex.EncodeToString(hash.Sum(nil))[:12]
+
+	name := []string{method}
+	for _, segment := range strings.Split(path, "/") {
+		segment = cassetteUnsafe.ReplaceAllString(segment, "_")
+		if len(segment) > 16 {
+			segment = segment[:12]
+		}
+		if segment != "" {
+			name = append(name, segment)
+		}
+	}
+	return strings.Join(append(name, sum), "_") + ".json"
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	query := req.URL.Query().Encode()
+	file := filepath.Join(c.dir, cassetteFile(req.Method, req.URL.Path, query, body))
+
+	if c.mode == CassetteRecord {
+		return c.record(req, file)
+	}
+	return c.replay(req, file)
+}
+
+func (c *Cassette) replay(req *http.Request, file string) (*http.Response, error) {
+	b, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		if c.pastLastPage(req) {
+			return cassetteResponse(req, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, []byte("[]")), nil
+		}
+		return nil, &cassetteMissError{method: req.Method, path: req.URL.RequestURI()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry cassetteEntry
+	err = json.Unmarshal(b, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", file, err)
+	}
+	body := []byte(entry.Body)
+	if entry.RawBody != "" {
+		body = []byte(entry.RawBody)
+	}
+	return cassetteResponse(req, entry.Status, entry.Header, body), nil
+}
+
+// pastLastPage reports whether the closest recorded page before the one req
+// asks for is the last page of its listing
+func (c *Cassette) pastLastPage(req *http.Request) bool {
+	query := req.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	count, err := strconv.Atoi(query.Get("count"))
+	if err != nil || count <= 0 {
+		count = 100
+	}
+	for previous := page - 1; previous >= 1; previous-- {
+		query.Set("page", strconv.Itoa(previous))
+		b, err := os.ReadFile(filepath.Join(c.dir, cassetteFile(req.Method, req.URL.Path, query.Encode(), nil)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false
+		}
+		var entry cassetteEntry
+		var items []json.RawMessage
+		if json.Unmarshal(b, &entry) != nil || json.Unmarshal(entry.Body, &items) != nil {
+			return false
+		}
+		return len(items) < count
+	}
+	return false
+}
+
+func (c *Cassette) record(req *http.Request, file string) (*http.Response, error) {
+	resp, err := c.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if retryable(resp) {
+		return resp, nil
+	}
+
+	entry := cassetteEntry{
+		Method: req.Method,
+		URL:    req.URL.Path,
+		Status: resp.StatusCode,
+	}
+	if req.URL.RawQuery != "" {
+		entry.URL += "?" + req.URL.Query().Encode()
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		entry.Header = map[string][]string{"Content-Type": {contentType}}
+	}
+	if json.Valid(body) {
+		entry.Body = body
+	} else {
+		entry.RawBody = string(body)
+	}
+	b, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err = os.MkdirAll(c.dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(file, append(b, '\n'), 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func cassetteResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,356 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const (
+	DefaultFailoverFailureThreshold = 3
+	DefaultFailoverCooldown         = 30 * time.Second
+	DefaultFailoverTimeout          = 10 * time.Second
+)
+
+// ErrCrossCheckMismatch is returned when two backends at the same tip disagree
+// on a pool
+var ErrCrossCheckMismatch = errors.New("backends disagree on pool state")
+
+type FailoverOptions struct {
+	// Consecutive failures before a backend is skipped, defaults to
+	// DefaultFailoverFailureThreshold
+	FailureThreshold int
+	// How long a tripped backend is skipped before it is tried again, defaults
+	// to DefaultFailoverCooldown
+	Cooldown time.Duration
+	// Deadline of a call to a backend, defaults to DefaultFailoverTimeout
+	Timeout time.Duration
+	// Deadline of the calls walking a whole listing, GetV2PoolAll,
+	// GetV2PoolByPair, GetV2OrderUtxos, GetAllStablePools and GetSpendingTx.
+	// They can take much longer than Timeout on mainnet, so they have no
+	// deadline by default
+	ListTimeout time.Duration
+	// Ask a second backend for the same pool in GetV2PoolByPair, when the pool
+	// utxo or its reserves differ the backend with the older tip is counted as
+	// failed
+	CrossCheck bool
+}
+
+// breaker is a circuit breaker of one backend. It opens after FailureThreshold
+// consecutive failures and lets a single call through once Cooldown has passed
+type breaker struct {
+	failures int
+	openedAt time.Time
+	open     bool
+}
+
+// Failover tries its adapters in priority order, skipping the ones whose circuit
+// breaker is open. When every breaker is open all adapters are tried anyway
+type Failover struct {
+	adapters []Adapter
+	opts     FailoverOptions
+
+	mu       sync.Mutex
+	breakers []breaker
+}
+
+func NewFailover(adapters ...Adapter) (*Failover, error) {
+	return NewFailoverWithOptions(FailoverOptions{}, adapters...)
+}
+
+func NewFailoverWithOptions(opts FailoverOptions, adapters ...Adapter) (*Failover, error) {
+	if len(adapters) == 0 {
+		return nil, errors.New("failover needs at least one adapter")
+	}
+	network := adapters[0].NetworkId()
+	for i, a := range adapters[1:] {
+		if a.NetworkId() != network {
+			return nil, fmt.Errorf("adapter %d is on network %d, expect %d", i+1, a.NetworkId(), network)
+		}
+	}
+
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = DefaultFailoverFailureThreshold
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = DefaultFailoverCooldown
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultFailoverTimeout
+	}
+	return &Failover{
+		adapters: adapters,
+		opts:     opts,
+		breakers: make([]breaker, len(adapters)),
+	}, nil
+}
+
+// available returns the indexes of the adapters to try, in priority order
+func (f *Failover) available() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	indexes := []int{}
+	for i := range f.breakers {
+		b := &f.breakers[i]
+		if !b.open {
+			indexes = append(indexes, i)
+			continue
+		}
+		if now.Sub(b.openedAt) >= f.opts.Cooldown {
+			// half open, push openedAt so only this call tries it
+			b.openedAt = now
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		for i := range f.adapters {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+func (f *Failover) success(i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.breakers[i] = breaker{}
+}
+
+func (f *Failover) failure(i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b := &f.breakers[i]
+	b.failures++
+	if b.open || b.failures >= f.opts.FailureThreshold {
+		b.open = true
+		b.openedAt = time.Now()
+	}
+}
+
+// Healthy reports, in priority order, which adapters have a closed breaker
+func (f *Failover) Healthy() []bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	healthy := make([]bool, len(f.breakers))
+	for i, b := range f.breakers {
+		healthy[i] = !b.open
+	}
+	return healthy
+}
+
+// withTimeout bounds ctx by timeout, a timeout of 0 or less adds no deadline
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// failover calls call on each available adapter, each call bounded by timeout,
+// until one succeeds. A canceled ctx stops the loop without blaming the
+// adapter, and ErrPoolNotFound is an answer rather than a failure
+func failover[T any](ctx context.Context, f *Failover, timeout time.Duration, call func(ctx context.Context, a Adapter) (T, error)) (T, int, error) {
+	var result T
+	var err error
+	for _, i := range f.available() {
+		callCtx, cancel := withTimeout(ctx, timeout)
+		result, err = call(callCtx, f.adapters[i])
+		cancel()
+		if err == nil || errors.Is(err, ErrPoolNotFound) {
+			f.success(i)
+			return result, i, err
+		}
+		if ctx.Err() != nil {
+			return result, i, ctx.Err()
+		}
+		f.failure(i)
+	}
+	return result, -1, err
+}
+
+// joinErrs turns the []error of the list methods into a failure when nothing
+// came back
+func joinErrs[T any](result []T, errs []error) error {
+	if len(result) == 0 && len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// primary returns the highest priority adapter whose breaker is closed
+func (f *Failover) primary() Adapter {
+	return f.adapters[f.available()[0]]
+}
+
+func (f *Failover) NetworkId() c.Network {
+	return f.adapters[0].NetworkId()
+}
+
+// ChainContext returns the chain context of the highest priority healthy adapter
+func (f *Failover) ChainContext() Base.ChainContext {
+	return f.primary().ChainContext()
+}
+
+func (f *Failover) NewBuilder() *apollo.Apollo {
+	return f.primary().NewBuilder()
+}
+
+func (f *Failover) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	var errs []error
+	pools, _, err := failover(ctx, f, f.opts.ListTimeout, func(ctx context.Context, a Adapter) ([]utils.V2PoolState, error) {
+		var pools []utils.V2PoolState
+		pools, errs = a.GetV2PoolAll(ctx)
+		return pools, joinErrs(pools, errs)
+	})
+	if err != nil && len(errs) == 0 {
+		errs = []error{err}
+	}
+	return pools, errs
+}
+
+func (f *Failover) GetV2Pool(ctx context.Context, params QueryParams) ([]utils.V2PoolState, []error) {
+	var errs []error
+	pools, _, err := failover(ctx, f, f.opts.Timeout, func(ctx context.Context, a Adapter) ([]utils.V2PoolState, error) {
+		var pools []utils.V2PoolState
+		pools, errs = a.GetV2Pool(ctx, params)
+		return pools, joinErrs(pools, errs)
+	})
+	if err != nil && len(errs) == 0 {
+		errs = []error{err}
+	}
+	return pools, errs
+}
+
+func (f *Failover) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	pool, i, err := failover(ctx, f, f.opts.ListTimeout, func(ctx context.Context, a Adapter) (utils.V2PoolState, error) {
+		return a.GetV2PoolByPair(ctx, assetA, assetB)
+	})
+	if err != nil || !f.opts.CrossCheck {
+		return pool, err
+	}
+	return f.crossCheck(ctx, i, pool, func(ctx context.Context, a Adapter) (utils.V2PoolState, error) {
+		return a.GetV2PoolByPair(ctx, assetA, assetB)
+	})
+}
+
+// crossCheck asks the next available adapter after i for the same pool. When the
+// pool utxo or its reserves differ, the pool of the adapter with the newer tip wins and the other
+// adapter is counted as failed
+func (f *Failover) crossCheck(ctx context.Context, i int, pool utils.V2PoolState,
+	call func(ctx context.Context, a Adapter) (utils.V2PoolState, error)) (utils.V2PoolState, error) {
+	j := -1
+	for _, k := range f.available() {
+		if k != i {
+			j = k
+			break
+		}
+	}
+	if j < 0 {
+		return pool, nil
+	}
+
+	callCtx, cancel := withTimeout(ctx, f.opts.ListTimeout)
+	other, err := call(callCtx, f.adapters[j])
+	cancel()
+	if err != nil {
+		if ctx.Err() == nil {
+			f.failure(j)
+		}
+		return pool, nil
+	}
+	f.success(j)
+
+	if pool.OutRef == other.OutRef &&
+		pool.ReserveA == other.ReserveA &&
+		pool.ReserveB == other.ReserveB &&
+		pool.TotalLiquidity == other.TotalLiquidity {
+		return pool, nil
+	}
+
+	slot := f.adapters[i].ChainContext().LastBlockSlot()
+	otherSlot := f.adapters[j].ChainContext().LastBlockSlot()
+	switch {
+	case slot > otherSlot:
+		f.failure(j)
+		return pool, nil
+	case otherSlot > slot:
+		f.failure(i)
+		return other, nil
+	default:
+		return pool, ErrCrossCheckMismatch
+	}
+}
+
+func (f *Failover) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	datum, _, err := failover(ctx, f, f.opts.Timeout, func(ctx context.Context, a Adapter) (string, error) {
+		return a.GetDatumByDatumHash(ctx, datumHash)
+	})
+	return datum, err
+}
+
+// GetUtxoFromRef returns the first utxo found. A nil utxo may just be spent, so
+// it moves on to the next adapter without counting a failure
+func (f *Failover) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	for _, i := range f.available() {
+		callCtx, cancel := withTimeout(ctx, f.opts.Timeout)
+		utxo := f.adapters[i].GetUtxoFromRef(callCtx, txhash, index)
+		cancel()
+		if utxo != nil {
+			return utxo
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (f *Failover) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	var errs []error
+	utxos, _, err := failover(ctx, f, f.opts.ListTimeout, func(ctx context.Context, a Adapter) ([]UTxO.UTxO, error) {
+		var utxos []UTxO.UTxO
+		utxos, errs = a.GetV2OrderUtxos(ctx)
+		return utxos, joinErrs(utxos, errs)
+	})
+	if err != nil && len(errs) == 0 {
+		errs = []error{err}
+	}
+	return utxos, errs
+}
+
+func (f *Failover) GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error) {
+	tx, _, err := failover(ctx, f, f.opts.ListTimeout, func(ctx context.Context, a Adapter) (*SpendingTx, error) {
+		return a.GetSpendingTx(ctx, txhash, index)
+	})
+	return tx, err
+}
+
+func (f *Failover) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
+	var errs []error
+	pools, _, err := failover(ctx, f, f.opts.ListTimeout, func(ctx context.Context, a Adapter) ([]utils.StablePoolState, error) {
+		var pools []utils.StablePoolState
+		pools, errs = a.GetAllStablePools(ctx)
+		return pools, joinErrs(pools, errs)
+	})
+	if err != nil && len(errs) == 0 {
+		errs = []error{err}
+	}
+	return pools, errs
+}
+
+func (f *Failover) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error) {
+	pool, _, err := failover(ctx, f, f.opts.Timeout, func(ctx context.Context, a Adapter) (utils.StablePoolState, error) {
+		return a.GetStablePoolByNFT(ctx, nft)
+	})
+	return pool, err
+}
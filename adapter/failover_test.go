@@ -0,0 +1,161 @@
+package adapter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	c "github.com/Newt6611/apollo/constants"
+
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/adapter/fake"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+// flakyAdapter fails GetV2PoolByPair while down is set, otherwise it shifts
+// ReserveA by lag, or the pool utxo when stale is set, to stand in for a
+// backend serving an older pool. GetV2PoolAll takes delay
+type flakyAdapter struct {
+	*fake.Adapter
+	down  bool
+	lag   uint64
+	stale bool
+	delay time.Duration
+	calls int
+}
+
+func (a *flakyAdapter) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	select {
+	case <-ctx.Done():
+		return nil, []error{ctx.Err()}
+	case <-time.After(a.delay):
+	}
+	return a.Adapter.GetV2PoolAll(ctx)
+}
+
+func (a *flakyAdapter) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	a.calls++
+	if a.down {
+		return utils.V2PoolState{}, errors.New("backend is down")
+	}
+	pool, err := a.Adapter.GetV2PoolByPair(ctx, assetA, assetB)
+	pool.ReserveA -= a.lag
+	if a.stale {
+		pool.OutRef.Index++
+	}
+	return pool, err
+}
+
+func newFlakyAdapter(t *testing.T) *flakyAdapter {
+	t.Helper()
+	inner, err := fake.Testnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &flakyAdapter{Adapter: inner}
+}
+
+func TestFailoverCircuitBreaker(t *testing.T) {
+	primary, secondary := newFlakyAdapter(t), newFlakyAdapter(t)
+	primary.down = true
+	failover, err := adapter.NewFailoverWithOptions(adapter.FailoverOptions{
+		FailureThreshold: 2,
+		Cooldown:         time.Hour,
+	}, primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if _, err := failover.GetV2PoolByPair(ctx, utils.ADA, utils.MIN); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary expect 2 calls before the breaker opens, but get %d\n", primary.calls)
+	}
+	if secondary.calls != 5 {
+		t.Errorf("secondary expect 5 calls, but get %d\n", secondary.calls)
+	}
+	if healthy := failover.Healthy(); healthy[0] || !healthy[1] {
+		t.Errorf("Healthy expect [false true], but get %v\n", healthy)
+	}
+
+	_, err = failover.GetV2PoolByPair(ctx, utils.ADA, Fingerprint.Fingerprint{})
+	if !errors.Is(err, adapter.ErrPoolNotFound) {
+		t.Errorf("GetV2PoolByPair expect ErrPoolNotFound, but get %v\n", err)
+	}
+	if !failover.Healthy()[1] {
+		t.Error("ErrPoolNotFound should not count as a failure")
+	}
+}
+
+func TestFailoverCrossCheck(t *testing.T) {
+	primary, secondary := newFlakyAdapter(t), newFlakyAdapter(t)
+	primary.lag = 1_000
+	secondary.FakeChainContext().SetLastBlockSlot(primary.ChainContext().LastBlockSlot() + 20)
+	failover, err := adapter.NewFailoverWithOptions(adapter.FailoverOptions{
+		FailureThreshold: 1,
+		CrossCheck:       true,
+	}, primary, secondary)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool, err := failover.GetV2PoolByPair(context.Background(), utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 {
+		t.Errorf("GetV2PoolByPair expect the pool of the newer tip, but get ReserveA %d\n", pool.ReserveA)
+	}
+	if healthy := failover.Healthy(); healthy[0] || !healthy[1] {
+		t.Errorf("Healthy expect [false true], but get %v\n", healthy)
+	}
+
+	secondary.FakeChainContext().SetLastBlockSlot(primary.ChainContext().LastBlockSlot())
+	failover, _ = adapter.NewFailoverWithOptions(adapter.FailoverOptions{CrossCheck: true}, primary, secondary)
+	_, err = failover.GetV2PoolByPair(context.Background(), utils.ADA, utils.MIN)
+	if !errors.Is(err, adapter.ErrCrossCheckMismatch) {
+		t.Errorf("GetV2PoolByPair expect ErrCrossCheckMismatch, but get %v\n", err)
+	}
+
+	// a stale pool utxo with the same reserves
+	primary.lag = 0
+	primary.stale = true
+	failover, _ = adapter.NewFailoverWithOptions(adapter.FailoverOptions{CrossCheck: true}, primary, secondary)
+	_, err = failover.GetV2PoolByPair(context.Background(), utils.ADA, utils.MIN)
+	if !errors.Is(err, adapter.ErrCrossCheckMismatch) {
+		t.Errorf("GetV2PoolByPair expect ErrCrossCheckMismatch for another pool utxo, but get %v\n", err)
+	}
+}
+
+func TestFailoverListTimeout(t *testing.T) {
+	slow := newFlakyAdapter(t)
+	slow.delay = 20 * time.Millisecond
+	failover, err := adapter.NewFailoverWithOptions(adapter.FailoverOptions{Timeout: time.Millisecond}, slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if pools, errs := failover.GetV2PoolAll(ctx); len(errs) != 0 || len(pools) == 0 {
+		t.Errorf("GetV2PoolAll expect no deadline by default, but get %d pools, errs %v\n", len(pools), errs)
+	}
+
+	failover, _ = adapter.NewFailoverWithOptions(adapter.FailoverOptions{ListTimeout: time.Millisecond}, slow)
+	if _, errs := failover.GetV2PoolAll(ctx); len(errs) == 0 || !errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Errorf("GetV2PoolAll expect the ListTimeout deadline, but get %v\n", errs)
+	}
+}
+
+func TestNewFailover(t *testing.T) {
+	if _, err := adapter.NewFailover(); err == nil {
+		t.Error("NewFailover expect error without adapters")
+	}
+	if _, err := adapter.NewFailover(newFlakyAdapter(t), fake.New(c.MAINNET)); err == nil {
+		t.Error("NewFailover expect error on mixed networks")
+	}
+}
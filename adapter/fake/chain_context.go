@@ -0,0 +1,243 @@
+package fake
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/Newt6611/apollo/serialization"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/TransactionInput"
+	"github.com/Newt6611/apollo/serialization/TransactionOutput"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/apollo/txBuilding/Backend/FixedChainContext"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// DefaultExUnits is the budget EvaluateTx reports for every redeemer
+var DefaultExUnits = Redeemer.ExecutionUnits{
+	Mem:   1_000_000,
+	Steps: 500_000_000,
+}
+
+// ChainContext is an in-memory apollo Base.ChainContext. Submitted transactions
+// spend their inputs and add their outputs to the utxo set
+type ChainContext struct {
+	mu             sync.Mutex
+	network        int
+	protocolParams Base.ProtocolParameters
+	genesisParams  Base.GenesisParameters
+	slot           int
+	utxos          map[string]UTxO.UTxO
+	// keys of utxos in insertion order, so lookups are deterministic
+	order     []string
+	submitted []Transaction.Transaction
+	// spending transaction of every utxo spent by SubmitTx
+	spent map[string]spend
+}
+
+type spend struct {
+	tx     Transaction.Transaction
+	inputs []UTxO.UTxO
+}
+
+func NewChainContext(network int) *ChainContext {
+	fixed := FixedChainContext.InitFixedChainContext()
+	return &ChainContext{
+		network:        network,
+		protocolParams: fixed.ProtocolParams,
+		genesisParams:  fixed.GenesisParams,
+		slot:           2000,
+		utxos:          map[string]UTxO.UTxO{},
+		spent:          map[string]spend{},
+	}
+}
+
+func utxoKey(txHash string, index int) string {
+	return txHash + "#" + strconv.Itoa(index)
+}
+
+// AddUtxos adds utxos to the ledger, replacing any utxo with the same ref
+func (f *ChainContext) AddUtxos(utxos ...UTxO.UTxO) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, utxo := range utxos {
+		key := utxoKey(hex.EncodeToString(utxo.Input.TransactionId), utxo.Input.Index)
+		if _, ok := f.utxos[key]; !ok {
+			f.order = append(f.order, key)
+		}
+		f.utxos[key] = utxo
+	}
+}
+
+// AllUtxos returns every unspent utxo in insertion order
+func (f *ChainContext) AllUtxos() []UTxO.UTxO {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	utxos := make([]UTxO.UTxO, 0, len(f.order))
+	for _, key := range f.order {
+		utxos = append(utxos, f.utxos[key])
+	}
+	return utxos
+}
+
+func (f *ChainContext) SetProtocolParams(params Base.ProtocolParameters) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.protocolParams = params
+}
+
+func (f *ChainContext) SetLastBlockSlot(slot int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.slot = slot
+}
+
+// Submitted returns the transactions passed to SubmitTx
+func (f *ChainContext) Submitted() []Transaction.Transaction {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Transaction.Transaction{}, f.submitted...)
+}
+
+// SpendingTx returns the submitted transaction that spent txHash#txIndex and
+// the utxos it spent
+func (f *ChainContext) SpendingTx(txHash string, txIndex int) (Transaction.Transaction, []UTxO.UTxO, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.spent[utxoKey(txHash, txIndex)]
+	if !ok {
+		return Transaction.Transaction{}, nil, false
+	}
+	return s.tx, append([]UTxO.UTxO{}, s.inputs...), true
+}
+
+func (f *ChainContext) GetProtocolParams() Base.ProtocolParameters {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.protocolParams
+}
+
+func (f *ChainContext) GetGenesisParams() Base.GenesisParameters {
+	return f.genesisParams
+}
+
+func (f *ChainContext) Network() int {
+	return f.network
+}
+
+func (f *ChainContext) Epoch() int {
+	return 300
+}
+
+func (f *ChainContext) MaxTxFee() int {
+	protocolParams := f.GetProtocolParams()
+	maxTxExSteps, _ := strconv.Atoi(protocolParams.MaxTxExSteps)
+	maxTxExMem, _ := strconv.Atoi(protocolParams.MaxTxExMem)
+	return Base.Fee(f, protocolParams.MaxTxSize, maxTxExSteps, maxTxExMem)
+}
+
+func (f *ChainContext) LastBlockSlot() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.slot
+}
+
+func (f *ChainContext) GetUtxoFromRef(txHash string, txIndex int) *UTxO.UTxO {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	utxo, ok := f.utxos[utxoKey(txHash, txIndex)]
+	if !ok {
+		return nil
+	}
+	return &utxo
+}
+
+func (f *ChainContext) Utxos(address Address.Address) []UTxO.UTxO {
+	utxos := []UTxO.UTxO{}
+	for _, utxo := range f.AllUtxos() {
+		if utxo.Output.GetAddress().String() == address.String() {
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos
+}
+
+func (f *ChainContext) SubmitTx(tx Transaction.Transaction) (serialization.TransactionId, error) {
+	txId, err := tx.TransactionBody.Id()
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+
+	// outputs are stored as a node would decode them, not as the builder holds them
+	outputs := make([]TransactionOutput.TransactionOutput, len(tx.TransactionBody.Outputs))
+	for i, output := range tx.TransactionBody.Outputs {
+		b, err := cbor.Marshal(output)
+		if err != nil {
+			return serialization.TransactionId{}, err
+		}
+		err = cbor.Unmarshal(b, &outputs[i])
+		if err != nil {
+			return serialization.TransactionId{}, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, input := range tx.TransactionBody.Inputs {
+		key := utxoKey(hex.EncodeToString(input.TransactionId), input.Index)
+		if _, ok := f.utxos[key]; !ok {
+			return serialization.TransactionId{}, fmt.Errorf("input %s is not in the utxo set", key)
+		}
+	}
+	s := spend{tx: tx, inputs: make([]UTxO.UTxO, 0, len(tx.TransactionBody.Inputs))}
+	for _, input := range tx.TransactionBody.Inputs {
+		s.inputs = append(s.inputs, f.utxos[utxoKey(hex.EncodeToString(input.TransactionId), input.Index)])
+	}
+	for _, input := range tx.TransactionBody.Inputs {
+		key := utxoKey(hex.EncodeToString(input.TransactionId), input.Index)
+		f.spent[key] = s
+		delete(f.utxos, key)
+		for i, k := range f.order {
+			if k == key {
+				f.order = append(f.order[:i], f.order[i+1:]...)
+				break
+			}
+		}
+	}
+	for i, output := range outputs {
+		key := utxoKey(hex.EncodeToString(txId.Payload), i)
+		f.utxos[key] = UTxO.UTxO{
+			Input: TransactionInput.TransactionInput{
+				TransactionId: txId.Payload,
+				Index:         i,
+			},
+			Output: output,
+		}
+		f.order = append(f.order, key)
+	}
+	f.submitted = append(f.submitted, tx)
+	return txId, nil
+}
+
+// EvaluateTx reports DefaultExUnits for every redeemer of tx
+func (f *ChainContext) EvaluateTx(tx []uint8) map[string]Redeemer.ExecutionUnits {
+	result := map[string]Redeemer.ExecutionUnits{}
+	var transaction Transaction.Transaction
+	if err := cbor.Unmarshal(tx, &transaction); err != nil {
+		return result
+	}
+	for _, redeemer := range transaction.TransactionWitnessSet.Redeemer {
+		key := fmt.Sprintf("%s:%d", Redeemer.RdeemerTagNames[redeemer.Tag], redeemer.Index)
+		result[key] = DefaultExUnits
+	}
+	return result
+}
+
+func (f *ChainContext) GetContractCbor(scriptHash string) string {
+	return ""
+}
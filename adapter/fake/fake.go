@@ -0,0 +1,439 @@
+// Package fake provides an in-memory adapter.Adapter seeded from fixtures, so
+// order flows can be built and tested without a network
+package fake
+
+import (
+	"context"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/apollo/serialization/TransactionInput"
+	"github.com/Newt6611/apollo/serialization/TransactionOutput"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// Utxo is a fixture utxo, either a hex encoded transaction output in Cbor or
+// the fields of Base.Output
+type Utxo struct {
+	TxHash string `json:"tx_hash"`
+	Cbor   string `json:"cbor,omitempty"`
+	Base.Output
+}
+
+func (u Utxo) toUTxO() (UTxO.UTxO, error) {
+	if u.Cbor == "" {
+		return *u.Output.ToUTxO(u.TxHash), nil
+	}
+
+	txHash, err := hex.DecodeString(u.TxHash)
+	if err != nil {
+		return UTxO.UTxO{}, err
+	}
+	txOutCbor, err := hex.DecodeString(u.Cbor)
+	if err != nil {
+		return UTxO.UTxO{}, err
+	}
+	var output TransactionOutput.TransactionOutput
+	err = cbor.Unmarshal(txOutCbor, &output)
+	if err != nil {
+		return UTxO.UTxO{}, err
+	}
+	return UTxO.UTxO{
+		Input: TransactionInput.TransactionInput{
+			TransactionId: txHash,
+			Index:         u.OutputIndex,
+		},
+		Output: output,
+	}, nil
+}
+
+type Fixture struct {
+	// "mainnet" or "testnet"
+	Network string `json:"network"`
+	// Defaults to apollo's FixedChainContext parameters
+	ProtocolParameters *Base.ProtocolParameters `json:"protocol_parameters,omitempty"`
+	Utxos              []Utxo                   `json:"utxos"`
+	// datum cbor by datum hash
+	Datums map[string]string `json:"datums"`
+}
+
+type Adapter struct {
+	network      c.Network
+	chainContext *ChainContext
+
+	mu     sync.Mutex
+	datums map[string]string
+}
+
+// New returns an adapter holding only the V2 deployed script utxos
+func New(network c.Network) *Adapter {
+	// we only need know whether is testnet or mainnet
+	if network != c.MAINNET {
+		network = c.TESTNET
+	}
+	a := &Adapter{
+		network:      network,
+		chainContext: NewChainContext(int(network)),
+		datums:       map[string]string{},
+	}
+	a.addDeployedScripts()
+	return a
+}
+
+// NewFromFixture seeds an adapter with fixture, deployed script utxos missing
+// from the fixture are added without a reference script. A fixture carries the
+// real ones as Cbor outputs, fixtures/testnet.json does not yet
+func NewFromFixture(fixture Fixture) (*Adapter, error) {
+	network := c.TESTNET
+	switch fixture.Network {
+	case "mainnet":
+		network = c.MAINNET
+	case "testnet", "":
+	default:
+		return nil, fmt.Errorf("unknown network %q", fixture.Network)
+	}
+
+	a := &Adapter{
+		network:      network,
+		chainContext: NewChainContext(int(network)),
+		datums:       map[string]string{},
+	}
+	if fixture.ProtocolParameters != nil {
+		a.chainContext.SetProtocolParams(*fixture.ProtocolParameters)
+	}
+	for _, u := range fixture.Utxos {
+		utxo, err := u.toUTxO()
+		if err != nil {
+			return nil, fmt.Errorf("utxo %s#%d: %w", u.TxHash, u.OutputIndex, err)
+		}
+		a.chainContext.AddUtxos(utxo)
+	}
+	for hash, datum := range fixture.Datums {
+		a.AddDatum(hash, datum)
+	}
+	a.addDeployedScripts()
+	return a, nil
+}
+
+// Load reads a JSON Fixture from path
+func Load(path string) (*Adapter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	err = json.Unmarshal(b, &fixture)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromFixture(fixture)
+}
+
+// deployedScriptAddress holds the deployed script utxos, the builders only
+// reference them so their content does not matter
+func deployedScriptAddress(network c.Network) Address.Address {
+	addr := Address.WalletAddressFromBytes(make([]byte, 28), nil, network)
+	addr.AddressType = Address.SCRIPT_NONE
+	addr.HeaderByte = (addr.AddressType << 4) | addr.Network
+	addr.Hrp = Address.ComputeHrp(addr.AddressType, addr.Network)
+	return *addr
+}
+
+func (a *Adapter) addDeployedScripts() {
+	scripts := constants.V2DeployedScripts[a.network]
+	refs := []constants.OutRef{
+		scripts.Order,
+		scripts.Pool,
+		scripts.Factory,
+		scripts.Authen,
+		scripts.PoolBatching,
+		scripts.ExpiredOrderCancellation,
+	}
+	address := deployedScriptAddress(a.network)
+	for _, ref := range refs {
+		if a.chainContext.GetUtxoFromRef(ref.TxHash, ref.Index) != nil {
+			continue
+		}
+		output := Base.Output{
+			Address:     address.String(),
+			Amount:      []Base.AddressAmount{{Unit: "lovelace", Quantity: "20000000"}},
+			OutputIndex: ref.Index,
+		}
+		a.chainContext.AddUtxos(*output.ToUTxO(ref.TxHash))
+	}
+}
+
+// AddUtxos adds utxos to the fake ledger
+func (a *Adapter) AddUtxos(utxos ...UTxO.UTxO) {
+	a.chainContext.AddUtxos(utxos...)
+}
+
+// AddDatum registers the datum cbor returned by GetDatumByDatumHash
+func (a *Adapter) AddDatum(datumHash string, datum string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.datums[strings.ToLower(datumHash)] = datum
+}
+
+// FakeChainContext returns the chain context with its fake-only helpers
+func (a *Adapter) FakeChainContext() *ChainContext {
+	return a.chainContext
+}
+
+func (a *Adapter) NetworkId() c.Network {
+	return a.network
+}
+
+func (a *Adapter) ChainContext() Base.ChainContext {
+	return a.chainContext
+}
+
+func (a *Adapter) NewBuilder() *apollo.Apollo {
+	return apollo.New(a.chainContext)
+}
+
+// datum returns the inline datum of utxo or the datum registered under its hash
+func (a *Adapter) datum(utxo UTxO.UTxO) (*PlutusData.PlutusData, error) {
+	if datum := utxo.Output.GetDatum(); datum != nil {
+		return datum, nil
+	}
+	datumHash := utxo.Output.GetDatumHash()
+	if datumHash == nil || len(datumHash.Payload) == 0 {
+		return nil, nil
+	}
+
+	raw, err := a.GetDatumByDatumHash(context.Background(), hex.EncodeToString(datumHash.Payload))
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	var datum PlutusData.PlutusData
+	err = cbor.Unmarshal(b, &datum)
+	if err != nil {
+		return nil, err
+	}
+	return &datum, nil
+}
+
+func (a *Adapter) poolUtxos() []UTxO.UTxO {
+	authen := constants.V2Config[a.network].PoolAuthenAsset
+	utxos := []UTxO.UTxO{}
+	for _, utxo := range a.chainContext.AllUtxos() {
+		for policy, assets := range utxo.Output.GetValue().GetAssets() {
+			for assetName, quantity := range assets {
+				if policy.Value+assetName.Value == authen && quantity > 0 {
+					utxos = append(utxos, utxo)
+				}
+			}
+		}
+	}
+	return utxos
+}
+
+func (a *Adapter) convertUtxosToPoolState(utxos []UTxO.UTxO) ([]utils.V2PoolState, []error) {
+	poolStates := []utils.V2PoolState{}
+	errs := []error{}
+	for _, utxo := range utxos {
+		datum := utxo.Output.GetDatum()
+		if datum == nil {
+			continue
+		}
+
+		pool, err := utils.ConvertToV2PoolState(*datum)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b, err := cbor.Marshal(datum)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		pool.Datum = hex.EncodeToString(b)
+		pool.OutRef = constants.OutRef{
+			TxHash: hex.EncodeToString(utxo.Input.TransactionId),
+			Index:  utxo.Input.Index,
+		}
+		pool.Address = utxo.Output.GetAddress()
+		pool.Value = utxo.Output.GetValue()
+		poolStates = append(poolStates, pool)
+	}
+	return poolStates, errs
+}
+
+func (a *Adapter) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	return a.convertUtxosToPoolState(a.poolUtxos())
+}
+
+// GetV2Pool pages through the pools in insertion order, From and To are ignored
+func (a *Adapter) GetV2Pool(ctx context.Context, params adapter.QueryParams) ([]utils.V2PoolState, []error) {
+	utxos := a.poolUtxos()
+	if params.Order == "desc" {
+		for i, j := 0, len(utxos)-1; i < j; i, j = i+1, j-1 {
+			utxos[i], utxos[j] = utxos[j], utxos[i]
+		}
+	}
+
+	count := params.Count
+	if count <= 0 {
+		count = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * count
+	if start >= len(utxos) {
+		return []utils.V2PoolState{}, []error{}
+	}
+	end := start + count
+	if end > len(utxos) {
+		end = len(utxos)
+	}
+	return a.convertUtxosToPoolState(utxos[start:end])
+}
+
+func (a *Adapter) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	pools, errs := a.GetV2PoolAll(ctx)
+	if len(errs) != 0 {
+		return utils.V2PoolState{}, errs[0]
+	}
+	return adapter.FindV2PoolByPair(pools, assetA, assetB)
+}
+
+func (a *Adapter) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	datum, ok := a.datums[strings.ToLower(datumHash)]
+	if !ok {
+		return "", errors.New("cannot find datum " + datumHash)
+	}
+	return datum, nil
+}
+
+func (a *Adapter) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	return a.chainContext.GetUtxoFromRef(txhash, index)
+}
+
+func (a *Adapter) GetSpendingTx(ctx context.Context, txhash string, index int) (*adapter.SpendingTx, error) {
+	tx, inputs, ok := a.chainContext.SpendingTx(txhash, index)
+	if !ok {
+		if a.chainContext.GetUtxoFromRef(txhash, index) == nil {
+			return nil, fmt.Errorf("cannot find output %s#%d", txhash, index)
+		}
+		return nil, nil
+	}
+	txId, err := tx.TransactionBody.Id()
+	if err != nil {
+		return nil, err
+	}
+	return &adapter.SpendingTx{TxHash: hex.EncodeToString(txId.Payload), Tx: tx, Inputs: inputs}, nil
+}
+
+func (a *Adapter) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	orderScriptHash := constants.V2Config[a.network].OrderScriptHash
+	utxos := []UTxO.UTxO{}
+	for _, utxo := range a.chainContext.AllUtxos() {
+		if hex.EncodeToString(utxo.Output.GetAddress().PaymentPart) == orderScriptHash {
+			utxos = append(utxos, utxo)
+		}
+	}
+	return utxos, []error{}
+}
+
+func (a *Adapter) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
+	var errs []error
+	var poolStates []utils.StablePoolState
+	for _, cfg := range constants.StableConfig[a.network] {
+		poolAddress, err := Address.DecodeAddress(cfg.PoolAddress)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, utxo := range a.chainContext.Utxos(poolAddress) {
+			datum, err := a.datum(utxo)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if datum == nil {
+				errs = append(errs, errors.New("cannot find datum of stable pool "+cfg.PoolAddress))
+				continue
+			}
+
+			poolState, err := utils.ConvertToStablePoolState(*datum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			poolStates = append(poolStates, poolState)
+		}
+	}
+	return poolStates, errs
+}
+
+func (a *Adapter) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error) {
+	for _, cfg := range constants.StableConfig[a.network] {
+		if cfg.NFTAsset != nft.PolicyId.Value+nft.AssetName.Value {
+			continue
+		}
+		poolAddress, err := Address.DecodeAddress(cfg.PoolAddress)
+		if err != nil {
+			return utils.StablePoolState{}, err
+		}
+
+		for _, utxo := range a.chainContext.Utxos(poolAddress) {
+			if utxo.Output.GetValue().GetAssets().GetByPolicyAndId(nft.PolicyId, nft.AssetName) == 0 {
+				continue
+			}
+			datum, err := a.datum(utxo)
+			if err != nil {
+				return utils.StablePoolState{}, err
+			}
+			if datum == nil {
+				break
+			}
+			return utils.ConvertToStablePoolState(*datum)
+		}
+		return utils.StablePoolState{}, errors.New("cannot find datum of stable pool")
+	}
+
+	return utils.StablePoolState{}, errors.New("cannot find Stable Pool having NFT " + nft.String())
+}
+
+// TestWalletAddress is funded by the Testnet fixture with 110 ADA and 1000 MIN
+const TestWalletAddress = "addr_test1qpssc0r090a9u0pyvdr9y76sm2xzx04n6d4j0y5hukcx6rxz4dtgkhfdynadkea0qezv99wljdl076xkg2krm96nn8jszmh3w7"
+
+//go:embed fixtures/testnet.json
+var testnetFixture []byte
+
+// Testnet returns an adapter seeded with an ADA/MIN V2 pool (reserves 2000 ADA
+// and 500 MIN), one stable pool and utxos for TestWalletAddress
+func Testnet() (*Adapter, error) {
+	var fixture Fixture
+	err := json.Unmarshal(testnetFixture, &fixture)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromFixture(fixture)
+}
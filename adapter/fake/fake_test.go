@@ -0,0 +1,94 @@
+package fake_test
+
+import (
+	"context"
+	"testing"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/adapter/fake"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+var _ adapter.Adapter = (*fake.Adapter)(nil)
+
+func TestTestnetPools(t *testing.T) {
+	a, err := fake.Testnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.NetworkId() != c.TESTNET {
+		t.Errorf("NetworkId expect %d, but get %d\n", c.TESTNET, a.NetworkId())
+	}
+
+	pool, err := a.GetV2PoolByPair(context.Background(), utils.MIN, utils.ADA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 || pool.TotalLiquidity != 1_000_000_000 {
+		t.Errorf("GetV2PoolByPair unexpected pool %+v\n", pool)
+	}
+	if pool.OutRef.TxHash != "a1d7aaf16f1a8385580d7a3045ddc9b1010eab5949d9ccbd23a2760c11ab3b23" || pool.OutRef.Index != 0 {
+		t.Errorf("GetV2PoolByPair unexpected pool OutRef %+v\n", pool.OutRef)
+	}
+	if err := pool.VerifyReserves(); err != nil {
+		t.Error(err)
+	}
+	if pool.ADABuffer() != 0 {
+		t.Errorf("ADABuffer expect 0, but get %d\n", pool.ADABuffer())
+	}
+
+	pools, errs := a.GetAllStablePools(context.Background())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(pools) != 1 || pools[0].TotalLiquidity != 3_000_000 || pools[0].AMP != 10 {
+		t.Errorf("GetAllStablePools unexpected pools %+v\n", pools)
+	}
+}
+
+func TestChainContextSubmitTx(t *testing.T) {
+	a, err := fake.Testnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet, _ := Address.DecodeAddress(fake.TestWalletAddress)
+	before := a.ChainContext().Utxos(wallet)
+	if len(before) != 2 {
+		t.Fatalf("Utxos expect 2, but get %d\n", len(before))
+	}
+
+	builder, err := a.NewBuilder().
+		SetWalletFromBech32(fake.TestWalletAddress).
+		SetWalletAsChangeAddress().
+		AddLoadedUTxOs(before...).
+		PayToAddressBech32(fake.TestWalletAddress, 5_000_000).
+		Complete()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.ChainContext().SubmitTx(*builder.GetTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.ChainContext().SubmitTx(*builder.GetTx())
+	if err == nil {
+		t.Error("SubmitTx expect error on double spend")
+	}
+
+	var total int64
+	for _, utxo := range a.ChainContext().Utxos(wallet) {
+		total += utxo.Output.GetValue().GetCoin()
+	}
+	fee := builder.GetTx().TransactionBody.Fee
+	if total != 110_000_000-fee {
+		t.Errorf("wallet expect %d lovelace, but get %d\n", 110_000_000-fee, total)
+	}
+
+	order := constants.V2DeployedScripts[c.TESTNET].Order
+	if a.GetUtxoFromRef(context.Background(), order.TxHash, order.Index) == nil {
+		t.Error("GetUtxoFromRef expect deployed order script utxo")
+	}
+}
@@ -0,0 +1,617 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const (
+	KoiosMainNet = "https://api.koios.rest/api/v1"
+	KoiosPreProd = "https://preprod.koios.rest/api/v1"
+	KoiosPreview = "https://preview.koios.rest/api/v1"
+)
+
+// koiosPageSize is the largest page Koios serves
+const koiosPageSize = 1000
+
+// koiosClient queries the Koios REST API
+type koiosClient struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// koiosPage selects a slice of a Koios result, a zero Limit fetches every row
+type koiosPage struct {
+	Offset int
+	Limit  int
+	Order  string
+}
+
+type koiosAsset struct {
+	PolicyId  string `json:"policy_id"`
+	AssetName string `json:"asset_name"`
+	Quantity  string `json:"quantity"`
+}
+
+type koiosUtxo struct {
+	TxHash      string  `json:"tx_hash"`
+	TxIndex     int     `json:"tx_index"`
+	Address     string  `json:"address"`
+	Value       string  `json:"value"`
+	DatumHash   *string `json:"datum_hash"`
+	InlineDatum *struct {
+		Bytes string `json:"bytes"`
+	} `json:"inline_datum"`
+	AssetList   []koiosAsset `json:"asset_list"`
+	BlockHeight int          `json:"block_height"`
+	IsSpent     bool         `json:"is_spent"`
+}
+
+func (u koiosUtxo) toUTxO() *UTxO.UTxO {
+	amounts := []Base.AddressAmount{
+		{
+			Unit:     "lovelace",
+			Quantity: u.Value,
+		},
+	}
+	for _, asset := range u.AssetList {
+		amounts = append(amounts, Base.AddressAmount{
+			Unit:     asset.PolicyId + asset.AssetName,
+			Quantity: asset.Quantity,
+		})
+	}
+
+	output := Base.Output{
+		Address:     u.Address,
+		Amount:      amounts,
+		OutputIndex: u.TxIndex,
+	}
+	if u.InlineDatum != nil {
+		output.InlineDatum = u.InlineDatum.Bytes
+	} else if u.DatumHash != nil {
+		output.DataHash = *u.DatumHash
+	}
+	return output.ToUTxO(u.TxHash)
+}
+
+func (k *koiosClient) post(ctx context.Context, path string, page koiosPage, body any, result any) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(k.endpoint, "/") + path
+	query := []string{}
+	if page.Limit > 0 {
+		query = append(query, "offset="+strconv.Itoa(page.Offset), "limit="+strconv.Itoa(page.Limit))
+	}
+	if page.Order != "" {
+		query = append(query, "order=block_height."+page.Order)
+	}
+	if len(query) != 0 {
+		u += "?" + strings.Join(query, "&")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("koios %s: status %d: %s", path, resp.StatusCode, string(respBody))
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// collect fetches every page of a Koios result when page.Limit is zero
+func collect[T any](ctx context.Context, page koiosPage, fetch func(koiosPage) ([]T, error)) ([]T, error) {
+	if page.Limit > 0 {
+		return fetch(page)
+	}
+
+	rows := []T{}
+	page.Limit = koiosPageSize
+	for {
+		if err := ctx.Err(); err != nil {
+			return rows, err
+		}
+		result, err := fetch(page)
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, result...)
+		if len(result) < page.Limit {
+			return rows, nil
+		}
+		page.Offset += page.Limit
+	}
+}
+
+func (k *koiosClient) addressUtxos(ctx context.Context, address string, page koiosPage) ([]koiosUtxo, error) {
+	body := map[string]any{
+		"_addresses": []string{address},
+		"_extended":  true,
+	}
+	return collect(ctx, page, func(p koiosPage) ([]koiosUtxo, error) {
+		var utxos []koiosUtxo
+		err := k.post(ctx, "/address_utxos", p, body, &utxos)
+		return utxos, err
+	})
+}
+
+// assetUtxos returns the unspent outputs holding asset (policy id + asset name)
+func (k *koiosClient) assetUtxos(ctx context.Context, asset string, page koiosPage) ([]koiosUtxo, error) {
+	body := map[string]any{
+		"_asset_list": [][]string{{asset[:56], asset[56:]}},
+		"_extended":   true,
+	}
+	utxos, err := collect(ctx, page, func(p koiosPage) ([]koiosUtxo, error) {
+		var utxos []koiosUtxo
+		err := k.post(ctx, "/asset_utxos", p, body, &utxos)
+		return utxos, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	unspent := []koiosUtxo{}
+	for _, utxo := range utxos {
+		if !utxo.IsSpent {
+			unspent = append(unspent, utxo)
+		}
+	}
+	return unspent, nil
+}
+
+// credentialUtxos returns the unspent outputs paying to a payment credential
+func (k *koiosClient) credentialUtxos(ctx context.Context, credential string, page koiosPage) ([]koiosUtxo, error) {
+	body := map[string]any{
+		"_payment_credentials": []string{credential},
+		"_extended":            true,
+	}
+	return collect(ctx, page, func(p koiosPage) ([]koiosUtxo, error) {
+		var utxos []koiosUtxo
+		err := k.post(ctx, "/credential_utxos", p, body, &utxos)
+		return utxos, err
+	})
+}
+
+func (k *koiosClient) utxo(ctx context.Context, txHash string, txIndex int) (*koiosUtxo, error) {
+	body := map[string]any{
+		"_utxo_refs": []string{fmt.Sprintf("%s#%d", txHash, txIndex)},
+		"_extended":  true,
+	}
+	var utxos []koiosUtxo
+	err := k.post(ctx, "/utxo_info", koiosPage{}, body, &utxos)
+	if err != nil {
+		return nil, err
+	}
+	if len(utxos) == 0 {
+		return nil, nil
+	}
+	return &utxos[0], nil
+}
+
+// koiosTxInput is an input of /tx_info, it carries the address apart from the
+// fields of koiosUtxo
+type koiosTxInput struct {
+	koiosUtxo
+	PaymentAddr struct {
+		Bech32 string `json:"bech32"`
+	} `json:"payment_addr"`
+}
+
+// spender returns the hash and inputs of the transaction that spent
+// txHash#txIndex, Koios does not index spenders so the transactions of address
+// after blockHeight are searched
+func (k *koiosClient) spender(ctx context.Context, txHash string, txIndex int, address string, blockHeight int) (string, []koiosUtxo, error) {
+	body := map[string]any{
+		"_addresses":          []string{address},
+		"_after_block_height": blockHeight,
+	}
+	txs, err := collect(ctx, koiosPage{}, func(p koiosPage) ([]struct {
+		TxHash string `json:"tx_hash"`
+	}, error) {
+		var txs []struct {
+			TxHash string `json:"tx_hash"`
+		}
+		err := k.post(ctx, "/address_txs", p, body, &txs)
+		return txs, err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, tx := range txs {
+		if tx.TxHash == txHash {
+			continue
+		}
+		var infos []struct {
+			TxHash string         `json:"tx_hash"`
+			Inputs []koiosTxInput `json:"inputs"`
+		}
+		err := k.post(ctx, "/tx_info", koiosPage{}, map[string]any{
+			"_tx_hashes": []string{tx.TxHash},
+			"_inputs":    true,
+		}, &infos)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, info := range infos {
+			inputs := make([]koiosUtxo, 0, len(info.Inputs))
+			spent := false
+			for _, input := range info.Inputs {
+				input.koiosUtxo.Address = input.PaymentAddr.Bech32
+				inputs = append(inputs, input.koiosUtxo)
+				spent = spent || (input.TxHash == txHash && input.TxIndex == txIndex)
+			}
+			if spent {
+				return info.TxHash, inputs, nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("cannot find the transaction spending %s#%d", txHash, txIndex)
+}
+
+func (k *koiosClient) txCbor(ctx context.Context, txHash string) (string, error) {
+	body := map[string]any{
+		"_tx_hashes": []string{txHash},
+	}
+	var txs []struct {
+		TxHash string `json:"tx_hash"`
+		Cbor   string `json:"cbor"`
+	}
+	err := k.post(ctx, "/tx_cbor", koiosPage{}, body, &txs)
+	if err != nil {
+		return "", err
+	}
+	if len(txs) == 0 {
+		return "", errors.New("cannot find transaction " + txHash)
+	}
+	return txs[0].Cbor, nil
+}
+
+func (k *koiosClient) datum(ctx context.Context, datumHash string) (string, error) {
+	body := map[string]any{
+		"_datum_hashes": []string{datumHash},
+	}
+	var datums []struct {
+		DatumHash string `json:"datum_hash"`
+		Bytes     string `json:"bytes"`
+	}
+	err := k.post(ctx, "/datum_info", koiosPage{}, body, &datums)
+	if err != nil {
+		return "", err
+	}
+	if len(datums) == 0 {
+		return "", errors.New("cannot find datum " + datumHash)
+	}
+	return datums[0].Bytes, nil
+}
+
+func (k *koiosClient) script(ctx context.Context, scriptHash string) (string, error) {
+	body := map[string]any{
+		"_script_hashes": []string{scriptHash},
+	}
+	var scripts []struct {
+		ScriptHash string `json:"script_hash"`
+		Bytes      string `json:"bytes"`
+	}
+	err := k.post(ctx, "/script_info", koiosPage{}, body, &scripts)
+	if err != nil {
+		return "", err
+	}
+	if len(scripts) == 0 {
+		return "", errors.New("cannot find script " + scriptHash)
+	}
+	return scripts[0].Bytes, nil
+}
+
+type KoiosOptions struct {
+	// KoiosMainNet, KoiosPreProd or KoiosPreview, defaults to KoiosMainNet
+	Server string
+	// Optional bearer token from koios.rest
+	Token string
+	// Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type Koios struct {
+	koios        *koiosClient
+	network      c.Network
+	chainContext *KoiosChainContext
+}
+
+func NewKoios(options KoiosOptions) (*Koios, error) {
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if options.Server == "" {
+		options.Server = KoiosMainNet
+	}
+
+	// tmpNetwork decied by server(used only by the chain context)
+	tmpNetwork := c.TESTNET
+	switch options.Server {
+	case KoiosMainNet:
+		tmpNetwork = c.MAINNET
+	case KoiosPreProd:
+		tmpNetwork = c.PREPROD
+	case KoiosPreview:
+		tmpNetwork = c.PREVIEW
+	}
+	// we only need know whether is testnet or mainnet
+	network := normalizeNetwork(tmpNetwork)
+
+	koios := &koiosClient{endpoint: options.Server, token: options.Token, client: httpClient}
+	ogmios := &ogmiosClient{endpoint: strings.TrimSuffix(options.Server, "/") + "/ogmios", client: httpClient}
+	if options.Token != "" {
+		ogmios.client = &http.Client{
+			Transport: &bearerTransport{token: options.Token, next: httpClient.Transport},
+			Timeout:   httpClient.Timeout,
+		}
+	}
+
+	return &Koios{
+		koios:   koios,
+		network: network,
+		chainContext: &KoiosChainContext{
+			OgmiosChainContext: &OgmiosChainContext{
+				ogmios:  ogmios,
+				network: int(tmpNetwork),
+			},
+			koios: koios,
+		},
+	}, nil
+}
+
+// bearerTransport adds the Koios token to the requests sent to its Ogmios proxy
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (b *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := b.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return next.RoundTrip(req)
+}
+
+func (k *Koios) NetworkId() c.Network {
+	return k.network
+}
+
+func (k *Koios) ChainContext() Base.ChainContext {
+	return k.chainContext
+}
+
+func (k *Koios) NewBuilder() *apollo.Apollo {
+	return apollo.New(k.chainContext)
+}
+
+func convertKoiosUtxosToPoolState(utxos []koiosUtxo, errs []error) ([]utils.V2PoolState, []error) {
+	poolStates := []utils.V2PoolState{}
+	for _, utxo := range utxos {
+		if utxo.InlineDatum == nil {
+			continue
+		}
+
+		pool, err := decodeV2PoolState(utxo.InlineDatum.Bytes)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		poolStates = append(poolStates, withPoolUtxo(pool, utxo.toUTxO()))
+	}
+
+	return poolStates, errs
+}
+
+func (k *Koios) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	asset := constants.V2Config[k.network].PoolAuthenAsset
+	utxos, err := k.koios.assetUtxos(ctx, asset, koiosPage{})
+	if err != nil {
+		return nil, []error{err}
+	}
+	return convertKoiosUtxosToPoolState(utxos, []error{})
+}
+
+// GetV2Pool maps Count and Page onto Koios' limit and offset, From and To are not supported
+func (k *Koios) GetV2Pool(ctx context.Context, params QueryParams) ([]utils.V2PoolState, []error) {
+	count := params.Count
+	if count <= 0 || count > koiosPageSize {
+		count = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	order := ""
+	if params.Order == "asc" || params.Order == "desc" {
+		order = params.Order
+	}
+
+	asset := constants.V2Config[k.network].PoolAuthenAsset
+	utxos, err := k.koios.assetUtxos(ctx, asset, koiosPage{
+		Offset: (page - 1) * count,
+		Limit:  count,
+		Order:  order,
+	})
+	if err != nil {
+		return nil, []error{err}
+	}
+	return convertKoiosUtxosToPoolState(utxos, []error{})
+}
+
+func (k *Koios) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	pools, errs := k.GetV2PoolAll(ctx)
+	if len(errs) != 0 {
+		return utils.V2PoolState{}, errs[0]
+	}
+
+	return FindV2PoolByPair(pools, assetA, assetB)
+}
+
+func (k *Koios) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	return k.koios.datum(ctx, datumHash)
+}
+
+func (k *Koios) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	utxo, err := k.chainContext.getUtxoFromRef(ctx, txhash, index)
+	if err != nil {
+		return nil
+	}
+	return utxo
+}
+
+func (k *Koios) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	utxos, err := k.koios.credentialUtxos(ctx, constants.V2Config[k.network].OrderScriptHash, koiosPage{})
+	if err != nil {
+		return nil, []error{err}
+	}
+	orderUtxos := make([]UTxO.UTxO, 0, len(utxos))
+	for _, utxo := range utxos {
+		orderUtxos = append(orderUtxos, *utxo.toUTxO())
+	}
+	return orderUtxos, []error{}
+}
+
+// GetSpendingTx looks up the spender with utxo_info, then among the
+// transactions of the output address, see koiosClient.spender
+func (k *Koios) GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error) {
+	created, err := k.koios.utxo(ctx, txhash, index)
+	if err != nil {
+		return nil, err
+	}
+	if created == nil {
+		return nil, fmt.Errorf("cannot find output %s#%d", txhash, index)
+	}
+	if !created.IsSpent {
+		return nil, nil
+	}
+
+	spender, koiosInputs, err := k.koios.spender(ctx, txhash, index, created.Address, created.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+	txCbor, err := k.koios.txCbor(ctx, spender)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeTx(txCbor)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]UTxO.UTxO, 0, len(koiosInputs))
+	for _, input := range koiosInputs {
+		inputs = append(inputs, *input.toUTxO())
+	}
+	return &SpendingTx{TxHash: spender, Tx: tx, Inputs: inputs}, nil
+}
+
+// stablePoolDatum finds the datum of a stable pool utxo from its inline datum or datum hash
+func (k *Koios) stablePoolDatum(ctx context.Context, utxo koiosUtxo) (string, error) {
+	if utxo.InlineDatum != nil {
+		return utxo.InlineDatum.Bytes, nil
+	}
+	if utxo.DatumHash != nil {
+		return k.koios.datum(ctx, *utxo.DatumHash)
+	}
+	return "", errors.New("cannot find datum of stable pool " + utxo.Address)
+}
+
+func (k *Koios) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
+	var errs []error
+	var poolStates []utils.StablePoolState
+	for _, cfg := range constants.StableConfig[k.network] {
+		utxos, err := k.koios.addressUtxos(ctx, cfg.PoolAddress, koiosPage{})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, utxo := range utxos {
+			datum, err := k.stablePoolDatum(ctx, utxo)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			poolState, err := decodeStablePoolState(datum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			poolStates = append(poolStates, poolState)
+		}
+	}
+
+	return poolStates, errs
+}
+
+func (k *Koios) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error) {
+	var poolAddress string
+	var asset string
+	for _, cfg := range constants.StableConfig[k.network] {
+		if cfg.NFTAsset == nft.PolicyId.Value+nft.AssetName.Value {
+			poolAddress = cfg.PoolAddress
+			asset = cfg.NFTAsset
+		}
+	}
+
+	if poolAddress == "" {
+		return utils.StablePoolState{}, errors.New("cannot find Stable Pool having NFT " + nft.String())
+	}
+
+	utxos, err := k.koios.assetUtxos(ctx, asset, koiosPage{})
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	for _, utxo := range utxos {
+		if utxo.Address != poolAddress {
+			continue
+		}
+		datum, err := k.stablePoolDatum(ctx, utxo)
+		if err != nil {
+			return utils.StablePoolState{}, err
+		}
+		return decodeStablePoolState(datum)
+	}
+
+	return utils.StablePoolState{}, errors.New("cannot find datum of stable pool")
+}
@@ -0,0 +1,54 @@
+package adapter
+
+import (
+	"context"
+
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+)
+
+// KoiosChainContext is an apollo Base.ChainContext backed by Koios. Ledger
+// queries, evaluation and submission go through the Ogmios proxy Koios serves
+// at /ogmios, utxos and scripts come from the Koios REST endpoints
+type KoiosChainContext struct {
+	*OgmiosChainContext
+	koios *koiosClient
+}
+
+func (k *KoiosChainContext) Utxos(address Address.Address) []UTxO.UTxO {
+	ctx := context.Background()
+	koiosUtxos, err := k.koios.addressUtxos(ctx, address.String(), koiosPage{})
+	if err != nil {
+		return []UTxO.UTxO{}
+	}
+
+	utxos := []UTxO.UTxO{}
+	for _, koiosUtxo := range koiosUtxos {
+		utxos = append(utxos, *koiosUtxo.toUTxO())
+	}
+	return utxos
+}
+
+func (k *KoiosChainContext) GetUtxoFromRef(txHash string, txIndex int) *UTxO.UTxO {
+	utxo, err := k.getUtxoFromRef(context.Background(), txHash, txIndex)
+	if err != nil {
+		return nil
+	}
+	return utxo
+}
+
+func (k *KoiosChainContext) getUtxoFromRef(ctx context.Context, txHash string, txIndex int) (*UTxO.UTxO, error) {
+	koiosUtxo, err := k.koios.utxo(ctx, txHash, txIndex)
+	if err != nil || koiosUtxo == nil {
+		return nil, err
+	}
+	return koiosUtxo.toUTxO(), nil
+}
+
+func (k *KoiosChainContext) GetContractCbor(scriptHash string) string {
+	script, err := k.koios.script(context.Background(), scriptHash)
+	if err != nil {
+		return ""
+	}
+	return script
+}
@@ -0,0 +1,160 @@
+package adapter_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const koiosFixtures = "testdata/koios"
+
+// newKoiosStandIn serves recorded Koios responses, rows past the first page are empty
+func newKoiosStandIn(t *testing.T) *adapter.Koios {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer koios-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/") + ".json"
+		if r.URL.Path == "/ogmios" {
+			var req struct {
+				Method string `json:"method"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			name = "ogmios_" + strings.ReplaceAll(req.Method, "/", "_") + ".json"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if offset := r.URL.Query().Get("offset"); offset != "" && offset != "0" {
+			w.Write([]byte("[]"))
+			return
+		}
+		b, err := os.ReadFile(filepath.Join(koiosFixtures, name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(b)
+	}))
+	t.Cleanup(server.Close)
+
+	koios, err := adapter.NewKoios(adapter.KoiosOptions{
+		Server: server.URL,
+		Token:  "koios-token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return koios
+}
+
+func TestKoiosGetV2PoolByPair(t *testing.T) {
+	koios := newKoiosStandIn(t)
+	if koios.NetworkId() != c.TESTNET {
+		t.Errorf("NetworkId expect %d, but get %d\n", c.TESTNET, koios.NetworkId())
+	}
+
+	pool, err := koios.GetV2PoolByPair(context.Background(), utils.MIN, utils.ADA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 || pool.TotalLiquidity != 1_000_000_000 {
+		t.Errorf("GetV2PoolByPair unexpected pool %+v\n", pool)
+	}
+	checkPoolUtxo(t, pool)
+
+	pools, errs := koios.GetV2Pool(context.Background(), adapter.QueryParams{Count: 1, Page: 2})
+	if len(errs) != 0 || len(pools) != 0 {
+		t.Errorf("GetV2Pool expect empty second page, but get %d pools, errs %v\n", len(pools), errs)
+	}
+}
+
+func TestKoiosGetAllStablePools(t *testing.T) {
+	koios := newKoiosStandIn(t)
+
+	pools, errs := koios.GetAllStablePools(context.Background())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(pools) != len(constants.StableConfig[c.TESTNET]) {
+		t.Fatalf("GetAllStablePools expect %d pools, but get %d\n", len(constants.StableConfig[c.TESTNET]), len(pools))
+	}
+	if pools[0].TotalLiquidity != 3_000_000 || pools[0].AMP != 10 {
+		t.Errorf("GetAllStablePools unexpected pool %+v\n", pools[0])
+	}
+}
+
+func TestKoiosGetUtxoFromRef(t *testing.T) {
+	koios := newKoiosStandIn(t)
+	ref := constants.V2DeployedScripts[c.TESTNET].Order
+
+	utxo := koios.GetUtxoFromRef(context.Background(), ref.TxHash, ref.Index)
+	if utxo == nil {
+		t.Fatal("GetUtxoFromRef expect utxo")
+	}
+	if hex.EncodeToString(utxo.Input.TransactionId) != ref.TxHash {
+		t.Errorf("GetUtxoFromRef expect %s, but get %s\n", ref.TxHash, hex.EncodeToString(utxo.Input.TransactionId))
+	}
+	if utxo.Output.GetValue().GetCoin() != 31209570 {
+		t.Errorf("GetUtxoFromRef expect 31209570 lovelace, but get %d\n", utxo.Output.GetValue().GetCoin())
+	}
+}
+
+func TestKoiosChainContext(t *testing.T) {
+	params := newKoiosStandIn(t).ChainContext().GetProtocolParams()
+	if params.MinFeeCoefficient != 44 || params.MinFeeConstant != 155381 || params.CoinsPerUtxoByte != "4310" {
+		t.Errorf("GetProtocolParams unexpected params %+v\n", params)
+	}
+}
+
+func TestKoiosGetV2OrderUtxos(t *testing.T) {
+	koios := newKoiosStandIn(t)
+
+	utxos, errs := koios.GetV2OrderUtxos(context.Background())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(utxos) != 1 {
+		t.Fatalf("GetV2OrderUtxos expect 1 utxo, but get %d\n", len(utxos))
+	}
+	addr := utxos[0].Output.GetAddress()
+	if hex.EncodeToString(addr.PaymentPart) != constants.V2Config[c.TESTNET].OrderScriptHash {
+		t.Errorf("GetV2OrderUtxos expect the order script, but get %s\n", addr.String())
+	}
+	datumHash := utxos[0].Output.GetDatumHash()
+	if datumHash == nil || hex.EncodeToString(datumHash.Payload) != "9e1199a988ba72ffd6e9c269cadb3b53b5f360ff99f112d9b2ee30c4d74ad88b" {
+		t.Errorf("GetV2OrderUtxos expect the datum hash, but get %v\n", datumHash)
+	}
+	if utxos[0].Output.GetValue().GetCoin() != 14_000_000 {
+		t.Errorf("GetV2OrderUtxos expect 14000000 lovelace, but get %d\n", utxos[0].Output.GetValue().GetCoin())
+	}
+}
+
+func TestKoiosGetSpendingTxUnspent(t *testing.T) {
+	koios := newKoiosStandIn(t)
+	ref := constants.V2DeployedScripts[c.TESTNET].Order
+
+	spending, err := koios.GetSpendingTx(context.Background(), ref.TxHash, ref.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spending != nil {
+		t.Errorf("GetSpendingTx expect nil for an unspent output, but get %v\n", spending)
+	}
+}
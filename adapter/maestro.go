@@ -0,0 +1,469 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+	"github.com/maestro-org/go-sdk/client"
+	"github.com/maestro-org/go-sdk/models"
+	maestroUtils "github.com/maestro-org/go-sdk/utils"
+)
+
+// maestroPageSize is the largest page Maestro serves
+const maestroPageSize = 100
+
+var maestroNetworks = map[c.Network]string{
+	c.MAINNET: "mainnet",
+	c.PREPROD: "preprod",
+	c.PREVIEW: "preview",
+}
+
+type MaestroOptions struct {
+	ProjectID string
+	// MAINNET, PREPROD or PREVIEW
+	Network c.Network
+	// Defaults to https://<network>.gomaestro-api.org/v1
+	Endpoint string
+	// Defaults to the maestro sdk client
+	HTTPClient *http.Client
+}
+
+type Maestro struct {
+	client       *client.Client
+	network      c.Network
+	chainContext *MaestroChainContext
+}
+
+func NewMaestro(options MaestroOptions) (*Maestro, error) {
+	networkName, ok := maestroNetworks[options.Network]
+	if !ok {
+		return nil, fmt.Errorf("maestro does not support network %d", options.Network)
+	}
+
+	maestroClient := client.NewClient(options.ProjectID, networkName)
+	if options.Endpoint != "" {
+		maestroClient.BaseUrl = strings.TrimSuffix(options.Endpoint, "/")
+	}
+	if options.HTTPClient != nil {
+		maestroClient.HTTPClient = options.HTTPClient
+	}
+	// we only need know whether is testnet or mainnet
+	network := normalizeNetwork(options.Network)
+
+	return &Maestro{
+		client:  maestroClient,
+		network: network,
+		chainContext: &MaestroChainContext{
+			client:    maestroClient,
+			projectId: options.ProjectID,
+			network:   int(network),
+		},
+	}, nil
+}
+
+func (m *Maestro) NetworkId() c.Network {
+	return m.network
+}
+
+func (m *Maestro) ChainContext() Base.ChainContext {
+	return m.chainContext
+}
+
+func (m *Maestro) NewBuilder() *apollo.Apollo {
+	return apollo.New(m.chainContext)
+}
+
+// assetUtxos returns one page of the utxo references holding asset
+func (m *Maestro) assetUtxos(asset string, count int, cursor string) (*models.AssetUtxos, error) {
+	params := maestroUtils.NewParameters()
+	params.Count(count)
+	if cursor != "" {
+		params.Cursor(cursor)
+	}
+	return m.client.AssetUtxos(asset, params)
+}
+
+// resolveOutputs fetches the outputs of refs together with their datums
+func (m *Maestro) resolveOutputs(refs []models.AssetUtxo) ([]models.Utxo, error) {
+	if len(refs) == 0 {
+		return []models.Utxo{}, nil
+	}
+	references := make([]models.TxoReference, 0, len(refs))
+	for _, ref := range refs {
+		references = append(references, models.TxoReference{
+			TxHash: ref.TxHash,
+			Index:  int(ref.Index),
+		})
+	}
+
+	params := maestroUtils.NewParameters()
+	params.ResolveDatums()
+	resp, err := m.client.TransactionOutputsFromReferences(references, params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func convertMaestroUtxosToPoolState(utxos []models.Utxo, errs []error) ([]utils.V2PoolState, []error) {
+	poolStates := []utils.V2PoolState{}
+	for _, utxo := range utxos {
+		datum, err := parseMaestroDatum(utxo.Datum)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if datum.Type != "inline" || datum.Bytes == "" {
+			continue
+		}
+
+		pool, err := decodeV2PoolState(datum.Bytes)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		amounts := make([]Base.AddressAmount, 0, len(utxo.Assets))
+		for _, asset := range utxo.Assets {
+			amounts = append(amounts, Base.AddressAmount{Unit: asset.Unit, Quantity: strconv.FormatInt(asset.Amount, 10)})
+		}
+		output := Base.Output{
+			Address:     utxo.Address,
+			Amount:      amounts,
+			OutputIndex: int(utxo.Index),
+		}
+		poolStates = append(poolStates, withPoolUtxo(pool, output.ToUTxO(utxo.TxHash)))
+	}
+
+	return poolStates, errs
+}
+
+func (m *Maestro) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	asset := constants.V2Config[m.network].PoolAuthenAsset
+
+	poolStates := []utils.V2PoolState{}
+	errs := []error{}
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return poolStates, append(errs, err)
+		}
+
+		page, err := m.assetUtxos(asset, maestroPageSize, cursor)
+		if err != nil {
+			return poolStates, append(errs, err)
+		}
+		utxos, err := m.resolveOutputs(page.Data)
+		if err != nil {
+			return poolStates, append(errs, err)
+		}
+
+		pools, es := convertMaestroUtxosToPoolState(utxos, nil)
+		poolStates = append(poolStates, pools...)
+		errs = append(errs, es...)
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	return poolStates, errs
+}
+
+// GetV2Pool walks Maestro's cursors up to params.Page, Order, From and To are not
+// supported by the Maestro asset utxos endpoint
+func (m *Maestro) GetV2Pool(ctx context.Context, params QueryParams) ([]utils.V2PoolState, []error) {
+	asset := constants.V2Config[m.network].PoolAuthenAsset
+	count := params.Count
+	if count <= 0 || count > maestroPageSize {
+		count = maestroPageSize
+	}
+	pageNumber := params.Page
+	if pageNumber <= 0 {
+		pageNumber = 1
+	}
+
+	var page *models.AssetUtxos
+	cursor := ""
+	for i := 1; i <= pageNumber; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, []error{err}
+		}
+
+		var err error
+		page, err = m.assetUtxos(asset, count, cursor)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if page.NextCursor == "" && i < pageNumber {
+			return []utils.V2PoolState{}, []error{}
+		}
+		cursor = page.NextCursor
+	}
+
+	utxos, err := m.resolveOutputs(page.Data)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return convertMaestroUtxosToPoolState(utxos, []error{})
+}
+
+func (m *Maestro) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	pools, errs := m.GetV2PoolAll(ctx)
+	if len(errs) != 0 {
+		return utils.V2PoolState{}, errs[0]
+	}
+
+	return FindV2PoolByPair(pools, assetA, assetB)
+}
+
+func (m *Maestro) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	resp, err := m.client.DatumFromHash(datumHash)
+	if err != nil {
+		return "", err
+	}
+	if resp.Data.Bytes == "" {
+		return "", errors.New("cannot find datum " + datumHash)
+	}
+	return resp.Data.Bytes, nil
+}
+
+func (m *Maestro) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	return m.chainContext.GetUtxoFromRef(txhash, index)
+}
+
+func (m *Maestro) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	credential := constants.V2Config[m.network].OrderScriptHashBech32
+
+	orderUtxos := []UTxO.UTxO{}
+	errs := []error{}
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return orderUtxos, append(errs, err)
+		}
+
+		params := maestroUtils.NewParameters()
+		params.WithCbor()
+		params.Count(maestroPageSize)
+		if cursor != "" {
+			params.Cursor(cursor)
+		}
+		resp, err := m.client.UtxosByPaymentCredential(credential, params)
+		if err != nil {
+			return orderUtxos, append(errs, err)
+		}
+		for _, maestroUtxo := range resp.Data {
+			utxo, err := maestroUtxoToUTxO(maestroUtxo)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			orderUtxos = append(orderUtxos, *utxo)
+		}
+
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	return orderUtxos, errs
+}
+
+// GetSpendingTx walks the transactions of the output address from the slot it
+// was created, Maestro does not index spenders. The output is unspent when none
+// of them consumes it
+func (m *Maestro) GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error) {
+	created, err := m.client.TransactionDetails(txhash)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(created.Data.Outputs) {
+		return nil, fmt.Errorf("cannot find output %s#%d", txhash, index)
+	}
+	address := created.Data.Outputs[index].Address
+
+	cursor := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		params := maestroUtils.NewParameters()
+		params.From(created.Data.BlockAbsoluteSlot)
+		params.SetAscOrder()
+		params.Count(maestroPageSize)
+		if cursor != "" {
+			params.Cursor(cursor)
+		}
+		resp, err := m.client.AddressTransactions(address, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range resp.Data {
+			if !tx.Input || tx.TxHash == txhash {
+				continue
+			}
+			details, err := m.client.TransactionDetails(tx.TxHash)
+			if err != nil {
+				return nil, err
+			}
+			spent := slices.ContainsFunc(details.Data.Inputs, func(input models.Utxo) bool {
+				return input.TxHash == txhash && int(input.Index) == index
+			})
+			if spent {
+				return m.spendingTx(details.Data)
+			}
+		}
+
+		if resp.NextCursor == "" {
+			return nil, nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+func (m *Maestro) spendingTx(details models.TransactionDetail) (*SpendingTx, error) {
+	references := make([]models.TxoReference, 0, len(details.Inputs))
+	for _, input := range details.Inputs {
+		references = append(references, models.TxoReference{
+			TxHash: input.TxHash,
+			Index:  int(input.Index),
+		})
+	}
+	params := maestroUtils.NewParameters()
+	params.WithCbor()
+	resp, err := m.client.TransactionOutputsFromReferences(references, params)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]UTxO.UTxO, 0, len(resp.Data))
+	for _, maestroUtxo := range resp.Data {
+		utxo, err := maestroUtxoToUTxO(maestroUtxo)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, *utxo)
+	}
+
+	txCbor, err := m.client.TransactionCbor(details.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := decodeTx(txCbor.Data)
+	if err != nil {
+		return nil, err
+	}
+	return &SpendingTx{TxHash: details.TxHash, Tx: tx, Inputs: inputs}, nil
+}
+
+// stablePoolDatum finds the datum of a stable pool utxo from its inline datum or datum hash
+func (m *Maestro) stablePoolDatum(ctx context.Context, utxo models.Utxo) (string, error) {
+	datum, err := parseMaestroDatum(utxo.Datum)
+	if err != nil {
+		return "", err
+	}
+	if datum.Bytes != "" {
+		return datum.Bytes, nil
+	}
+	if datum.Hash != "" {
+		return m.GetDatumByDatumHash(ctx, datum.Hash)
+	}
+	return "", errors.New("cannot find datum of stable pool " + utxo.Address)
+}
+
+func (m *Maestro) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
+	var errs []error
+	var poolStates []utils.StablePoolState
+	for _, cfg := range constants.StableConfig[m.network] {
+		cursor := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				return poolStates, append(errs, err)
+			}
+
+			params := maestroUtils.NewParameters()
+			params.ResolveDatums()
+			if cursor != "" {
+				params.Cursor(cursor)
+			}
+			resp, err := m.client.UtxosAtAddress(cfg.PoolAddress, params)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+
+			for _, utxo := range resp.Data {
+				datum, err := m.stablePoolDatum(ctx, utxo)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+
+				poolState, err := decodeStablePoolState(datum)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				poolStates = append(poolStates, poolState)
+			}
+
+			if resp.NextCursor == "" {
+				break
+			}
+			cursor = resp.NextCursor
+		}
+	}
+
+	return poolStates, errs
+}
+
+func (m *Maestro) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error) {
+	var poolAddress string
+	var asset string
+	for _, cfg := range constants.StableConfig[m.network] {
+		if cfg.NFTAsset == nft.PolicyId.Value+nft.AssetName.Value {
+			poolAddress = cfg.PoolAddress
+			asset = cfg.NFTAsset
+		}
+	}
+
+	if poolAddress == "" {
+		return utils.StablePoolState{}, errors.New("cannot find Stable Pool having NFT " + nft.String())
+	}
+
+	page, err := m.assetUtxos(asset, maestroPageSize, "")
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	refs := []models.AssetUtxo{}
+	for _, ref := range page.Data {
+		if ref.Address == poolAddress {
+			refs = append(refs, ref)
+		}
+	}
+	utxos, err := m.resolveOutputs(refs)
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	if len(utxos) == 0 {
+		return utils.StablePoolState{}, errors.New("cannot find datum of stable pool")
+	}
+
+	datum, err := m.stablePoolDatum(ctx, utxos[0])
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	return decodeStablePoolState(datum)
+}
@@ -0,0 +1,294 @@
+package adapter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Newt6611/apollo/serialization"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/TransactionInput"
+	"github.com/Newt6611/apollo/serialization/TransactionOutput"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Salvionied/cbor/v2"
+	"github.com/maestro-org/go-sdk/client"
+	"github.com/maestro-org/go-sdk/models"
+	maestroUtils "github.com/maestro-org/go-sdk/utils"
+)
+
+// maestroDatum is the resolved datum Maestro attaches to an utxo
+type maestroDatum struct {
+	Type  string `json:"type"`
+	Hash  string `json:"hash"`
+	Bytes string `json:"bytes"`
+}
+
+// parseMaestroDatum reads the untyped datum field of a Maestro utxo
+func parseMaestroDatum(datum any) (maestroDatum, error) {
+	var result maestroDatum
+	if datum == nil {
+		return result, nil
+	}
+	b, err := json.Marshal(datum)
+	if err != nil {
+		return result, err
+	}
+	err = json.Unmarshal(b, &result)
+	return result, err
+}
+
+// maestroUtxoToUTxO converts an utxo fetched with_cbor into an apollo UTxO
+func maestroUtxoToUTxO(utxo models.Utxo) (*UTxO.UTxO, error) {
+	txHash, err := hex.DecodeString(utxo.TxHash)
+	if err != nil {
+		return nil, err
+	}
+	txOutCbor, err := hex.DecodeString(utxo.TxOutCbor)
+	if err != nil {
+		return nil, err
+	}
+	var output TransactionOutput.TransactionOutput
+	err = cbor.Unmarshal(txOutCbor, &output)
+	if err != nil {
+		return nil, err
+	}
+	return &UTxO.UTxO{
+		Input: TransactionInput.TransactionInput{
+			TransactionId: txHash,
+			Index:         int(utxo.Index),
+		},
+		Output: output,
+	}, nil
+}
+
+// maestroRedeemerTags maps Maestro redeemer tags onto apollo's redeemer tag names
+var maestroRedeemerTags = map[string]string{
+	"spend":    Redeemer.RdeemerTagNames[Redeemer.SPEND],
+	"mint":     Redeemer.RdeemerTagNames[Redeemer.MINT],
+	"cert":     Redeemer.RdeemerTagNames[Redeemer.CERT],
+	"reward":   Redeemer.RdeemerTagNames[Redeemer.REWARD],
+	"withdraw": Redeemer.RdeemerTagNames[Redeemer.REWARD],
+}
+
+// MaestroChainContext is an apollo Base.ChainContext backed by the Maestro API
+type MaestroChainContext struct {
+	client    *client.Client
+	projectId string
+	network   int
+
+	mu              sync.Mutex
+	protocolParams  *Base.ProtocolParameters
+	paramsFetchedAt time.Time
+}
+
+func (m *MaestroChainContext) GetProtocolParams() Base.ProtocolParameters {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.protocolParams != nil && time.Since(m.paramsFetchedAt) < protocolParamsTTL {
+		return *m.protocolParams
+	}
+
+	resp, err := m.client.ProtocolParameters()
+	if err != nil || resp == nil {
+		if m.protocolParams != nil {
+			return *m.protocolParams
+		}
+		return Base.ProtocolParameters{}
+	}
+	p := resp.Data
+	protocolParams := Base.ProtocolParameters{
+		MinFeeConstant:        int(p.MinFeeConstant),
+		MinFeeCoefficient:     int(p.MinFeeCoefficient),
+		MaxBlockSize:          int(p.MaxBlockBodySize),
+		MaxTxSize:             int(p.MaxTxSize),
+		MaxBlockHeaderSize:    int(p.MaxBlockHeaderSize),
+		KeyDeposits:           strconv.FormatInt(p.StakeKeyDeposit, 10),
+		PoolDeposits:          strconv.FormatInt(p.PoolDeposit, 10),
+		PooolInfluence:        parseRatio(p.PoolInfluence),
+		MonetaryExpansion:     parseRatio(p.MonetaryExpansion),
+		TreasuryExpansion:     parseRatio(p.TreasuryExpansion),
+		DecentralizationParam: 0,
+		ProtocolMajorVersion:  int(p.ProtocolVersion.Major),
+		ProtocolMinorVersion:  int(p.ProtocolVersion.Minor),
+		MinPoolCost:           strconv.FormatInt(p.MinPoolCost, 10),
+		PriceMem:              parseRatio(p.Prices.Memory),
+		PriceStep:             parseRatio(p.Prices.Steps),
+		MaxTxExMem:            strconv.FormatInt(p.MaxExecutionUnitsPerTransaction.Memory, 10),
+		MaxTxExSteps:          strconv.FormatInt(p.MaxExecutionUnitsPerTransaction.Steps, 10),
+		MaxBlockExMem:         strconv.FormatInt(p.MaxExecutionUnitsPerBlock.Memory, 10),
+		MaxBlockExSteps:       strconv.FormatInt(p.MaxExecutionUnitsPerBlock.Steps, 10),
+		MaxValSize:            strconv.FormatInt(p.MaxValueSize, 10),
+		CollateralPercent:     int(p.CollateralPercentage),
+		MaxCollateralInuts:    int(p.MaxCollateralInputs),
+		CoinsPerUtxoByte:      strconv.FormatInt(p.CoinsPerUtxoByte, 10),
+		// coins per utxo word is deprecated since babbage (CIP-55)
+		CoinsPerUtxoWord: strconv.FormatInt(p.CoinsPerUtxoByte, 10),
+	}
+	m.protocolParams = &protocolParams
+	m.paramsFetchedAt = time.Now()
+	return protocolParams
+}
+
+// GetGenesisParams returns empty parameters, Maestro does not expose the genesis configuration
+func (m *MaestroChainContext) GetGenesisParams() Base.GenesisParameters {
+	return Base.GenesisParameters{}
+}
+
+func (m *MaestroChainContext) Network() int {
+	return m.network
+}
+
+func (m *MaestroChainContext) Epoch() int {
+	resp, err := m.client.CurrentEpoch()
+	if err != nil || resp == nil {
+		return 0
+	}
+	return resp.Data.EpochNo
+}
+
+func (m *MaestroChainContext) MaxTxFee() int {
+	protocolParams := m.GetProtocolParams()
+	maxTxExSteps, _ := strconv.Atoi(protocolParams.MaxTxExSteps)
+	maxTxExMem, _ := strconv.Atoi(protocolParams.MaxTxExMem)
+	return Base.Fee(m, protocolParams.MaxTxSize, maxTxExSteps, maxTxExMem)
+}
+
+func (m *MaestroChainContext) LastBlockSlot() int {
+	resp, err := m.client.ChainTip()
+	if err != nil || resp == nil {
+		return 0
+	}
+	return int(resp.Data.Slot)
+}
+
+func (m *MaestroChainContext) Utxos(address Address.Address) []UTxO.UTxO {
+	utxos := []UTxO.UTxO{}
+	cursor := ""
+	for {
+		params := maestroUtils.NewParameters()
+		params.WithCbor()
+		if cursor != "" {
+			params.Cursor(cursor)
+		}
+		resp, err := m.client.UtxosAtAddress(address.String(), params)
+		if err != nil || resp == nil {
+			return utxos
+		}
+
+		for _, maestroUtxo := range resp.Data {
+			utxo, err := maestroUtxoToUTxO(maestroUtxo)
+			if err != nil {
+				continue
+			}
+			utxos = append(utxos, *utxo)
+		}
+
+		if resp.NextCursor == "" {
+			return utxos
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// SubmitTx posts the raw transaction, the sdk's SubmitTx sends it as a json string
+// which Maestro rejects
+func (m *MaestroChainContext) SubmitTx(tx Transaction.Transaction) (serialization.TransactionId, error) {
+	txBytes, err := tx.Bytes()
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.client.BaseUrl+"/submit/tx", bytes.NewReader(txBytes))
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	req.Header.Set("Content-Type", "application/cbor")
+	req.Header.Set("api-key", m.projectId)
+	resp, err := m.client.HTTPClient.Do(req)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return serialization.TransactionId{}, fmt.Errorf("maestro submit: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	payload, err := hex.DecodeString(string(bytes.Trim(body, "\" \n")))
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	return serialization.TransactionId{Payload: payload}, nil
+}
+
+func (m *MaestroChainContext) EvaluateTx(tx []uint8) map[string]Redeemer.ExecutionUnits {
+	result := map[string]Redeemer.ExecutionUnits{}
+	evaluations, err := m.client.EvaluateTx(hex.EncodeToString(tx))
+	if err != nil {
+		return result
+	}
+
+	for _, evaluation := range evaluations {
+		tag, ok := maestroRedeemerTags[evaluation.RedeemerTag]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", tag, evaluation.RedeemerIndex)
+		result[key] = Redeemer.ExecutionUnits{
+			Mem:   evaluation.ExUnits.Mem,
+			Steps: evaluation.ExUnits.Steps,
+		}
+	}
+	return result
+}
+
+func (m *MaestroChainContext) GetUtxoFromRef(txHash string, txIndex int) *UTxO.UTxO {
+	utxo, err := m.getUtxoFromRef(txHash, txIndex)
+	if err != nil {
+		return nil
+	}
+	return utxo
+}
+
+func (m *MaestroChainContext) getUtxoFromRef(txHash string, txIndex int) (*UTxO.UTxO, error) {
+	params := maestroUtils.NewParameters()
+	params.WithCbor()
+	resp, err := m.client.TransactionOutputFromReference(txHash, txIndex, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.Data.TxOutCbor == "" {
+		return nil, nil
+	}
+	return maestroUtxoToUTxO(resp.Data)
+}
+
+func (m *MaestroChainContext) GetContractCbor(scriptHash string) string {
+	resp, err := m.client.ScriptByHash(scriptHash)
+	if err != nil || resp == nil {
+		return ""
+	}
+	// Maestro returns the flat script wrapped in a cbor bytestring
+	var script []byte
+	decoded, err := hex.DecodeString(resp.Data.Bytes)
+	if err != nil {
+		return ""
+	}
+	if err := cbor.Unmarshal(decoded, &script); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(script)
+}
@@ -0,0 +1,133 @@
+package adapter_test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const maestroFixtures = "testdata/maestro"
+
+// newMaestroStandIn serves recorded Maestro responses
+func newMaestroStandIn(t *testing.T) *adapter.Maestro {
+	t.Helper()
+	orderRef := constants.V2DeployedScripts[c.TESTNET].Order
+	fixtures := map[string]string{
+		"GET /assets/" + constants.V2Config[c.TESTNET].PoolAuthenAsset + "/utxos": "asset_utxos_pool.json",
+		"POST /transactions/outputs": "outputs_pool.json",
+		"GET /addresses/" + constants.StableConfig[c.TESTNET][0].PoolAddress + "/utxos":     "utxos_stable.json",
+		"GET /data/9a1b3c5e7f9a1b3c5d7e9f1a3b5c7d9e1f3a5b7c9d1e3f5a7b9c1d3e5f7a9b1c":        "datum_stable.json",
+		fmt.Sprintf("GET /transactions/%s/outputs/%d/txo", orderRef.TxHash, orderRef.Index): "txo_order_script.json",
+		"GET /protocol-params": "protocol_params.json",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := fixtures[r.Method+" "+r.URL.Path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"data":[],"next_cursor":null}`))
+			return
+		}
+		b, err := os.ReadFile(filepath.Join(maestroFixtures, name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}))
+	t.Cleanup(server.Close)
+
+	maestro, err := adapter.NewMaestro(adapter.MaestroOptions{
+		ProjectID: "preprod-test",
+		Network:   c.PREPROD,
+		Endpoint:  server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return maestro
+}
+
+func TestNewMaestroUnsupportedNetwork(t *testing.T) {
+	_, err := adapter.NewMaestro(adapter.MaestroOptions{Network: c.TESTNET})
+	if err == nil {
+		t.Error("NewMaestro expect error for TESTNET")
+	}
+}
+
+func TestMaestroGetV2PoolByPair(t *testing.T) {
+	maestro := newMaestroStandIn(t)
+	if maestro.NetworkId() != c.TESTNET {
+		t.Errorf("NetworkId expect %d, but get %d\n", c.TESTNET, maestro.NetworkId())
+	}
+
+	pool, err := maestro.GetV2PoolByPair(context.Background(), utils.MIN, utils.ADA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 || pool.TotalLiquidity != 1_000_000_000 {
+		t.Errorf("GetV2PoolByPair unexpected pool %+v\n", pool)
+	}
+	checkPoolUtxo(t, pool)
+	if pool.Datum == "" {
+		t.Error("GetV2PoolByPair expect pool datum")
+	}
+
+	pools, errs := maestro.GetV2Pool(context.Background(), adapter.QueryParams{Count: 1, Page: 2})
+	if len(errs) != 0 || len(pools) != 0 {
+		t.Errorf("GetV2Pool expect empty second page, but get %d pools, errs %v\n", len(pools), errs)
+	}
+}
+
+func TestMaestroGetAllStablePools(t *testing.T) {
+	maestro := newMaestroStandIn(t)
+
+	pools, errs := maestro.GetAllStablePools(context.Background())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(pools) != 1 {
+		t.Fatalf("GetAllStablePools expect 1 pool, but get %d\n", len(pools))
+	}
+	if pools[0].TotalLiquidity != 3_000_000 || pools[0].AMP != 10 {
+		t.Errorf("GetAllStablePools unexpected pool %+v\n", pools[0])
+	}
+}
+
+func TestMaestroGetUtxoFromRef(t *testing.T) {
+	maestro := newMaestroStandIn(t)
+	ref := constants.V2DeployedScripts[c.TESTNET].Order
+
+	utxo := maestro.GetUtxoFromRef(context.Background(), ref.TxHash, ref.Index)
+	if utxo == nil {
+		t.Fatal("GetUtxoFromRef expect utxo")
+	}
+	if hex.EncodeToString(utxo.Input.TransactionId) != ref.TxHash {
+		t.Errorf("GetUtxoFromRef expect %s, but get %s\n", ref.TxHash, hex.EncodeToString(utxo.Input.TransactionId))
+	}
+	if utxo.Output.GetValue().GetCoin() != 31209570 {
+		t.Errorf("GetUtxoFromRef expect 31209570 lovelace, but get %d\n", utxo.Output.GetValue().GetCoin())
+	}
+}
+
+func TestMaestroChainContext(t *testing.T) {
+	params := newMaestroStandIn(t).ChainContext().GetProtocolParams()
+	if params.MinFeeCoefficient != 44 || params.MinFeeConstant != 155381 || params.CoinsPerUtxoByte != "4310" {
+		t.Errorf("GetProtocolParams unexpected params %+v\n", params)
+	}
+	if params.PriceMem != 0.0577 {
+		t.Errorf("GetProtocolParams expect PriceMem 0.0577, but get %f\n", params.PriceMem)
+	}
+}
@@ -0,0 +1,475 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Newt6611/apollo/serialization"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// ogmiosClient talks to Ogmios v6 using JSON-RPC over HTTP
+type ogmiosClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+type ogmiosRequest struct {
+	JsonRpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+	Id      int    `json:"id"`
+}
+
+type ogmiosError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *ogmiosError) Error() string {
+	return fmt.Sprintf("ogmios error %d: %s", e.Code, e.Message)
+}
+
+type ogmiosResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *ogmiosError    `json:"error"`
+}
+
+func (o *ogmiosClient) call(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(ogmiosRequest{
+		JsonRpc: "2.0",
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var response ogmiosResponse
+	err = json.Unmarshal(respBody, &response)
+	if err != nil {
+		return fmt.Errorf("ogmios %s: unexpected response (status %d): %w", method, resp.StatusCode, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+type ogmiosLovelace struct {
+	Lovelace uint64 `json:"lovelace"`
+}
+
+type ogmiosAda struct {
+	Ada ogmiosLovelace `json:"ada"`
+}
+
+type ogmiosBytes struct {
+	Bytes uint64 `json:"bytes"`
+}
+
+type ogmiosExUnits struct {
+	Memory uint64 `json:"memory"`
+	Cpu    uint64 `json:"cpu"`
+}
+
+type ogmiosProtocolParameters struct {
+	MinFeeCoefficient               uint64        `json:"minFeeCoefficient"`
+	MinFeeConstant                  ogmiosAda     `json:"minFeeConstant"`
+	MaxBlockBodySize                ogmiosBytes   `json:"maxBlockBodySize"`
+	MaxBlockHeaderSize              ogmiosBytes   `json:"maxBlockHeaderSize"`
+	MaxTransactionSize              ogmiosBytes   `json:"maxTransactionSize"`
+	StakeCredentialDeposit          ogmiosAda     `json:"stakeCredentialDeposit"`
+	StakePoolDeposit                ogmiosAda     `json:"stakePoolDeposit"`
+	StakePoolPledgeInfluence        string        `json:"stakePoolPledgeInfluence"`
+	MonetaryExpansion               string        `json:"monetaryExpansion"`
+	TreasuryExpansion               string        `json:"treasuryExpansion"`
+	MinStakePoolCost                ogmiosAda     `json:"minStakePoolCost"`
+	MinUtxoDepositCoefficient       uint64        `json:"minUtxoDepositCoefficient"`
+	MaxValueSize                    ogmiosBytes   `json:"maxValueSize"`
+	CollateralPercentage            uint64        `json:"collateralPercentage"`
+	MaxCollateralInputs             uint64        `json:"maxCollateralInputs"`
+	MaxExecutionUnitsPerTransaction ogmiosExUnits `json:"maxExecutionUnitsPerTransaction"`
+	MaxExecutionUnitsPerBlock       ogmiosExUnits `json:"maxExecutionUnitsPerBlock"`
+	ScriptExecutionPrices           struct {
+		Memory string `json:"memory"`
+		Cpu    string `json:"cpu"`
+	} `json:"scriptExecutionPrices"`
+	Version struct {
+		Major int `json:"major"`
+		Minor int `json:"minor"`
+	} `json:"version"`
+}
+
+func (p ogmiosProtocolParameters) toProtocolParameters() Base.ProtocolParameters {
+	return Base.ProtocolParameters{
+		MinFeeConstant:        int(p.MinFeeConstant.Ada.Lovelace),
+		MinFeeCoefficient:     int(p.MinFeeCoefficient),
+		MaxBlockSize:          int(p.MaxBlockBodySize.Bytes),
+		MaxTxSize:             int(p.MaxTransactionSize.Bytes),
+		MaxBlockHeaderSize:    int(p.MaxBlockHeaderSize.Bytes),
+		KeyDeposits:           strconv.FormatUint(p.StakeCredentialDeposit.Ada.Lovelace, 10),
+		PoolDeposits:          strconv.FormatUint(p.StakePoolDeposit.Ada.Lovelace, 10),
+		PooolInfluence:        parseRatio(p.StakePoolPledgeInfluence),
+		MonetaryExpansion:     parseRatio(p.MonetaryExpansion),
+		TreasuryExpansion:     parseRatio(p.TreasuryExpansion),
+		DecentralizationParam: 0,
+		ProtocolMajorVersion:  p.Version.Major,
+		ProtocolMinorVersion:  p.Version.Minor,
+		MinPoolCost:           strconv.FormatUint(p.MinStakePoolCost.Ada.Lovelace, 10),
+		PriceMem:              parseRatio(p.ScriptExecutionPrices.Memory),
+		PriceStep:             parseRatio(p.ScriptExecutionPrices.Cpu),
+		MaxTxExMem:            strconv.FormatUint(p.MaxExecutionUnitsPerTransaction.Memory, 10),
+		MaxTxExSteps:          strconv.FormatUint(p.MaxExecutionUnitsPerTransaction.Cpu, 10),
+		MaxBlockExMem:         strconv.FormatUint(p.MaxExecutionUnitsPerBlock.Memory, 10),
+		MaxBlockExSteps:       strconv.FormatUint(p.MaxExecutionUnitsPerBlock.Cpu, 10),
+		MaxValSize:            strconv.FormatUint(p.MaxValueSize.Bytes, 10),
+		CollateralPercent:     int(p.CollateralPercentage),
+		MaxCollateralInuts:    int(p.MaxCollateralInputs),
+		CoinsPerUtxoByte:      strconv.FormatUint(p.MinUtxoDepositCoefficient, 10),
+		// coins per utxo word is deprecated since babbage (CIP-55)
+		CoinsPerUtxoWord: strconv.FormatUint(p.MinUtxoDepositCoefficient, 10),
+	}
+}
+
+type ogmiosGenesisConfiguration struct {
+	StartTime              string `json:"startTime"`
+	NetworkMagic           int    `json:"networkMagic"`
+	ActiveSlotsCoefficient string `json:"activeSlotsCoefficient"`
+	SecurityParameter      int    `json:"securityParameter"`
+	EpochLength            int    `json:"epochLength"`
+	SlotsPerKesPeriod      int    `json:"slotsPerKesPeriod"`
+	MaxKesEvolutions       int    `json:"maxKesEvolutions"`
+	UpdateQuorum           int    `json:"updateQuorum"`
+	MaxLovelaceSupply      uint64 `json:"maxLovelaceSupply"`
+	SlotLength             struct {
+		Milliseconds int `json:"milliseconds"`
+	} `json:"slotLength"`
+}
+
+func (g ogmiosGenesisConfiguration) toGenesisParameters() Base.GenesisParameters {
+	systemStart := 0
+	if t, err := time.Parse(time.RFC3339, g.StartTime); err == nil {
+		systemStart = int(t.Unix())
+	}
+	return Base.GenesisParameters{
+		ActiveSlotsCoefficient: parseRatio(g.ActiveSlotsCoefficient),
+		UpdateQuorum:           g.UpdateQuorum,
+		MaxLovelaceSupply:      strconv.FormatUint(g.MaxLovelaceSupply, 10),
+		NetworkMagic:           g.NetworkMagic,
+		EpochLength:            g.EpochLength,
+		SystemStart:            systemStart,
+		SlotsPerKesPeriod:      g.SlotsPerKesPeriod,
+		SlotLength:             g.SlotLength.Milliseconds / 1000,
+		MaxKesEvolutions:       g.MaxKesEvolutions,
+		SecurityParam:          g.SecurityParameter,
+	}
+}
+
+type ogmiosOutputReference struct {
+	Transaction struct {
+		Id string `json:"id"`
+	} `json:"transaction"`
+	Index int `json:"index"`
+}
+
+type ogmiosUtxo struct {
+	ogmiosOutputReference
+	Address   string                       `json:"address"`
+	Value     map[string]map[string]uint64 `json:"value"`
+	DatumHash string                       `json:"datumHash"`
+	Datum     string                       `json:"datum"`
+	Script    *struct {
+		Language string `json:"language"`
+		Cbor     string `json:"cbor"`
+	} `json:"script"`
+}
+
+func (u ogmiosUtxo) toUTxO() (*UTxO.UTxO, error) {
+	amounts := []Base.AddressAmount{}
+	for policyId, assets := range u.Value {
+		for assetName, quantity := range assets {
+			unit := policyId + assetName
+			if policyId == "ada" {
+				unit = "lovelace"
+			}
+			amounts = append(amounts, Base.AddressAmount{
+				Unit:     unit,
+				Quantity: strconv.FormatUint(quantity, 10),
+			})
+		}
+	}
+
+	output := Base.Output{
+		Address:     u.Address,
+		Amount:      amounts,
+		OutputIndex: u.Index,
+		DataHash:    u.DatumHash,
+		InlineDatum: u.Datum,
+	}
+	utxo := output.ToUTxO(u.Transaction.Id)
+	if u.Script == nil {
+		return utxo, nil
+	}
+	script, err := hex.DecodeString(u.Script.Cbor)
+	if err != nil {
+		return nil, fmt.Errorf("script of %s#%d: %w", u.Transaction.Id, u.Index, err)
+	}
+	withScriptRef(utxo, script)
+	return utxo, nil
+}
+
+type ogmiosEvaluation struct {
+	Validator struct {
+		Index   int    `json:"index"`
+		Purpose string `json:"purpose"`
+	} `json:"validator"`
+	Budget ogmiosExUnits `json:"budget"`
+}
+
+// ogmiosRedeemerTags maps Ogmios validator purposes onto apollo's redeemer tag names
+var ogmiosRedeemerTags = map[string]string{
+	"spend":    Redeemer.RdeemerTagNames[Redeemer.SPEND],
+	"mint":     Redeemer.RdeemerTagNames[Redeemer.MINT],
+	"publish":  Redeemer.RdeemerTagNames[Redeemer.CERT],
+	"withdraw": Redeemer.RdeemerTagNames[Redeemer.REWARD],
+}
+
+// OgmiosChainContext is an apollo Base.ChainContext backed by Ogmios for ledger
+// state queries and Kupo for address lookups
+type OgmiosChainContext struct {
+	ogmios  *ogmiosClient
+	kupo    *kupoClient
+	network int
+
+	mu              sync.Mutex
+	protocolParams  *Base.ProtocolParameters
+	paramsFetchedAt time.Time
+	genesisParams   *Base.GenesisParameters
+}
+
+func (o *OgmiosChainContext) GetProtocolParams() Base.ProtocolParameters {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.protocolParams != nil && time.Since(o.paramsFetchedAt) < protocolParamsTTL {
+		return *o.protocolParams
+	}
+
+	var params ogmiosProtocolParameters
+	err := o.ogmios.call(context.Background(), "queryLedgerState/protocolParameters", nil, &params)
+	if err != nil {
+		if o.protocolParams != nil {
+			return *o.protocolParams
+		}
+		return Base.ProtocolParameters{}
+	}
+	protocolParams := params.toProtocolParameters()
+	o.protocolParams = &protocolParams
+	o.paramsFetchedAt = time.Now()
+	return protocolParams
+}
+
+func (o *OgmiosChainContext) GetGenesisParams() Base.GenesisParameters {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.genesisParams != nil {
+		return *o.genesisParams
+	}
+
+	var genesis ogmiosGenesisConfiguration
+	err := o.ogmios.call(context.Background(), "queryNetwork/genesisConfiguration", map[string]string{"era": "shelley"}, &genesis)
+	if err != nil {
+		return Base.GenesisParameters{}
+	}
+	genesisParams := genesis.toGenesisParameters()
+	o.genesisParams = &genesisParams
+	return genesisParams
+}
+
+func (o *OgmiosChainContext) Network() int {
+	return o.network
+}
+
+func (o *OgmiosChainContext) Epoch() int {
+	var epoch int
+	err := o.ogmios.call(context.Background(), "queryLedgerState/epoch", nil, &epoch)
+	if err != nil {
+		return 0
+	}
+	return epoch
+}
+
+func (o *OgmiosChainContext) MaxTxFee() int {
+	protocolParams := o.GetProtocolParams()
+	maxTxExSteps, _ := strconv.Atoi(protocolParams.MaxTxExSteps)
+	maxTxExMem, _ := strconv.Atoi(protocolParams.MaxTxExMem)
+	return Base.Fee(o, protocolParams.MaxTxSize, maxTxExSteps, maxTxExMem)
+}
+
+func (o *OgmiosChainContext) LastBlockSlot() int {
+	var tip struct {
+		Slot int    `json:"slot"`
+		Id   string `json:"id"`
+	}
+	err := o.ogmios.call(context.Background(), "queryNetwork/tip", nil, &tip)
+	if err != nil {
+		return 0
+	}
+	return tip.Slot
+}
+
+func (o *OgmiosChainContext) Utxos(address Address.Address) []UTxO.UTxO {
+	ctx := context.Background()
+	matches, err := o.kupo.matches(ctx, address.String(), nil)
+	if err != nil {
+		return []UTxO.UTxO{}
+	}
+
+	utxos := []UTxO.UTxO{}
+	for _, match := range matches {
+		utxo, err := o.kupo.toUTxO(ctx, match)
+		if err != nil {
+			continue
+		}
+		utxos = append(utxos, *utxo)
+	}
+	return utxos
+}
+
+func (o *OgmiosChainContext) SubmitTx(tx Transaction.Transaction) (serialization.TransactionId, error) {
+	txBytes, err := cbor.Marshal(tx)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+
+	var result struct {
+		Transaction struct {
+			Id string `json:"id"`
+		} `json:"transaction"`
+	}
+	params := map[string]any{
+		"transaction": map[string]string{"cbor": hex.EncodeToString(txBytes)},
+	}
+	err = o.ogmios.call(context.Background(), "submitTransaction", params, &result)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+
+	payload, err := hex.DecodeString(result.Transaction.Id)
+	if err != nil {
+		return serialization.TransactionId{}, err
+	}
+	return serialization.TransactionId{Payload: payload}, nil
+}
+
+func (o *OgmiosChainContext) EvaluateTx(tx []uint8) map[string]Redeemer.ExecutionUnits {
+	var evaluations []ogmiosEvaluation
+	params := map[string]any{
+		"transaction": map[string]string{"cbor": hex.EncodeToString(tx)},
+	}
+	result := map[string]Redeemer.ExecutionUnits{}
+	err := o.ogmios.call(context.Background(), "evaluateTransaction", params, &evaluations)
+	if err != nil {
+		return result
+	}
+
+	for _, evaluation := range evaluations {
+		tag, ok := ogmiosRedeemerTags[evaluation.Validator.Purpose]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s:%d", tag, evaluation.Validator.Index)
+		result[key] = Redeemer.ExecutionUnits{
+			Mem:   int64(evaluation.Budget.Memory),
+			Steps: int64(evaluation.Budget.Cpu),
+		}
+	}
+	return result
+}
+
+func (o *OgmiosChainContext) GetUtxoFromRef(txHash string, txIndex int) *UTxO.UTxO {
+	utxo, err := o.getUtxoFromRef(context.Background(), txHash, txIndex)
+	if err != nil {
+		return nil
+	}
+	return utxo
+}
+
+func (o *OgmiosChainContext) getUtxoFromRef(ctx context.Context, txHash string, txIndex int) (*UTxO.UTxO, error) {
+	var outRef ogmiosOutputReference
+	outRef.Transaction.Id = txHash
+	outRef.Index = txIndex
+	params := map[string]any{
+		"outputReferences": []ogmiosOutputReference{outRef},
+	}
+
+	var utxos []ogmiosUtxo
+	err := o.ogmios.call(ctx, "queryLedgerState/utxo", params, &utxos)
+	if err != nil {
+		return nil, err
+	}
+	if len(utxos) == 0 {
+		return nil, nil
+	}
+	return utxos[0].toUTxO()
+}
+
+func (o *OgmiosChainContext) GetContractCbor(scriptHash string) string {
+	script, err := o.kupo.script(context.Background(), scriptHash)
+	if err != nil {
+		return ""
+	}
+	return script
+}
+
+// parseRatio parses the "numerator/denominator" strings used by Ogmios and Maestro
+func parseRatio(s string) float32 {
+	numerator, denominator, found := strings.Cut(s, "/")
+	if !found {
+		f, _ := strconv.ParseFloat(s, 32)
+		return float32(f)
+	}
+	n, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	d, err := strconv.ParseFloat(denominator, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return float32(n / d)
+}
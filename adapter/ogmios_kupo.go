@@ -0,0 +1,570 @@
+package adapter
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/TransactionOutput"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+var errKupoNotFound = errors.New("kupo: not found")
+
+// kupoClient queries the Kupo HTTP API
+type kupoClient struct {
+	endpoint string
+	client   *http.Client
+}
+
+type kupoMatch struct {
+	TransactionId string `json:"transaction_id"`
+	OutputIndex   int    `json:"output_index"`
+	Address       string `json:"address"`
+	Value         struct {
+		Coins  uint64            `json:"coins"`
+		Assets map[string]uint64 `json:"assets"`
+	} `json:"value"`
+	DatumHash  *string `json:"datum_hash"`
+	DatumType  string  `json:"datum_type"`
+	ScriptHash *string `json:"script_hash"`
+	CreatedAt  struct {
+		SlotNo int `json:"slot_no"`
+	} `json:"created_at"`
+	SpentAt *struct {
+		SlotNo        int     `json:"slot_no"`
+		TransactionId string  `json:"transaction_id"`
+		InputIndex    int     `json:"input_index"`
+		Redeemer      *string `json:"redeemer"`
+	} `json:"spent_at"`
+}
+
+func (k *kupoClient) get(ctx context.Context, path string, result any) error {
+	u := strings.TrimSuffix(k.endpoint, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errKupoNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kupo %s: status %d: %s", path, resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, result)
+}
+
+// matches returns the unspent outputs matching pattern, optionally filtered by an asset unit (policy id + asset name)
+func (k *kupoClient) matches(ctx context.Context, pattern string, asset *string) ([]kupoMatch, error) {
+	path := "/matches/" + pattern + "?unspent"
+	if asset != nil {
+		if len(*asset) < 56 {
+			return nil, fmt.Errorf("kupo: invalid asset unit %q", *asset)
+		}
+		path += "&policy_id=" + (*asset)[:56]
+		if len(*asset) > 56 {
+			path += "&asset_name=" + (*asset)[56:]
+		}
+	}
+
+	var matches []kupoMatch
+	err := k.get(ctx, path, &matches)
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// output returns the output txHash#index whether spent or not, nil when kupo
+// has not seen it
+func (k *kupoClient) output(ctx context.Context, txHash string, index int) (*kupoMatch, error) {
+	var matches []kupoMatch
+	err := k.get(ctx, fmt.Sprintf("/matches/%d@%s", index, txHash), &matches)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	return &matches[0], nil
+}
+
+// outputsOf returns the outputs of the transaction txHash sorted by index
+func (k *kupoClient) outputsOf(ctx context.Context, txHash string) ([]kupoMatch, error) {
+	var matches []kupoMatch
+	err := k.get(ctx, "/matches/*@"+txHash, &matches)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].OutputIndex < matches[j].OutputIndex
+	})
+	return matches, nil
+}
+
+// spentBy returns the outputs the transaction txHash spent at slot sorted by
+// their index among its inputs
+func (k *kupoClient) spentBy(ctx context.Context, txHash string, slot int) ([]kupoMatch, error) {
+	var matches []kupoMatch
+	err := k.get(ctx, fmt.Sprintf("/matches/*?spent&spent_after=%d&spent_before=%d", slot-1, slot+1), &matches)
+	if err != nil {
+		return nil, err
+	}
+	spent := []kupoMatch{}
+	for _, match := range matches {
+		if match.SpentAt != nil && match.SpentAt.TransactionId == txHash {
+			spent = append(spent, match)
+		}
+	}
+	sort.Slice(spent, func(i, j int) bool {
+		return spent[i].SpentAt.InputIndex < spent[j].SpentAt.InputIndex
+	})
+	return spent, nil
+}
+
+func (k *kupoClient) datum(ctx context.Context, datumHash string) (string, error) {
+	var result *struct {
+		Datum string `json:"datum"`
+	}
+	err := k.get(ctx, "/datums/"+datumHash, &result)
+	if err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", errors.New("cannot find datum " + datumHash)
+	}
+	return result.Datum, nil
+}
+
+func (k *kupoClient) script(ctx context.Context, scriptHash string) (string, error) {
+	var result *struct {
+		Script string `json:"script"`
+	}
+	err := k.get(ctx, "/scripts/"+scriptHash, &result)
+	if err != nil {
+		return "", err
+	}
+	if result == nil {
+		return "", errors.New("cannot find script " + scriptHash)
+	}
+	return result.Script, nil
+}
+
+// inlineDatum resolves the datum of a match when it is stored inline, kupo only reports its hash
+func (k *kupoClient) inlineDatum(ctx context.Context, match kupoMatch) (string, error) {
+	if match.DatumType != "inline" || match.DatumHash == nil {
+		return "", nil
+	}
+	return k.datum(ctx, *match.DatumHash)
+}
+
+func (k *kupoClient) toUTxO(ctx context.Context, match kupoMatch) (*UTxO.UTxO, error) {
+	inlineDatum, err := k.inlineDatum(ctx, match)
+	if err != nil {
+		return nil, err
+	}
+	return k.toUTxOWithDatum(ctx, match, inlineDatum)
+}
+
+// toUTxOWithDatum converts match with its already resolved inline datum, kupo
+// only reports the hash of a reference script so it is fetched here
+func (k *kupoClient) toUTxOWithDatum(ctx context.Context, match kupoMatch, inlineDatum string) (*UTxO.UTxO, error) {
+	utxo := match.toUTxO(inlineDatum)
+	if match.ScriptHash == nil {
+		return utxo, nil
+	}
+	script, err := k.script(ctx, *match.ScriptHash)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(script)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %w", *match.ScriptHash, err)
+	}
+	withScriptRef(utxo, b)
+	return utxo, nil
+}
+
+// withScriptRef attaches script as the reference script of utxo, only post
+// Alonzo outputs carry one
+func withScriptRef(utxo *UTxO.UTxO, script []byte) {
+	output := &utxo.Output
+	if !output.IsPostAlonzo {
+		post := TransactionOutput.TransactionOutputAlonzo{
+			Address: output.PreAlonzo.Address,
+			Amount:  output.PreAlonzo.Amount.ToAlonzoValue(),
+		}
+		if output.PreAlonzo.HasDatum {
+			datum := PlutusData.DatumOptionHash(output.PreAlonzo.DatumHash.Payload)
+			post.Datum = &datum
+		}
+		output.PostAlonzo = post
+		output.PreAlonzo = TransactionOutput.TransactionOutputShelley{}
+		output.IsPostAlonzo = true
+	}
+	scriptRef := PlutusData.ScriptRef{}
+	scriptRef.Script.Script = script
+	output.PostAlonzo.ScriptRef = &scriptRef
+}
+
+// toUTxO converts match with its already resolved inline datum
+func (match kupoMatch) toUTxO(inlineDatum string) *UTxO.UTxO {
+	amounts := []Base.AddressAmount{
+		{
+			Unit:     "lovelace",
+			Quantity: strconv.FormatUint(match.Value.Coins, 10),
+		},
+	}
+	for unit, quantity := range match.Value.Assets {
+		amounts = append(amounts, Base.AddressAmount{
+			Unit:     strings.Replace(unit, ".", "", 1),
+			Quantity: strconv.FormatUint(quantity, 10),
+		})
+	}
+
+	output := Base.Output{
+		Address:     match.Address,
+		Amount:      amounts,
+		OutputIndex: match.OutputIndex,
+		InlineDatum: inlineDatum,
+	}
+	if match.DatumType == "hash" && match.DatumHash != nil {
+		output.DataHash = *match.DatumHash
+	}
+	return output.ToUTxO(match.TransactionId)
+}
+
+type OgmiosKupoOptions struct {
+	// Ogmios v6 endpoint, requests are sent as JSON-RPC over HTTP
+	OgmiosEndpoint string
+	// Kupo endpoint
+	KupoEndpoint string
+	// MAINNET, PREPROD, PREVIEW or TESTNET
+	Network c.Network
+	// Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+type OgmiosKupo struct {
+	ogmios       *ogmiosClient
+	kupo         *kupoClient
+	network      c.Network
+	chainContext *OgmiosChainContext
+}
+
+func NewOgmiosKupo(options OgmiosKupoOptions) (*OgmiosKupo, error) {
+	if options.OgmiosEndpoint == "" {
+		return nil, errors.New("ogmios endpoint is required")
+	}
+	if options.KupoEndpoint == "" {
+		return nil, errors.New("kupo endpoint is required")
+	}
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	ogmios := &ogmiosClient{endpoint: options.OgmiosEndpoint, client: httpClient}
+	kupo := &kupoClient{endpoint: options.KupoEndpoint, client: httpClient}
+	// we only need know whether is testnet or mainnet
+	network := normalizeNetwork(options.Network)
+
+	return &OgmiosKupo{
+		ogmios:  ogmios,
+		kupo:    kupo,
+		network: network,
+		chainContext: &OgmiosChainContext{
+			ogmios:  ogmios,
+			kupo:    kupo,
+			network: int(network),
+		},
+	}, nil
+}
+
+func (o *OgmiosKupo) NetworkId() c.Network {
+	return o.network
+}
+
+func (o *OgmiosKupo) ChainContext() Base.ChainContext {
+	return o.chainContext
+}
+
+func (o *OgmiosKupo) NewBuilder() *apollo.Apollo {
+	return apollo.New(o.chainContext)
+}
+
+// v2PoolMatches returns every utxo at the V2 pool script holding the pool authen asset, oldest first
+func (o *OgmiosKupo) v2PoolMatches(ctx context.Context) ([]kupoMatch, error) {
+	cfg := constants.V2Config[o.network]
+	matches, err := o.kupo.matches(ctx, cfg.PoolScriptHash+"/*", &cfg.PoolAuthenAsset)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].CreatedAt.SlotNo < matches[j].CreatedAt.SlotNo
+	})
+	return matches, nil
+}
+
+func (o *OgmiosKupo) convertMatchesToPoolState(ctx context.Context, matches []kupoMatch) ([]utils.V2PoolState, []error) {
+	poolStates := []utils.V2PoolState{}
+	errs := []error{}
+	for _, match := range matches {
+		datum, err := o.kupo.inlineDatum(ctx, match)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if datum == "" {
+			continue
+		}
+
+		pool, err := decodeV2PoolState(datum)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		utxo, err := o.kupo.toUTxOWithDatum(ctx, match, datum)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		poolStates = append(poolStates, withPoolUtxo(pool, utxo))
+	}
+	return poolStates, errs
+}
+
+func (o *OgmiosKupo) GetV2PoolAll(ctx context.Context) ([]utils.V2PoolState, []error) {
+	matches, err := o.v2PoolMatches(ctx)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return o.convertMatchesToPoolState(ctx, matches)
+}
+
+// GetV2Pool pages through the pools client side, Kupo has no native paging
+func (o *OgmiosKupo) GetV2Pool(ctx context.Context, params QueryParams) ([]utils.V2PoolState, []error) {
+	matches, err := o.v2PoolMatches(ctx)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if params.Order == "desc" {
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].CreatedAt.SlotNo > matches[j].CreatedAt.SlotNo
+		})
+	}
+
+	count := params.Count
+	if count <= 0 {
+		count = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	start := (page - 1) * count
+	if start >= len(matches) {
+		return []utils.V2PoolState{}, []error{}
+	}
+	end := start + count
+	if end > len(matches) {
+		end = len(matches)
+	}
+	return o.convertMatchesToPoolState(ctx, matches[start:end])
+}
+
+func (o *OgmiosKupo) GetV2PoolByPair(ctx context.Context, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	pools, errs := o.GetV2PoolAll(ctx)
+	if len(errs) != 0 {
+		return utils.V2PoolState{}, errs[0]
+	}
+
+	return FindV2PoolByPair(pools, assetA, assetB)
+}
+
+func (o *OgmiosKupo) GetDatumByDatumHash(ctx context.Context, datumHash string) (string, error) {
+	return o.kupo.datum(ctx, datumHash)
+}
+
+func (o *OgmiosKupo) GetUtxoFromRef(ctx context.Context, txhash string, index int) *UTxO.UTxO {
+	utxo, err := o.chainContext.getUtxoFromRef(ctx, txhash, index)
+	if err != nil {
+		return nil
+	}
+	return utxo
+}
+
+// GetSpendingTx rebuilds the spending transaction from the spent_at of the
+// output in Kupo, Kupo must match every output and not prune spent ones.
+// Ogmios does not serve past transactions, so Tx only holds the inputs, outputs
+// and spend redeemers
+func (o *OgmiosKupo) GetSpendingTx(ctx context.Context, txhash string, index int) (*SpendingTx, error) {
+	created, err := o.kupo.output(ctx, txhash, index)
+	if err != nil {
+		return nil, err
+	}
+	if created == nil {
+		return nil, fmt.Errorf("cannot find output %s#%d", txhash, index)
+	}
+	if created.SpentAt == nil {
+		return nil, nil
+	}
+	spender := created.SpentAt.TransactionId
+	if spender == "" {
+		return nil, fmt.Errorf("kupo does not report the transaction spending %s#%d", txhash, index)
+	}
+
+	spent, err := o.kupo.spentBy(ctx, spender, created.SpentAt.SlotNo)
+	if err != nil {
+		return nil, err
+	}
+	var tx Transaction.Transaction
+	inputs := make([]UTxO.UTxO, 0, len(spent))
+	for _, match := range spent {
+		utxo, err := o.kupo.toUTxO(ctx, match)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, *utxo)
+		tx.TransactionBody.Inputs = append(tx.TransactionBody.Inputs, utxo.Input)
+		if match.SpentAt.Redeemer == nil {
+			continue
+		}
+		b, err := hex.DecodeString(*match.SpentAt.Redeemer)
+		if err != nil {
+			return nil, fmt.Errorf("redeemer of %s#%d: %w", match.TransactionId, match.OutputIndex, err)
+		}
+		data, err := utils.UnmarshalPlutusData(b)
+		if err != nil {
+			return nil, fmt.Errorf("redeemer of %s#%d: %w", match.TransactionId, match.OutputIndex, err)
+		}
+		tx.TransactionWitnessSet.Redeemer = append(tx.TransactionWitnessSet.Redeemer, Redeemer.Redeemer{
+			Tag:   Redeemer.SPEND,
+			Index: match.SpentAt.InputIndex,
+			Data:  data,
+		})
+	}
+
+	outputs, err := o.kupo.outputsOf(ctx, spender)
+	if err != nil {
+		return nil, err
+	}
+	for _, match := range outputs {
+		utxo, err := o.kupo.toUTxO(ctx, match)
+		if err != nil {
+			return nil, err
+		}
+		tx.TransactionBody.Outputs = append(tx.TransactionBody.Outputs, utxo.Output)
+	}
+	return &SpendingTx{TxHash: spender, Tx: tx, Inputs: inputs}, nil
+}
+
+func (o *OgmiosKupo) GetV2OrderUtxos(ctx context.Context) ([]UTxO.UTxO, []error) {
+	matches, err := o.kupo.matches(ctx, constants.V2Config[o.network].OrderScriptHash+"/*", nil)
+	if err != nil {
+		return nil, []error{err}
+	}
+	orderUtxos := make([]UTxO.UTxO, 0, len(matches))
+	errs := []error{}
+	for _, match := range matches {
+		utxo, err := o.kupo.toUTxO(ctx, match)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		orderUtxos = append(orderUtxos, *utxo)
+	}
+	return orderUtxos, errs
+}
+
+// stablePoolDatum finds the datum of a stable pool utxo from its inline datum or datum hash
+func (o *OgmiosKupo) stablePoolDatum(ctx context.Context, match kupoMatch) (string, error) {
+	if match.DatumHash == nil {
+		return "", errors.New("cannot find datum of stable pool " + match.Address)
+	}
+	return o.kupo.datum(ctx, *match.DatumHash)
+}
+
+func (o *OgmiosKupo) GetAllStablePools(ctx context.Context) ([]utils.StablePoolState, []error) {
+	var errs []error
+	var poolStates []utils.StablePoolState
+	for _, cfg := range constants.StableConfig[o.network] {
+		matches, err := o.kupo.matches(ctx, cfg.PoolAddress, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, match := range matches {
+			datum, err := o.stablePoolDatum(ctx, match)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			poolState, err := decodeStablePoolState(datum)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			poolStates = append(poolStates, poolState)
+		}
+	}
+
+	return poolStates, errs
+}
+
+func (o *OgmiosKupo) GetStablePoolByNFT(ctx context.Context, nft Fingerprint.Fingerprint) (utils.StablePoolState, error) {
+	var poolAddress string
+	var asset string
+	for _, cfg := range constants.StableConfig[o.network] {
+		if cfg.NFTAsset == nft.PolicyId.Value+nft.AssetName.Value {
+			poolAddress = cfg.PoolAddress
+			asset = cfg.NFTAsset
+		}
+	}
+
+	if poolAddress == "" {
+		return utils.StablePoolState{}, errors.New("cannot find Stable Pool having NFT " + nft.String())
+	}
+
+	matches, err := o.kupo.matches(ctx, poolAddress, &asset)
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	if len(matches) == 0 {
+		return utils.StablePoolState{}, errors.New("cannot find datum of stable pool")
+	}
+
+	datum, err := o.stablePoolDatum(ctx, matches[0])
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	return decodeStablePoolState(datum)
+}
@@ -0,0 +1,229 @@
+package adapter_test
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/AssetName"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/Policy"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const ogmiosKupoFixtures = "testdata/ogmios_kupo"
+
+// kupoFixtures maps the full request URI, query included, to its response
+var kupoFixtures = map[string]string{
+	"/matches/" + constants.V2Config[c.TESTNET].PoolScriptHash + "/*?unspent&policy_id=d6aae2059baee188f74917493cf7637e679cd219bdfbbf4dcbeb1d0b&asset_name=4d5350":                               "matches_pool.json",
+	"/matches/" + constants.StableConfig[c.TESTNET][0].PoolAddress + "?unspent":                                                                                                                  "matches_stable.json",
+	"/matches/" + constants.StableConfig[c.TESTNET][0].PoolAddress + "?unspent&policy_id=06fe1ba957728130154154d5e5b25a7b533ebe6c4516356c0aa69355&asset_name=646a65642d697573642d76312e342d6c70": "matches_stable.json",
+	"/matches/" + testKupoWallet + "?unspent":                                  "matches_wallet.json",
+	"/datums/4f0a4f3d6c8b0d3a5e7e4b0f6bd3c1f0e2a9d1b5c7e3f5a9b1d3c5e7f9a1b3c5": "datum_pool.json",
+	"/datums/9a1b3c5e7f9a1b3c5d7e9f1a3b5c7d9e1f3a5b7c9d1e3f5a7b9c1d3e5f7a9b1c": "datum_stable.json",
+	"/scripts/83a2d61669af82b7eb7d4ad30337951316e8a2729574fc37dfd50aa2":        "script_always_succeeds.json",
+	"/matches/0@" + testKupoOrderTx:                                            "matches_spent_order.json",
+	"/matches/1@" + testKupoOrderTx:                                            "matches_unspent_order.json",
+	"/matches/*?spent&spent_after=65000199&spent_before=65000201":              "matches_spent_at_slot.json",
+	"/matches/*@" + testKupoSpendingTx:                                         "matches_spending_tx.json",
+}
+
+const (
+	testKupoOrderTx    = "5b7e3c1f9a2d4e6b8c0a1f3e5d7c9b2a4f6e8d0c1b3a5f7e9d2c4b6a8f0e1d3c"
+	testKupoSpendingTx = "e2a4c6b8d0f1e3a5c7b9d1f3e5a7c9b1d3f5e7a9c1b3d5f7e9a1c3b5d7f9e1a3"
+)
+
+const testKupoWallet = "addr_test1qpssc0r090a9u0pyvdr9y76sm2xzx04n6d4j0y5hukcx6rxz4dtgkhfdynadkea0qezv99wljdl076xkg2krm96nn8jszmh3w7"
+
+// newOgmiosKupoStandIn serves recorded Kupo and Ogmios responses
+func newOgmiosKupoStandIn(t *testing.T) *adapter.OgmiosKupo {
+	t.Helper()
+	serveFixture := func(w http.ResponseWriter, name string) {
+		b, err := os.ReadFile(filepath.Join(ogmiosKupoFixtures, name))
+		if err != nil {
+			http.NotFound(w, nil)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}
+
+	kupo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uri := r.URL.Path
+		if r.URL.RawQuery != "" {
+			uri += "?" + r.URL.RawQuery
+		}
+		name, ok := kupoFixtures[uri]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		serveFixture(w, name)
+	}))
+	t.Cleanup(kupo.Close)
+
+	ogmios := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		serveFixture(w, strings.ReplaceAll(req.Method, "/", "_")+".json")
+	}))
+	t.Cleanup(ogmios.Close)
+
+	ogmiosKupo, err := adapter.NewOgmiosKupo(adapter.OgmiosKupoOptions{
+		OgmiosEndpoint: ogmios.URL,
+		KupoEndpoint:   kupo.URL,
+		Network:        c.PREPROD,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ogmiosKupo
+}
+
+func TestOgmiosKupoGetV2PoolByPair(t *testing.T) {
+	ogmiosKupo := newOgmiosKupoStandIn(t)
+	if ogmiosKupo.NetworkId() != c.TESTNET {
+		t.Errorf("NetworkId expect %d, but get %d\n", c.TESTNET, ogmiosKupo.NetworkId())
+	}
+
+	pool, err := ogmiosKupo.GetV2PoolByPair(context.Background(), utils.MIN, utils.ADA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 || pool.TotalLiquidity != 1_000_000_000 {
+		t.Errorf("GetV2PoolByPair unexpected pool %+v\n", pool)
+	}
+	checkPoolUtxo(t, pool)
+	if pool.Datum == "" {
+		t.Error("GetV2PoolByPair expect pool datum")
+	}
+
+	pools, errs := ogmiosKupo.GetV2Pool(context.Background(), adapter.QueryParams{Count: 1, Page: 2})
+	if len(errs) != 0 || len(pools) != 0 {
+		t.Errorf("GetV2Pool expect empty second page, but get %d pools, errs %v\n", len(pools), errs)
+	}
+}
+
+func TestOgmiosKupoGetStablePoolByNFT(t *testing.T) {
+	ogmiosKupo := newOgmiosKupoStandIn(t)
+	nftHex := constants.StableConfig[c.TESTNET][0].NFTAsset
+	nft := Fingerprint.New(Policy.PolicyId{Value: nftHex[:56]}, *AssetName.NewAssetNameFromHexString(nftHex[56:]))
+
+	pool, err := ogmiosKupo.GetStablePoolByNFT(context.Background(), *nft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool.Balances) != 2 || pool.Balances[0] != 1_000_000 || pool.Balances[1] != 2_000_000 {
+		t.Errorf("GetStablePoolByNFT unexpected balances %v\n", pool.Balances)
+	}
+	if pool.TotalLiquidity != 3_000_000 || pool.AMP != 10 {
+		t.Errorf("GetStablePoolByNFT unexpected pool %+v\n", pool)
+	}
+}
+
+func TestOgmiosKupoGetUtxoFromRef(t *testing.T) {
+	ogmiosKupo := newOgmiosKupoStandIn(t)
+	ref := constants.V2DeployedScripts[c.TESTNET].Order
+
+	utxo := ogmiosKupo.GetUtxoFromRef(context.Background(), ref.TxHash, ref.Index)
+	if utxo == nil {
+		t.Fatal("GetUtxoFromRef expect utxo")
+	}
+	if hex.EncodeToString(utxo.Input.TransactionId) != ref.TxHash {
+		t.Errorf("GetUtxoFromRef expect %s, but get %s\n", ref.TxHash, hex.EncodeToString(utxo.Input.TransactionId))
+	}
+	if utxo.Output.GetValue().GetCoin() != 31209570 {
+		t.Errorf("GetUtxoFromRef expect 31209570 lovelace, but get %d\n", utxo.Output.GetValue().GetCoin())
+	}
+	script := hex.EncodeToString(utxo.Output.GetScriptRef().Script.Script)
+	if script != "4e4d01000033222220051200120011" {
+		t.Errorf("GetUtxoFromRef expect reference script 4e4d01000033222220051200120011, but get %q\n", script)
+	}
+}
+
+func TestOgmiosKupoGetSpendingTx(t *testing.T) {
+	ogmiosKupo := newOgmiosKupoStandIn(t)
+	ctx := context.Background()
+
+	spending, err := ogmiosKupo.GetSpendingTx(ctx, testKupoOrderTx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spending == nil || spending.TxHash != testKupoSpendingTx {
+		t.Fatalf("GetSpendingTx expect spent by %s, but get %+v\n", testKupoSpendingTx, spending)
+	}
+	body := spending.Tx.TransactionBody
+	if len(spending.Inputs) != 2 || len(body.Inputs) != 2 {
+		t.Fatalf("GetSpendingTx expect 2 inputs, but get %d/%d\n", len(spending.Inputs), len(body.Inputs))
+	}
+	if hex.EncodeToString(body.Inputs[1].TransactionId) != testKupoOrderTx || body.Inputs[1].Index != 0 {
+		t.Errorf("GetSpendingTx expect the order as input 1, but get %x#%d\n", body.Inputs[1].TransactionId, body.Inputs[1].Index)
+	}
+	redeemers := spending.Tx.TransactionWitnessSet.Redeemer
+	if len(redeemers) != 1 || redeemers[0].Index != 1 || redeemers[0].Data.TagNr != 121 {
+		t.Errorf("GetSpendingTx expect a Constr 0 redeemer on input 1, but get %+v\n", redeemers)
+	}
+	if len(body.Outputs) != 2 || body.Outputs[0].GetValue().GetCoin() != 3_000_000 || body.Outputs[1].GetValue().GetCoin() != 14_500_000 {
+		t.Errorf("GetSpendingTx expect outputs of 3000000 and 14500000 lovelace, but get %+v\n", body.Outputs)
+	}
+
+	spending, err = ogmiosKupo.GetSpendingTx(ctx, testKupoOrderTx, 1)
+	if err != nil || spending != nil {
+		t.Errorf("GetSpendingTx expect nil for an unspent output, but get %v, %v\n", spending, err)
+	}
+	if _, err = ogmiosKupo.GetSpendingTx(ctx, testKupoOrderTx, 2); err == nil {
+		t.Error("GetSpendingTx expect an error for an unknown output")
+	}
+}
+
+func TestOgmiosChainContextReferenceScript(t *testing.T) {
+	chainContext := newOgmiosKupoStandIn(t).ChainContext()
+	wallet, err := Address.DecodeAddress(testKupoWallet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxos := chainContext.Utxos(wallet)
+	if len(utxos) != 2 {
+		t.Fatalf("Utxos expect 2 utxos, but get %d\n", len(utxos))
+	}
+	script := hex.EncodeToString(utxos[1].Output.GetScriptRef().Script.Script)
+	if script != "4e4d01000033222220051200120011" {
+		t.Errorf("Utxos expect reference script 4e4d01000033222220051200120011, but get %q\n", script)
+	}
+	if utxos[1].Output.GetValue().GetCoin() != 12_000_000 {
+		t.Errorf("Utxos expect 12000000 lovelace, but get %d\n", utxos[1].Output.GetValue().GetCoin())
+	}
+	if len(utxos[0].Output.GetScriptRef().Script.Script) != 0 {
+		t.Error("Utxos expect no reference script on the first utxo")
+	}
+}
+
+func TestOgmiosChainContext(t *testing.T) {
+	chainContext := newOgmiosKupoStandIn(t).ChainContext()
+
+	params := chainContext.GetProtocolParams()
+	if params.MinFeeCoefficient != 44 || params.MinFeeConstant != 155381 || params.CoinsPerUtxoByte != "4310" {
+		t.Errorf("GetProtocolParams unexpected params %+v\n", params)
+	}
+
+	exUnits := chainContext.EvaluateTx([]byte{0x84})
+	if exUnits["spend:0"].Mem != 1765011 || exUnits["withdrawal:0"].Steps != 1212353 {
+		t.Errorf("EvaluateTx unexpected execution units %v\n", exUnits)
+	}
+}
@@ -1,6 +1,23 @@
 package adapter
 
-import "github.com/Newt6611/apollo/serialization/Fingerprint"
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// protocol parameters only change at epoch boundaries, but the builder asks for
+// them many times per transaction
+const protocolParamsTTL = 10 * time.Minute
 
 func normalizeAssets(assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (Fingerprint.Fingerprint, Fingerprint.Fingerprint){
 	if assetA.String() == "lovelace" {
@@ -10,12 +27,91 @@ func normalizeAssets(assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerpr
 		return assetB, assetA
 	}
 
-	assetALen := len(assetA.PolicyId.Value) + len(assetA.AssetName.Value)
-	assetBLen := len(assetB.PolicyId.Value) + len(assetB.AssetName.Value)
-
-	if assetALen < assetBLen {
+	// pools hold their assets sorted by unit, policy id then asset name
+	if assetUnit(assetA) < assetUnit(assetB) {
 		return assetA, assetB
 	} else {
 		return assetB, assetA
 	}
 }
+
+// normalizeNetwork maps apollo networks onto the two keys used by constants.V2Config
+// and constants.StableConfig
+func normalizeNetwork(network c.Network) c.Network {
+	if network == c.MAINNET {
+		return c.MAINNET
+	}
+	return c.TESTNET
+}
+
+// FindV2PoolByPair returns the pool of assetA and assetB among pools, the way
+// every adapter matches a pair
+func FindV2PoolByPair(pools []utils.V2PoolState, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (utils.V2PoolState, error) {
+	normalizedAssetA, normalizedAssetB := normalizeAssets(assetA, assetB)
+	for _, pool := range pools {
+		if pool.AssetA.String() == normalizedAssetA.String() &&
+			pool.AssetB.String() == normalizedAssetB.String() {
+			return pool, nil
+		}
+	}
+
+	return utils.V2PoolState{}, ErrPoolNotFound
+}
+
+func decodePlutusData(datum string) (PlutusData.PlutusData, error) {
+	decodedHex, err := hex.DecodeString(datum)
+	if err != nil {
+		return PlutusData.PlutusData{}, err
+	}
+	return utils.UnmarshalPlutusData(decodedHex)
+}
+
+// decodeTx decodes a hex encoded transaction, the apollo decoder can panic on
+// eras it does not know
+func decodeTx(txCbor string) (tx Transaction.Transaction, err error) {
+	b, err := hex.DecodeString(txCbor)
+	if err != nil {
+		return tx, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx = Transaction.Transaction{}
+			err = fmt.Errorf("invalid transaction: %v", r)
+		}
+	}()
+	err = cbor.Unmarshal(b, &tx)
+	return tx, err
+}
+
+func decodeV2PoolState(datum string) (utils.V2PoolState, error) {
+	plutusData, err := decodePlutusData(datum)
+	if err != nil {
+		return utils.V2PoolState{}, err
+	}
+
+	pool, err := utils.ConvertToV2PoolState(plutusData)
+	if err != nil {
+		return utils.V2PoolState{}, err
+	}
+	pool.Datum = datum
+	return pool, nil
+}
+
+// withPoolUtxo attaches the out ref, address and value of utxo to pool
+func withPoolUtxo(pool utils.V2PoolState, utxo *UTxO.UTxO) utils.V2PoolState {
+	pool.OutRef = constants.OutRef{
+		TxHash: hex.EncodeToString(utxo.Input.TransactionId),
+		Index:  utxo.Input.Index,
+	}
+	pool.Address = utxo.Output.GetAddress()
+	pool.Value = utxo.Output.GetValue()
+	return pool
+}
+
+func decodeStablePoolState(datum string) (utils.StablePoolState, error) {
+	plutusData, err := decodePlutusData(datum)
+	if err != nil {
+		return utils.StablePoolState{}, err
+	}
+	return utils.ConvertToStablePoolState(plutusData)
+}
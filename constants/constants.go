@@ -1 +1,28 @@
 package constants
+
+import (
+	c "github.com/Newt6611/apollo/constants"
+)
+
+// SlotConfig maps slots to POSIX time from the Shelley hard fork on
+type SlotConfig struct {
+	// POSIX time of ZeroSlot in milliseconds
+	ZeroTime int64
+	ZeroSlot int64
+	// in milliseconds
+	SlotLength int64
+}
+
+var SlotConfigs = map[c.Network]SlotConfig{
+	c.MAINNET: {
+		ZeroTime:   1596059091000,
+		ZeroSlot:   4492800,
+		SlotLength: 1000,
+	},
+	// preprod
+	c.TESTNET: {
+		ZeroTime:   1655769600000,
+		ZeroSlot:   86400,
+		SlotLength: 1000,
+	},
+}
@@ -12,6 +12,7 @@ type v2Config struct {
 	GlobalSettingScriptHash       string
 	GlobalSettingScriptHashBech32 string
 	OrderScriptHash               string
+	OrderScriptHashBech32         string
 	PoolScriptHash                string
 	PoolScriptHashBech32          string
 	PoolCreationAddress           string
@@ -32,6 +33,7 @@ var V2Config = map[c.Network]v2Config{
 		GlobalSettingScriptHash:       "f5808c2c990d86da54bfc97d89cee6efa20cd8461616359478d96b4c",
 		GlobalSettingScriptHashBech32: "script17kqgctyepkrd549le97cnnhxa73qekzxzctrt9rcm945c880puk",
 		OrderScriptHash:               "c3e28c36c3447315ba5a56f33da6a6ddc1770a876a8d9f0cb3a97c4c",
+		OrderScriptHashBech32:         "script1c03gcdkrg3e3twj62menmf4xmhqhwz58d2xe7r9n497yc6r9qhd",
 		PoolScriptHash:                "ea07b733d932129c378af627436e7cbc2ef0bf96e0036bb51b3bde6b",
 		PoolScriptHashBech32:          "script1agrmwv7exgffcdu27cn5xmnuhsh0p0ukuqpkhdgm800xksw7e2w",
 		PoolCreationAddress:           "addr1z84q0denmyep98ph3tmzwsmw0j7zau9ljmsqx6a4rvaau66j2c79gy9l76sdg0xwhd7r0c0kna0tycz4y5s6mlenh8pq777e2a",
@@ -50,6 +52,7 @@ var V2Config = map[c.Network]v2Config{
 		GlobalSettingScriptHash:       "d6aae2059baee188f74917493cf7637e679cd219bdfbbf4dcbeb1d0b",
 		GlobalSettingScriptHashBech32: "script1664wypvm4msc3a6fzayneamr0enee5sehham7nwtavwsk2s2vg9",
 		OrderScriptHash:               "da9525463841173ad1230b1d5a1b5d0a3116bbdeb4412327148a1b7a",
+		OrderScriptHashBech32:         "script1m22j233cgytn45frpvw45x6apgc3dw77k3qjxfc53gdh5cejhly",
 		PoolScriptHash:                "d6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8fe",
 		PoolScriptHashBech32:          "script166afkagfatyxv2y075rj62scypdv2mm5f0yzmnvq3ju0uqqmszv",
 		PoolCreationAddress:           "addr_test1zrtt4xm4p84vse3g3l6swtf2rqs943t0w39ustwdszxt3l5rajt8r8wqtygrfduwgukk73m5gcnplmztc5tl5ngy0upqhns793",
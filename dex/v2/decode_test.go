@@ -0,0 +1,140 @@
+package v2_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	v2 "github.com/Newt6611/go-minswap/dex/v2"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+// testSteps returns one step of every type
+func testSteps() []v2.StepI {
+	swapAmount := v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: 10_000}
+	withdrawalAmount := v2.WithdrawalAmount{Type: v2.AmountType_All, LPAmount: 500}
+	return []v2.StepI{
+		v2.SwapExactIn{Direction: v2.Direction_A_To_B, SwapAmount: swapAmount, MinimumReceived: 1, Killable: v2.Killable_Kill_On_Failed},
+		v2.Stop{Direction: v2.Direction_B_To_A, SwapAmount: swapAmount, StopReceived: 2},
+		v2.OCO{Direction: v2.Direction_A_To_B, SwapAmount: swapAmount, MinimumReceived: 3, StopReceived: 4},
+		v2.SwapExactOut{Direction: v2.Direction_A_To_B, MaximumSwapAmount: swapAmount, ExpectedReceived: 5},
+		v2.Deposit{DepositAmount: v2.DepositAmount{DepositAmountA: 6, DepositAmountB: 7}, MinimumLP: 8},
+		v2.Withdraw{WithdrawalAmount: withdrawalAmount, MinimumAssetA: 9, MinimumAssetB: 10},
+		v2.ZapOut{Direction: v2.Direction_B_To_A, WithdrawalAmount: withdrawalAmount, MinimumReceived: 11},
+		v2.PartialSwap{Direction: v2.Direction_A_To_B, TotalSwapAmount: 12, IoRatioNumerator: 13, IoRatioDenominator: 14, Hops: 3, MinimumSwapAmountRequired: 15, MaxBatcherFeeEachTime: 16},
+		v2.WithdrawImbalance{WithdrawAmount: withdrawalAmount, RatioAssetA: 1, RatioAssetB: 2, MinimumAssetA: 17},
+		v2.SwapRouting{Routings: []v2.Route{{LPAsset: utils.MIN, Direction: v2.Direction_A_To_B}, {LPAsset: utils.MIN, Direction: v2.Direction_B_To_A}}, SwapAmount: swapAmount, MinimumReceived: 18},
+		v2.Donation{},
+	}
+}
+
+func orderDatumCbor(t testing.TB, datum v2.OrderDatum) []byte {
+	t.Helper()
+	plutusData := datum.ToPlutusData()
+	b, err := plutusData.MarshalCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOrderDatumFromPlutusData(t *testing.T) {
+	for _, step := range testSteps() {
+		for _, datum := range buildOrderDatum(step) {
+			datum.ExpiredOptions = v2.ExpirySetting{ExpiredTime: 1_700_000_000_000, MaxCancellationTip: 300_000}
+			b := orderDatumCbor(t, datum)
+
+			plutusData, err := utils.UnmarshalPlutusData(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := v2.OrderDatumFromPlutusData(&plutusData, c.TESTNET)
+			if err != nil {
+				t.Fatalf("OrderDatumFromPlutusData(%T) error: %s\n", step, err)
+			}
+			if decoded.RefundReceiver.String() != testSenderAddress.String() {
+				t.Errorf("RefundReceiver expect %s, but get %s\n", testSenderAddress.String(), decoded.RefundReceiver.String())
+			}
+			if !bytes.Equal(orderDatumCbor(t, decoded), b) {
+				t.Errorf("OrderDatumFromPlutusData(%T) does not round trip\n", step)
+			}
+		}
+	}
+}
+
+func TestOrderDatumFromPlutusDataDecodeError(t *testing.T) {
+	datum := buildOrderDatum(testSteps()[0])[0]
+	plutusData := datum.ToPlutusData()
+	fields := plutusData.Value.(PlutusData.PlutusIndefArray)
+	// MinimumReceived of the step as bytes
+	step := fields[6].Value.(PlutusData.PlutusIndefArray)
+	step[2] = PlutusData.PlutusData{PlutusDataType: PlutusData.PlutusBytes, Value: []byte{1}}
+
+	_, err := v2.OrderDatumFromPlutusData(&plutusData, c.TESTNET)
+	var decodeErr *utils.DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expect DecodeError, but get %v\n", err)
+	}
+	if decodeErr.Path != "OrderDatum.Step.MinimumReceived" {
+		t.Errorf("expect path OrderDatum.Step.MinimumReceived, but get %s\n", decodeErr.Path)
+	}
+}
+
+func fuzzDecoder(f *testing.F, seeds [][]byte, decode func(PlutusData.PlutusData) error) {
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		plutusData, err := utils.UnmarshalPlutusData(b)
+		if err != nil {
+			return
+		}
+		err = decode(plutusData)
+		var decodeErr *utils.DecodeError
+		if err != nil && !errors.As(err, &decodeErr) {
+			t.Errorf("expect DecodeError, but get %v", err)
+		}
+	})
+}
+
+func FuzzOrderDatumFromPlutusData(f *testing.F) {
+	seeds := [][]byte{}
+	for _, step := range testSteps() {
+		for _, datum := range buildOrderDatum(step) {
+			seeds = append(seeds, orderDatumCbor(f, datum))
+		}
+	}
+	fuzzDecoder(f, seeds, func(plutusData PlutusData.PlutusData) error {
+		_, err := v2.OrderDatumFromPlutusData(&plutusData, c.MAINNET)
+		return err
+	})
+}
+
+func FuzzStepFromPlutusData(f *testing.F) {
+	seeds := [][]byte{}
+	for _, step := range testSteps() {
+		plutusData := step.StepToPlutusData()
+		b, err := plutusData.MarshalCBOR()
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, b)
+	}
+	// a constructor past the last step
+	seeds = append(seeds, mustHex("d9050e80"))
+	fuzzDecoder(f, seeds, func(plutusData PlutusData.PlutusData) error {
+		_, err := v2.StepFromPlutusData(&plutusData)
+		return err
+	})
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package v2
+
+import (
+	"time"
+
+	"github.com/Newt6611/apollo/serialization/Address"
+)
+
+// OrderOption changes the datum of an order placed by the DexV2 builders. By
+// default builder's wallet receives the output and the refund without datum,
+// cancels with its signature and the order never expires
+type OrderOption func(*OrderDatum)
+
+// WithSuccessReceiver sends the output of the order to receiver with datum
+func WithSuccessReceiver(receiver Address.Address, datum ExtraDatum) OrderOption {
+	return func(orderDatum *OrderDatum) {
+		orderDatum.SuccessReceiver = receiver
+		orderDatum.SuccessReceiverDatum = datum
+	}
+}
+
+// WithRefundReceiver sends the refund of a cancelled or failed order to
+// receiver with datum
+func WithRefundReceiver(receiver Address.Address, datum ExtraDatum) OrderOption {
+	return func(orderDatum *OrderDatum) {
+		orderDatum.RefundReceiver = receiver
+		orderDatum.RefundReceiverDatum = datum
+	}
+}
+
+// WithCanceller lets canceller cancel the order instead of builder's wallet
+func WithCanceller(canceller AuthorizationMethod) OrderOption {
+	return func(orderDatum *OrderDatum) {
+		orderDatum.Canceller = canceller
+	}
+}
+
+// WithExpiry lets anyone cancel the order after expiredTime, paying themselves
+// at most maxCancellationTip lovelace from it
+func WithExpiry(expiredTime time.Time, maxCancellationTip uint64) OrderOption {
+	return func(orderDatum *OrderDatum) {
+		orderDatum.ExpiredOptions = ExpirySetting{
+			ExpiredTime:        uint64(expiredTime.UnixMilli()),
+			MaxCancellationTip: maxCancellationTip,
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package v2
 
 import (
-	"errors"
 	"fmt"
 
 	c "github.com/Newt6611/apollo/constants"
@@ -15,6 +14,10 @@ import (
 
 const (
 	FIXED_BATCHER_FEE = 2_000_000
+	// lovelace locked in an order to pay for the min ADA of its output
+	OUTPUT_ADA = 2_000_000
+	// number of fills a limit order pays batcher fees for
+	DEFAULT_LIMIT_ORDER_HOPS = 3
 )
 
 type AuthorizationMethodType int
@@ -33,19 +36,23 @@ type AuthorizationMethod struct {
 
 func AuthorizationMethodFromPlutusData(plutusData *PlutusData.PlutusData) (AuthorizationMethod, error) {
 	var authorizationMethod AuthorizationMethod
-	hash, ok := plutusData.Value.(PlutusData.PlutusIndefArray)[0].Value.([]byte)
-	if !ok {
-		return authorizationMethod, fmt.Errorf("invalid AuthorizationMethodFromPlutusData")
+	index, fields, err := utils.DecodeConstrOf(plutusData, "AuthorizationMethod", 1, 1, 1, 1)
+	if err != nil {
+		return authorizationMethod, err
+	}
+	hash, err := utils.DecodeBytes(&fields[0], "AuthorizationMethod.Hash")
+	if err != nil {
+		return authorizationMethod, err
 	}
 
-	authorizationMethod.Type = AuthorizationMethodType(plutusData.TagNr - 121)
+	authorizationMethod.Type = AuthorizationMethodType(index)
 	authorizationMethod.Hash = hash
 	return authorizationMethod, nil
 }
 
 func (a AuthorizationMethod) ToPlutusData() PlutusData.PlutusData {
 	return PlutusData.PlutusData{
-		TagNr:          121,
+		TagNr:          121 + uint64(a.Type),
 		PlutusDataType: PlutusData.PlutusArray,
 		Value: PlutusData.PlutusIndefArray{
 			PlutusData.PlutusData{
@@ -72,15 +79,18 @@ type ExtraDatum struct {
 
 func ExtraDatumFromPlutusData(plutusData *PlutusData.PlutusData) (ExtraDatum, error) {
 	var extraDatum ExtraDatum
-	data := plutusData.Value.(PlutusData.PlutusDefArray)
-	extraDatum.Type = ExtraDatumType(plutusData.TagNr - 121)
+	index, data, err := utils.DecodeConstrOf(plutusData, "ExtraDatum", 0, 1, 1)
+	if err != nil {
+		return extraDatum, err
+	}
+	extraDatum.Type = ExtraDatumType(index)
 	if len(data) == 0 {
 		return extraDatum, nil
 	}
 
-	hash, ok := data[0].Value.([]byte)
-	if !ok {
-		return extraDatum, fmt.Errorf("invalid ExtraDatumFromPlutusData")
+	hash, err := utils.DecodeBytes(&data[0], "ExtraDatum.Hash")
+	if err != nil {
+		return extraDatum, err
 	}
 
 	extraDatum.Hash = hash
@@ -133,11 +143,11 @@ const (
 )
 
 func DirectionFromPlutusData(plutusData *PlutusData.PlutusData) (Direction, error) {
-	direction := Direction(plutusData.TagNr - 121)
-	if direction != Direction_B_To_A && direction != Direction_A_To_B {
-		return direction, fmt.Errorf("invalid DirectionFromPlutusData")
+	index, _, err := utils.DecodeConstrOf(plutusData, "Direction", 0, 0)
+	if err != nil {
+		return 0, err
 	}
-	return direction, nil
+	return Direction(index), nil
 }
 
 func (d Direction) ToPlutusData() PlutusData.PlutusData {
@@ -162,10 +172,14 @@ type SwapAmount struct {
 
 func SwapAmountFromPlutusData(plutusData *PlutusData.PlutusData) (SwapAmount, error) {
 	var swapAmount SwapAmount
-	swapAmount.Type = AmountType(plutusData.TagNr - 121)
-	amount, ok := plutusData.Value.(PlutusData.PlutusIndefArray)[0].Value.(uint64)
-	if !ok {
-		return swapAmount, fmt.Errorf("invalid SwapAmountFromPlutusData")
+	index, data, err := utils.DecodeConstrOf(plutusData, "SwapAmount", 1, 1)
+	if err != nil {
+		return swapAmount, err
+	}
+	swapAmount.Type = AmountType(index)
+	amount, err := utils.DecodeUint(&data[0], "SwapAmount.Amount")
+	if err != nil {
+		return swapAmount, err
 	}
 	swapAmount.Amount = amount
 	return swapAmount, nil
@@ -193,11 +207,11 @@ const (
 )
 
 func KillableFromPlutusData(plutusData *PlutusData.PlutusData) (Killable, error) {
-	killable := Killable(plutusData.TagNr - 121)
-	if killable != Killable_Pending_On_Failed && killable != Killable_Kill_On_Failed {
-		return killable, fmt.Errorf("invalid KillableFromPlutusData")
+	index, _, err := utils.DecodeConstrOf(plutusData, "Killable", 0, 0)
+	if err != nil {
+		return 0, err
 	}
-	return killable, nil
+	return Killable(index), nil
 }
 
 func (k Killable) ToPlutusData() PlutusData.PlutusData {
@@ -216,18 +230,21 @@ type DepositAmount struct {
 
 func DepositAmountFromPlutusData(plutusData *PlutusData.PlutusData) (DepositAmount, error) {
 	var depositAmount DepositAmount
-	depositAmount.Type = AmountType(plutusData.TagNr - 121)
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
+	index, data, err := utils.DecodeConstrOf(plutusData, "DepositAmount", 2, 2)
+	if err != nil {
+		return depositAmount, err
+	}
+	depositAmount.Type = AmountType(index)
 
-	depositAmountA, ok := data[0].Value.(uint64)
-	if !ok {
-		return depositAmount, errors.New("invalid DepositAmountFromPlutusData DepositAmountA")
+	depositAmountA, err := utils.DecodeUint(&data[0], "DepositAmount.DepositAmountA")
+	if err != nil {
+		return depositAmount, err
 	}
 	depositAmount.DepositAmountA = depositAmountA
 
-	depositAmountB, ok := data[1].Value.(uint64)
-	if !ok {
-		return depositAmount, errors.New("invalid DepositAmountFromPlutusData DepositAmountB")
+	depositAmountB, err := utils.DecodeUint(&data[1], "DepositAmount.DepositAmountB")
+	if err != nil {
+		return depositAmount, err
 	}
 	depositAmount.DepositAmountB = depositAmountB
 
@@ -260,12 +277,15 @@ type WithdrawalAmount struct {
 
 func WithdrawAmountFromPlutusData(plutusData *PlutusData.PlutusData) (WithdrawalAmount, error) {
 	var withdrawAmount WithdrawalAmount
-	withdrawAmount.Type = AmountType(plutusData.TagNr - 121)
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
+	index, data, err := utils.DecodeConstrOf(plutusData, "WithdrawalAmount", 1, 1)
+	if err != nil {
+		return withdrawAmount, err
+	}
+	withdrawAmount.Type = AmountType(index)
 
-	lpAmount, ok := data[0].Value.(uint64)
-	if !ok {
-		return withdrawAmount, errors.New("invalid WithdrawAmountFromPlutusData LPAmount")
+	lpAmount, err := utils.DecodeUint(&data[0], "WithdrawalAmount.LPAmount")
+	if err != nil {
+		return withdrawAmount, err
 	}
 	withdrawAmount.LPAmount = lpAmount
 
@@ -292,17 +312,19 @@ type Route struct {
 }
 
 func RouteFromPlutusData(plutusData *PlutusData.PlutusData) (Route, error) {
-	var err error
 	var route Route
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
-	route.LPAsset, err = utils.FingerprintFromPlutusData(&data[0])
+	data, err := utils.DecodeConstrFields(plutusData, "Route", 0, 2)
 	if err != nil {
 		return route, err
 	}
+	route.LPAsset, err = utils.FingerprintFromPlutusData(&data[0])
+	if err != nil {
+		return route, utils.NestDecodeError(err, "Route.LPAsset")
+	}
 
 	route.Direction, err = DirectionFromPlutusData(&data[1])
 	if err != nil {
-		return route, err
+		return route, utils.NestDecodeError(err, "Route.Direction")
 	}
 
 	return route, nil
@@ -325,14 +347,41 @@ type StepI interface {
 	StepToPlutusData() PlutusData.PlutusData
 }
 
+// stepType returns the StepType of step, -1 for an unknown step
+func stepType(step StepI) StepType {
+	switch step.(type) {
+	case SwapExactIn:
+		return StepType_Swap_Exact_In
+	case Stop:
+		return StepType_Stop
+	case OCO:
+		return StepType_OCO
+	case SwapExactOut:
+		return StepType_Swap_Exact_Out
+	case Deposit:
+		return StepType_Deposit
+	case Withdraw:
+		return StepType_Withdraw
+	case ZapOut:
+		return StepType_Zap_Out
+	case PartialSwap:
+		return StepType_Partial_Swap
+	case WithdrawImbalance:
+		return StepType_Withdraw_Imbalance
+	case SwapRouting:
+		return StepType_Swap_Routing
+	case Donation:
+		return StepType_Donation
+	}
+	return -1
+}
+
 func StepFromPlutusData(plutusData *PlutusData.PlutusData) (StepI, error) {
-	var stepType StepType
-	if plutusData.TagNr >= 121 && plutusData.TagNr <= 127 {
-		stepType = StepType(plutusData.TagNr - 121)
-	} else if plutusData.TagNr >= 1280 && plutusData.TagNr <= 1400 {
-		stepType = StepType(plutusData.TagNr - 1280 + 7)
+	index, _, err := utils.DecodeConstr(plutusData, "Step")
+	if err != nil {
+		return nil, err
 	}
-	switch stepType {
+	switch StepType(index) {
 	case StepType_Swap_Exact_In:
 		return SwapExactInFromPlutusData(plutusData)
 	case StepType_Stop:
@@ -357,7 +406,7 @@ func StepFromPlutusData(plutusData *PlutusData.PlutusData) (StepI, error) {
 		return DonationFromPlutusData(plutusData)
 	}
 
-	return nil, fmt.Errorf("invalid StepFromPlutusData")
+	return nil, &utils.DecodeError{Path: "Step", Expected: "constructor 0 to 10", Got: fmt.Sprintf("constructor %d", index)}
 }
 
 type SwapExactIn struct {
@@ -369,32 +418,32 @@ type SwapExactIn struct {
 }
 
 func SwapExactInFromPlutusData(plutusData *PlutusData.PlutusData) (SwapExactIn, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var swapExactIn SwapExactIn
+	data, err := utils.DecodeConstrFields(plutusData, "SwapExactIn", uint64(StepType_Swap_Exact_In), 4)
+	if err != nil {
+		return swapExactIn, err
+	}
 
 	swapExactIn.Type = StepType_Swap_Exact_In
 	swapExactIn.Direction, err = DirectionFromPlutusData(&data[0])
 	if err != nil {
-		return swapExactIn, err
+		return swapExactIn, utils.NestDecodeError(err, "SwapExactIn.Direction")
 	}
 
 	swapExactIn.SwapAmount, err = SwapAmountFromPlutusData(&data[1])
 	if err != nil {
-		return swapExactIn, err
+		return swapExactIn, utils.NestDecodeError(err, "SwapExactIn.SwapAmount")
 	}
 
-	minimumReceived, ok := data[2].Value.(uint64)
-	if !ok {
-		return swapExactIn, fmt.Errorf("invalid SwapExactInFromPlutusData")
+	swapExactIn.MinimumReceived, err = utils.DecodeUint(&data[2], "SwapExactIn.MinimumReceived")
+	if err != nil {
+		return swapExactIn, err
 	}
-	swapExactIn.MinimumReceived = minimumReceived
 
-	killable, err := KillableFromPlutusData(&data[3])
+	swapExactIn.Killable, err = KillableFromPlutusData(&data[3])
 	if err != nil {
-		return swapExactIn, err
+		return swapExactIn, utils.NestDecodeError(err, "SwapExactIn.Killable")
 	}
-	swapExactIn.Killable = killable
 
 	return swapExactIn, nil
 }
@@ -423,26 +472,27 @@ type Stop struct {
 }
 
 func StopFromPlutusData(plutusData *PlutusData.PlutusData) (Stop, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var stop Stop
+	data, err := utils.DecodeConstrFields(plutusData, "Stop", uint64(StepType_Stop), 3)
+	if err != nil {
+		return stop, err
+	}
 
 	stop.Type = StepType_Stop
 	stop.Direction, err = DirectionFromPlutusData(&data[0])
 	if err != nil {
-		return stop, err
+		return stop, utils.NestDecodeError(err, "Stop.Direction")
 	}
 
 	stop.SwapAmount, err = SwapAmountFromPlutusData(&data[1])
 	if err != nil {
-		return stop, err
+		return stop, utils.NestDecodeError(err, "Stop.SwapAmount")
 	}
 
-	stopReceived, ok := data[2].Value.(uint64)
-	if !ok {
-		return stop, fmt.Errorf("invalid StopFromPlutusData")
+	stop.StopReceived, err = utils.DecodeUint(&data[2], "Stop.StopReceived")
+	if err != nil {
+		return stop, err
 	}
-	stop.StopReceived = stopReceived
 
 	return stop, nil
 }
@@ -472,32 +522,32 @@ type OCO struct {
 }
 
 func OCOFromPlutusData(plutusData *PlutusData.PlutusData) (OCO, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var oco OCO
+	data, err := utils.DecodeConstrFields(plutusData, "OCO", uint64(StepType_OCO), 4)
+	if err != nil {
+		return oco, err
+	}
 
 	oco.Type = StepType_OCO
 	oco.Direction, err = DirectionFromPlutusData(&data[0])
 	if err != nil {
-		return oco, err
+		return oco, utils.NestDecodeError(err, "OCO.Direction")
 	}
 
 	oco.SwapAmount, err = SwapAmountFromPlutusData(&data[1])
 	if err != nil {
-		return oco, err
+		return oco, utils.NestDecodeError(err, "OCO.SwapAmount")
 	}
 
-	minimumReceived, ok := data[2].Value.(uint64)
-	if !ok {
-		return oco, fmt.Errorf("invalid OCOFromPlutusData")
+	oco.MinimumReceived, err = utils.DecodeUint(&data[2], "OCO.MinimumReceived")
+	if err != nil {
+		return oco, err
 	}
-	oco.MinimumReceived = minimumReceived
 
-	stopReceived, ok := data[3].Value.(uint64)
-	if !ok {
-		return oco, fmt.Errorf("invalid OCOFromPlutusData")
+	oco.StopReceived, err = utils.DecodeUint(&data[3], "OCO.StopReceived")
+	if err != nil {
+		return oco, err
 	}
-	oco.StopReceived = stopReceived
 
 	return oco, nil
 }
@@ -532,32 +582,32 @@ type SwapExactOut struct {
 }
 
 func SwapExactOutFromPlutusData(plutusData *PlutusData.PlutusData) (SwapExactOut, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var swapExactOut SwapExactOut
+	data, err := utils.DecodeConstrFields(plutusData, "SwapExactOut", uint64(StepType_Swap_Exact_Out), 4)
+	if err != nil {
+		return swapExactOut, err
+	}
 
 	swapExactOut.Type = StepType_Swap_Exact_Out
 	swapExactOut.Direction, err = DirectionFromPlutusData(&data[0])
 	if err != nil {
-		return swapExactOut, err
+		return swapExactOut, utils.NestDecodeError(err, "SwapExactOut.Direction")
 	}
 
 	swapExactOut.MaximumSwapAmount, err = SwapAmountFromPlutusData(&data[1])
 	if err != nil {
-		return swapExactOut, err
+		return swapExactOut, utils.NestDecodeError(err, "SwapExactOut.MaximumSwapAmount")
 	}
 
-	expectedReceived, ok := data[2].Value.(uint64)
-	if !ok {
-		return swapExactOut, fmt.Errorf("invalid SwapExactOutFromPlutusData")
+	swapExactOut.ExpectedReceived, err = utils.DecodeUint(&data[2], "SwapExactOut.ExpectedReceived")
+	if err != nil {
+		return swapExactOut, err
 	}
-	swapExactOut.ExpectedReceived = expectedReceived
 
-	killable, err := KillableFromPlutusData(&data[3])
+	swapExactOut.Killable, err = KillableFromPlutusData(&data[3])
 	if err != nil {
-		return swapExactOut, err
+		return swapExactOut, utils.NestDecodeError(err, "SwapExactOut.Killable")
 	}
-	swapExactOut.Killable = killable
 
 	return swapExactOut, nil
 }
@@ -587,27 +637,27 @@ type Deposit struct {
 }
 
 func DepositFromPlutusData(plutusData *PlutusData.PlutusData) (Deposit, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var deposit Deposit
+	data, err := utils.DecodeConstrFields(plutusData, "Deposit", uint64(StepType_Deposit), 3)
+	if err != nil {
+		return deposit, err
+	}
 
 	deposit.Type = StepType_Deposit
 	deposit.DepositAmount, err = DepositAmountFromPlutusData(&data[0])
 	if err != nil {
-		return deposit, err
+		return deposit, utils.NestDecodeError(err, "Deposit.DepositAmount")
 	}
 
-	minimumLP, ok := data[1].Value.(uint64)
-	if !ok {
-		return deposit, fmt.Errorf("invalid DepositFromPlutusData")
+	deposit.MinimumLP, err = utils.DecodeUint(&data[1], "Deposit.MinimumLP")
+	if err != nil {
+		return deposit, err
 	}
-	deposit.MinimumLP = minimumLP
 
-	killable, err := KillableFromPlutusData(&data[2])
+	deposit.Killable, err = KillableFromPlutusData(&data[2])
 	if err != nil {
-		return deposit, err
+		return deposit, utils.NestDecodeError(err, "Deposit.Killable")
 	}
-	deposit.Killable = killable
 
 	return deposit, nil
 }
@@ -637,33 +687,32 @@ type Withdraw struct {
 }
 
 func WithdrawFromPlutusData(plutusData *PlutusData.PlutusData) (Withdraw, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var withdraw Withdraw
+	data, err := utils.DecodeConstrFields(plutusData, "Withdraw", uint64(StepType_Withdraw), 4)
+	if err != nil {
+		return withdraw, err
+	}
 
 	withdraw.Type = StepType_Withdraw
 	withdraw.WithdrawalAmount, err = WithdrawAmountFromPlutusData(&data[0])
 	if err != nil {
-		return withdraw, err
+		return withdraw, utils.NestDecodeError(err, "Withdraw.WithdrawalAmount")
 	}
 
-	minimumAssetA, ok := data[1].Value.(uint64)
-	if !ok {
-		return withdraw, fmt.Errorf("invalid WithdrawFromPlutusData")
+	withdraw.MinimumAssetA, err = utils.DecodeUint(&data[1], "Withdraw.MinimumAssetA")
+	if err != nil {
+		return withdraw, err
 	}
-	withdraw.MinimumAssetA = minimumAssetA
 
-	minimumAssetB, ok := data[2].Value.(uint64)
-	if !ok {
-		return withdraw, fmt.Errorf("invalid WithdrawFromPlutusData")
+	withdraw.MinimumAssetB, err = utils.DecodeUint(&data[2], "Withdraw.MinimumAssetB")
+	if err != nil {
+		return withdraw, err
 	}
-	withdraw.MinimumAssetB = minimumAssetB
 
-	killable, err := KillableFromPlutusData(&data[3])
+	withdraw.Killable, err = KillableFromPlutusData(&data[3])
 	if err != nil {
-		return withdraw, err
+		return withdraw, utils.NestDecodeError(err, "Withdraw.Killable")
 	}
-	withdraw.Killable = killable
 
 	return withdraw, nil
 }
@@ -698,32 +747,32 @@ type ZapOut struct {
 }
 
 func ZapOutFromPlutusData(plutusData *PlutusData.PlutusData) (ZapOut, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var zapOut ZapOut
+	data, err := utils.DecodeConstrFields(plutusData, "ZapOut", uint64(StepType_Zap_Out), 4)
+	if err != nil {
+		return zapOut, err
+	}
 
 	zapOut.Type = StepType_Zap_Out
 	zapOut.Direction, err = DirectionFromPlutusData(&data[0])
 	if err != nil {
-		return zapOut, err
+		return zapOut, utils.NestDecodeError(err, "ZapOut.Direction")
 	}
 
 	zapOut.WithdrawalAmount, err = WithdrawAmountFromPlutusData(&data[1])
 	if err != nil {
-		return zapOut, err
+		return zapOut, utils.NestDecodeError(err, "ZapOut.WithdrawalAmount")
 	}
 
-	minimumReceived, ok := data[2].Value.(uint64)
-	if !ok {
-		return zapOut, fmt.Errorf("invalid ZapOutFromPlutusData")
+	zapOut.MinimumReceived, err = utils.DecodeUint(&data[2], "ZapOut.MinimumReceived")
+	if err != nil {
+		return zapOut, err
 	}
-	zapOut.MinimumReceived = minimumReceived
 
-	killable, err := KillableFromPlutusData(&data[3])
+	zapOut.Killable, err = KillableFromPlutusData(&data[3])
 	if err != nil {
-		return zapOut, err
+		return zapOut, utils.NestDecodeError(err, "ZapOut.Killable")
 	}
-	zapOut.Killable = killable
 
 	return zapOut, nil
 }
@@ -757,51 +806,35 @@ type PartialSwap struct {
 }
 
 func PartialSwapFromPlutusData(plutusData *PlutusData.PlutusData) (PartialSwap, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var partialSwap PartialSwap
-
-	partialSwap.Type = StepType_Partial_Swap
-	partialSwap.Direction, err = DirectionFromPlutusData(&data[0])
+	data, err := utils.DecodeConstrFields(plutusData, "PartialSwap", uint64(StepType_Partial_Swap), 7)
 	if err != nil {
 		return partialSwap, err
 	}
 
-	totalSwapAmount, ok := data[1].Value.(uint64)
-	if !ok {
-		return partialSwap, fmt.Errorf("invalid PartialSwapFromPlutusData")
-	}
-	partialSwap.TotalSwapAmount = totalSwapAmount
-
-	ioRatioNumerator, ok := data[2].Value.(uint64)
-	if !ok {
-		return partialSwap, fmt.Errorf("invalid PartialSwapFromPlutusData")
-	}
-	partialSwap.IoRatioNumerator = ioRatioNumerator
-
-	ioRatioDenominator, ok := data[3].Value.(uint64)
-	if !ok {
-		return partialSwap, fmt.Errorf("invalid PartialSwapFromPlutusData")
-	}
-	partialSwap.IoRatioDenominator = ioRatioDenominator
-
-	hops, ok := data[4].Value.(uint64)
-	if !ok {
-		return partialSwap, fmt.Errorf("invalid PartialSwapFromPlutusData")
-	}
-	partialSwap.Hops = hops
-
-	minimumSwapAmountRequired, ok := data[5].Value.(uint64)
-	if !ok {
-		return partialSwap, fmt.Errorf("invalid PartialSwapFromPlutusData")
-	}
-	partialSwap.MinimumSwapAmountRequired = minimumSwapAmountRequired
-
-	maxBatcherFeeEachTime, ok := data[6].Value.(uint64)
-	if !ok {
-		return partialSwap, fmt.Errorf("invalid PartialSwapFromPlutusData")
+	partialSwap.Type = StepType_Partial_Swap
+	partialSwap.Direction, err = DirectionFromPlutusData(&data[0])
+	if err != nil {
+		return partialSwap, utils.NestDecodeError(err, "PartialSwap.Direction")
+	}
+
+	amounts := []struct {
+		field *uint64
+		name  string
+	}{
+		{&partialSwap.TotalSwapAmount, "TotalSwapAmount"},
+		{&partialSwap.IoRatioNumerator, "IoRatioNumerator"},
+		{&partialSwap.IoRatioDenominator, "IoRatioDenominator"},
+		{&partialSwap.Hops, "Hops"},
+		{&partialSwap.MinimumSwapAmountRequired, "MinimumSwapAmountRequired"},
+		{&partialSwap.MaxBatcherFeeEachTime, "MaxBatcherFeeEachTime"},
+	}
+	for i, amount := range amounts {
+		*amount.field, err = utils.DecodeUint(&data[1+i], "PartialSwap."+amount.name)
+		if err != nil {
+			return partialSwap, err
+		}
 	}
-	partialSwap.MaxBatcherFeeEachTime = maxBatcherFeeEachTime
 
 	return partialSwap, nil
 }
@@ -856,39 +889,37 @@ type WithdrawImbalance struct {
 }
 
 func WithdrawImbalanceFromPlutusData(plutusData *PlutusData.PlutusData) (WithdrawImbalance, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var withdrawImbalance WithdrawImbalance
+	data, err := utils.DecodeConstrFields(plutusData, "WithdrawImbalance", uint64(StepType_Withdraw_Imbalance), 5)
+	if err != nil {
+		return withdrawImbalance, err
+	}
 
 	withdrawImbalance.Type = StepType_Withdraw_Imbalance
 	withdrawImbalance.WithdrawAmount, err = WithdrawAmountFromPlutusData(&data[0])
 	if err != nil {
-		return withdrawImbalance, err
+		return withdrawImbalance, utils.NestDecodeError(err, "WithdrawImbalance.WithdrawAmount")
 	}
 
-	ratioAssetA, ok := data[1].Value.(uint64)
-	if !ok {
-		return withdrawImbalance, fmt.Errorf("invalid WithdrawImbalanceFromPlutusData")
+	withdrawImbalance.RatioAssetA, err = utils.DecodeUint(&data[1], "WithdrawImbalance.RatioAssetA")
+	if err != nil {
+		return withdrawImbalance, err
 	}
-	withdrawImbalance.RatioAssetA = ratioAssetA
 
-	ratioAssetB, ok := data[2].Value.(uint64)
-	if !ok {
-		return withdrawImbalance, fmt.Errorf("invalid WithdrawImbalanceFromPlutusData")
+	withdrawImbalance.RatioAssetB, err = utils.DecodeUint(&data[2], "WithdrawImbalance.RatioAssetB")
+	if err != nil {
+		return withdrawImbalance, err
 	}
-	withdrawImbalance.RatioAssetB = ratioAssetB
 
-	minimumAssetA, ok := data[3].Value.(uint64)
-	if !ok {
-		return withdrawImbalance, fmt.Errorf("invalid WithdrawImbalanceFromPlutusData")
+	withdrawImbalance.MinimumAssetA, err = utils.DecodeUint(&data[3], "WithdrawImbalance.MinimumAssetA")
+	if err != nil {
+		return withdrawImbalance, err
 	}
-	withdrawImbalance.MinimumAssetA = minimumAssetA
 
-	killable, err := KillableFromPlutusData(&data[4])
+	withdrawImbalance.Killable, err = KillableFromPlutusData(&data[4])
 	if err != nil {
-		return withdrawImbalance, err
+		return withdrawImbalance, utils.NestDecodeError(err, "WithdrawImbalance.Killable")
 	}
-	withdrawImbalance.Killable = killable
 
 	return withdrawImbalance, nil
 }
@@ -927,31 +958,35 @@ type SwapRouting struct {
 }
 
 func SwapRoutingFromPlutusData(plutusData *PlutusData.PlutusData) (SwapRouting, error) {
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
 	var swapRouting SwapRouting
+	data, err := utils.DecodeConstrFields(plutusData, "SwapRouting", uint64(StepType_Swap_Routing), 3)
+	if err != nil {
+		return swapRouting, err
+	}
 
 	swapRouting.Type = StepType_Swap_Routing
 
-	routingData := data[0].Value.(PlutusData.PlutusIndefArray)
-	for _, r := range routingData {
+	routingData, err := utils.DecodeList(&data[0], "SwapRouting.Routings")
+	if err != nil {
+		return swapRouting, err
+	}
+	for i, r := range routingData {
 		route, err := RouteFromPlutusData(&r)
 		if err != nil {
-			return swapRouting, err
+			return swapRouting, utils.NestDecodeError(err, fmt.Sprintf("SwapRouting.Routings[%d]", i))
 		}
 		swapRouting.Routings = append(swapRouting.Routings, route)
 	}
 
 	swapRouting.SwapAmount, err = SwapAmountFromPlutusData(&data[1])
 	if err != nil {
-		return swapRouting, err
+		return swapRouting, utils.NestDecodeError(err, "SwapRouting.SwapAmount")
 	}
 
-	minimumReceived, ok := data[2].Value.(uint64)
-	if !ok {
-		return swapRouting, fmt.Errorf("invalid SwapRoutingFromPlutusData")
+	swapRouting.MinimumReceived, err = utils.DecodeUint(&data[2], "SwapRouting.MinimumReceived")
+	if err != nil {
+		return swapRouting, err
 	}
-	swapRouting.MinimumReceived = minimumReceived
 
 	return swapRouting, nil
 }
@@ -988,7 +1023,11 @@ type Donation struct {
 
 func DonationFromPlutusData(plutusData *PlutusData.PlutusData) (Donation, error) {
 	var donation Donation
-	donation.Type = StepType(plutusData.TagNr - 121)
+	_, err := utils.DecodeConstrFields(plutusData, "Donation", uint64(StepType_Donation), 0)
+	if err != nil {
+		return donation, err
+	}
+	donation.Type = StepType_Donation
 	return donation, nil
 }
 
@@ -1007,11 +1046,20 @@ type ExpirySetting struct {
 
 func ExpirySettingFromPlutusData(plutusData *PlutusData.PlutusData) (ExpirySetting, error) {
 	var expirySetting ExpirySetting
-	data := plutusData.Value.(PlutusData.PlutusDefArray)
+	index, data, err := utils.DecodeConstrOf(plutusData, "ExpirySetting", 2, 0)
+	if err != nil {
+		return expirySetting, err
+	}
 
-	if plutusData.TagNr == 121 {
-		expirySetting.ExpiredTime = data[0].Value.(uint64)
-		expirySetting.MaxCancellationTip = data[1].Value.(uint64)
+	if index == 0 {
+		expirySetting.ExpiredTime, err = utils.DecodeUint(&data[0], "ExpirySetting.ExpiredTime")
+		if err != nil {
+			return expirySetting, err
+		}
+		expirySetting.MaxCancellationTip, err = utils.DecodeUint(&data[1], "ExpirySetting.MaxCancellationTip")
+		if err != nil {
+			return expirySetting, err
+		}
 	}
 
 	return expirySetting, nil
@@ -1058,47 +1106,60 @@ type OrderDatum struct {
 
 func OrderDatumFromPlutusData(plutusData *PlutusData.PlutusData, networkId c.Network) (OrderDatum, error) {
 	var orderDatum OrderDatum
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
+	data, err := utils.DecodeConstrFields(plutusData, "OrderDatum", 0, 9)
+	if err != nil {
+		return orderDatum, err
+	}
 
 	canceller, err := AuthorizationMethodFromPlutusData(&data[0])
 	if err != nil {
-		return orderDatum, err
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.Canceller")
 	}
 	orderDatum.Canceller = canceller
 
-	refundReceiver := plutusencoder.DecodePlutusAddress(data[1], byte(networkId))
+	refundReceiver, err := utils.AddressFromPlutusData(&data[1], networkId)
+	if err != nil {
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.RefundReceiver")
+	}
 	orderDatum.RefundReceiver = refundReceiver
 
 	refundReceiverDatum, err := ExtraDatumFromPlutusData(&data[2])
 	if err != nil {
-		return orderDatum, err
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.RefundReceiverDatum")
 	}
 	orderDatum.RefundReceiverDatum = refundReceiverDatum
 
-	successReceiver := plutusencoder.DecodePlutusAddress(data[3], byte(networkId))
+	successReceiver, err := utils.AddressFromPlutusData(&data[3], networkId)
+	if err != nil {
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.SuccessReceiver")
+	}
 	orderDatum.SuccessReceiver = successReceiver
 
 	successReceiverDatum, err := ExtraDatumFromPlutusData(&data[4])
 	if err != nil {
-		return orderDatum, err
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.SuccessReceiverDatum")
 	}
 	orderDatum.SuccessReceiverDatum = successReceiverDatum
 
 	lpAsset, err := utils.FingerprintFromPlutusData(&data[5])
 	if err != nil {
-		return orderDatum, err
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.LpAsset")
 	}
 	orderDatum.LpAsset = lpAsset
 
 	orderDatum.Step, err = StepFromPlutusData(&data[6])
+	if err != nil {
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.Step")
+	}
+
+	orderDatum.MaxBatcherFee, err = utils.DecodeUint(&data[7], "OrderDatum.MaxBatcherFee")
 	if err != nil {
 		return orderDatum, err
 	}
 
-	orderDatum.MaxBatcherFee = data[7].Value.(uint64)
 	orderDatum.ExpiredOptions, err = ExpirySettingFromPlutusData(&data[8])
 	if err != nil {
-		return orderDatum, err
+		return orderDatum, utils.NestDecodeError(err, "OrderDatum.ExpiredOptions")
 	}
 
 	return orderDatum, nil
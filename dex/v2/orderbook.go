@@ -0,0 +1,126 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/serialization/Value"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+// Order is an order waiting at the V2 order script
+type Order struct {
+	OutRef constants.OutRef
+	// the order address, the order script staked with Owner
+	Address Address.Address
+	// assets locked in the order, including the batcher fee and the output ADA
+	Value Value.Value
+	Datum OrderDatum
+	// the pool of Datum.LpAsset, zero when no such pool is found
+	Pool utils.V2PoolState
+	// stake credential hash of Address, the order builders take it from the
+	// sender's address. Empty for orders at the enterprise order address
+	Owner []byte
+}
+
+// OrderFilter selects the orders returned by GetOpenOrders, zero fields match
+// every order
+type OrderFilter struct {
+	// stake credential hash of the order address
+	Owner []byte
+	// LP asset of the pool the order is placed on
+	LpAsset   *Fingerprint.Fingerprint
+	StepTypes []StepType
+}
+
+// matchDatum checks the filters on the order datum, Owner is checked first as
+// it does not need the datum
+func (f OrderFilter) matchDatum(orderDatum OrderDatum) bool {
+	if f.LpAsset != nil && f.LpAsset.String() != orderDatum.LpAsset.String() {
+		return false
+	}
+	if len(f.StepTypes) != 0 && !slices.Contains(f.StepTypes, stepType(orderDatum.Step)) {
+		return false
+	}
+	return true
+}
+
+// GetOpenOrders lists the orders at the V2 order script matching filter. An
+// output that cannot be decoded as an order is skipped and reported in the
+// returned errors together with adapter failures
+func (d *DexV2) GetOpenOrders(ctx context.Context, filter OrderFilter) ([]Order, []error) {
+	networkId := d.adapter.NetworkId()
+	utxos, errs := d.adapter.GetV2OrderUtxos(ctx)
+
+	orders := []Order{}
+	for _, utxo := range utxos {
+		addr := utxo.Output.GetAddress()
+		owner := addr.StakingPart
+		if len(filter.Owner) != 0 && !bytes.Equal(filter.Owner, owner) {
+			continue
+		}
+
+		orderDatum, err := d.orderDatumOf(ctx, utxo)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %s: %w", utxo.GetKey(), err))
+			continue
+		}
+		if !filter.matchDatum(orderDatum) {
+			continue
+		}
+		orders = append(orders, Order{
+			OutRef: constants.OutRef{
+				TxHash: hex.EncodeToString(utxo.Input.TransactionId),
+				Index:  utxo.Input.Index,
+			},
+			Address: addr,
+			Value:   utxo.Output.GetValue(),
+			Datum:   orderDatum,
+			Owner:   owner,
+		})
+	}
+	if len(orders) == 0 {
+		return orders, errs
+	}
+
+	pools, poolErrs := d.adapter.GetV2PoolAll(ctx)
+	errs = append(errs, poolErrs...)
+	poolsByLpAsset := make(map[string]utils.V2PoolState, len(pools))
+	for _, pool := range pools {
+		lp, err := lpAsset(networkId, pool.AssetA, pool.AssetB)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		poolsByLpAsset[lp.String()] = pool
+	}
+	for i := range orders {
+		orders[i].Pool = poolsByLpAsset[orders[i].Datum.LpAsset.String()]
+	}
+	return orders, errs
+}
+
+// orderDatumOf decodes the inline datum of utxo, or the datum of its hash
+func (d *DexV2) orderDatumOf(ctx context.Context, utxo UTxO.UTxO) (OrderDatum, error) {
+	networkId := d.adapter.NetworkId()
+	if datum := utxo.Output.GetDatum(); datum != nil {
+		return OrderDatumFromPlutusData(datum, networkId)
+	}
+	dataHash := utxo.Output.GetDatumHash()
+	if dataHash == nil || len(dataHash.Payload) == 0 {
+		return OrderDatum{}, errors.New("utxo without Datum Hash or Inline Datum")
+	}
+	datum, err := d.datumByHash(ctx, dataHash.Payload)
+	if err != nil {
+		return OrderDatum{}, err
+	}
+	return OrderDatumFromPlutusData(&datum, networkId)
+}
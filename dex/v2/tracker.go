@@ -0,0 +1,382 @@
+package v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
+	"github.com/Newt6611/apollo/serialization/TransactionInput"
+	"github.com/Newt6611/apollo/serialization/TransactionOutput"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/serialization/Value"
+	"github.com/Newt6611/go-minswap/adapter"
+	"github.com/Newt6611/go-minswap/constants"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+type OrderStatus int
+
+const (
+	// the order is still at the order script
+	OrderStatus_Pending OrderStatus = iota
+	// applied to its pool by a batcher
+	OrderStatus_Executed
+	// cancelled by its canceller
+	OrderStatus_Cancelled
+	// cancelled by anyone after its expiry
+	OrderStatus_Expired
+)
+
+// OrderTrack is the state of an order reported by TrackOrder
+type OrderTrack struct {
+	Status OrderStatus
+	Datum  OrderDatum
+	// hash of the transaction spending the order, empty while pending
+	SpentBy string
+	// assets paid to Datum.SuccessReceiver, set once executed. Among several
+	// orders of one receiver it assumes the outputs follow the inputs
+	Received Value.Value
+	// lovelace the batcher kept from the order, set once executed
+	BatcherFee uint64
+	// BatcherFee is a share of the batch fee rather than the order's own, it
+	// may differ from what the batcher actually kept from the order
+	BatcherFeeEstimated bool
+}
+
+// TrackOrder follows the order at outRef to the transaction spending it and
+// classifies it from the order redeemer.
+//
+// The transaction does not say which output pays which order, nor how much
+// ADA of an order went to its pool, so an executed order relies on two
+// heuristics:
+//
+//   - Received is the output paid to SuccessReceiver. The batcher is assumed
+//     to pay orders in the order of their inputs, so the n-th order of a
+//     receiver gets its n-th output. A batch paying them in another order
+//     swaps what they received.
+//   - When the pool does not hold ADA, the ADA the order loses is the batcher
+//     fee. Otherwise the fee is the ADA the order loses net of the ADA it swaps
+//     into the pool, which the datum fixes for swaps from ADA and deposits of
+//     a specific amount. For the other orders the ADA the pool does not gain
+//     is the batch fee, what the fixed orders did not pay of it is shared by
+//     MaxBatcherFee and BatcherFeeEstimated is set. Such a fee is an estimate
+//     and may differ from what the batcher kept from the order.
+//
+// The fee is at most the MaxBatcherFee of the order
+func (d *DexV2) TrackOrder(ctx context.Context, outRef constants.OutRef) (OrderTrack, error) {
+	spending, err := d.adapter.GetSpendingTx(ctx, outRef.TxHash, outRef.Index)
+	if err != nil {
+		return OrderTrack{}, err
+	}
+	if spending == nil {
+		orderUtxo := d.adapter.GetUtxoFromRef(ctx, outRef.TxHash, outRef.Index)
+		if orderUtxo == nil {
+			return OrderTrack{}, fmt.Errorf("cannot find order %s#%d", outRef.TxHash, outRef.Index)
+		}
+		orderDatum, err := d.orderDatumOf(ctx, *orderUtxo)
+		if err != nil {
+			return OrderTrack{}, err
+		}
+		return OrderTrack{Status: OrderStatus_Pending, Datum: orderDatum}, nil
+	}
+
+	batch, err := newSpendingBatch(spending)
+	if err != nil {
+		return OrderTrack{}, err
+	}
+	orderUtxo, ok := batch.input(outRef)
+	if !ok {
+		return OrderTrack{}, fmt.Errorf("transaction %s does not spend order %s#%d", spending.TxHash, outRef.TxHash, outRef.Index)
+	}
+	orderDatum, err := d.orderDatumOf(ctx, orderUtxo)
+	if err != nil {
+		return OrderTrack{}, err
+	}
+	track := OrderTrack{
+		Datum:   orderDatum,
+		SpentBy: spending.TxHash,
+	}
+
+	action, err := batch.orderAction(orderUtxo.Input)
+	if err != nil {
+		return OrderTrack{}, err
+	}
+	switch action {
+	case 1:
+		track.Status = OrderStatus_Cancelled
+		return track, nil
+	case 2:
+		track.Status = OrderStatus_Expired
+		return track, nil
+	}
+	track.Status = OrderStatus_Executed
+
+	orderScriptHash := constants.V2Config[d.adapter.NetworkId()].OrderScriptHash
+	applied := []appliedOrder{}
+	for _, input := range batch.inputs {
+		addr := input.Output.GetAddress()
+		if hex.EncodeToString(addr.PaymentPart) != orderScriptHash {
+			continue
+		}
+		action, err := batch.orderAction(input.Input)
+		if err != nil || action != 0 {
+			continue
+		}
+		datum := orderDatum
+		if !sameInput(input.Input, orderUtxo.Input) {
+			datum, err = d.orderDatumOf(ctx, input)
+			if err != nil {
+				return OrderTrack{}, fmt.Errorf("order %s: %w", input.GetKey(), err)
+			}
+		}
+		applied = append(applied, appliedOrder{utxo: input, datum: datum})
+	}
+
+	received, err := batch.receivedBy(applied, orderUtxo.Input)
+	if err != nil {
+		return OrderTrack{}, err
+	}
+	track.Received = received
+	track.BatcherFee, track.BatcherFeeEstimated, err = batch.batcherFee(d.adapter.NetworkId(), applied, appliedOrder{utxo: orderUtxo, datum: orderDatum}, received)
+	if err != nil {
+		return OrderTrack{}, err
+	}
+	return track, nil
+}
+
+type appliedOrder struct {
+	utxo  UTxO.UTxO
+	datum OrderDatum
+}
+
+// spendingBatch is a transaction spending an order with its inputs sorted the
+// way the ledger indexes spend redeemers
+type spendingBatch struct {
+	tx     *adapter.SpendingTx
+	inputs []UTxO.UTxO
+}
+
+func newSpendingBatch(spending *adapter.SpendingTx) (spendingBatch, error) {
+	txInputs := slices.Clone(spending.Tx.TransactionBody.Inputs)
+	slices.SortFunc(txInputs, func(a, b TransactionInput.TransactionInput) int {
+		if n := bytes.Compare(a.TransactionId, b.TransactionId); n != 0 {
+			return n
+		}
+		return a.Index - b.Index
+	})
+	inputs := make([]UTxO.UTxO, 0, len(txInputs))
+	for _, txInput := range txInputs {
+		i := slices.IndexFunc(spending.Inputs, func(utxo UTxO.UTxO) bool {
+			return sameInput(utxo.Input, txInput)
+		})
+		if i < 0 {
+			return spendingBatch{}, fmt.Errorf("input %x#%d is not resolved", txInput.TransactionId, txInput.Index)
+		}
+		inputs = append(inputs, spending.Inputs[i])
+	}
+	return spendingBatch{tx: spending, inputs: inputs}, nil
+}
+
+func sameInput(a, b TransactionInput.TransactionInput) bool {
+	return a.Index == b.Index && bytes.Equal(a.TransactionId, b.TransactionId)
+}
+
+func (b spendingBatch) input(outRef constants.OutRef) (UTxO.UTxO, bool) {
+	for _, input := range b.inputs {
+		if input.Input.Index == outRef.Index && hex.EncodeToString(input.Input.TransactionId) == outRef.TxHash {
+			return input, true
+		}
+	}
+	return UTxO.UTxO{}, false
+}
+
+// orderAction returns the constructor of the order redeemer spending input, 0
+// ApplyOrder, 1 CancelOrderByOwner and 2 CancelExpiredOrderByAnyone
+func (b spendingBatch) orderAction(input TransactionInput.TransactionInput) (uint64, error) {
+	index := slices.IndexFunc(b.inputs, func(utxo UTxO.UTxO) bool {
+		return sameInput(utxo.Input, input)
+	})
+	for _, redeemer := range b.tx.Tx.TransactionWitnessSet.Redeemer {
+		if redeemer.Tag != Redeemer.SPEND || redeemer.Index != index {
+			continue
+		}
+		action, _, err := utils.DecodeConstrOf(&redeemer.Data, "OrderRedeemer", 0, 0, 0)
+		return action, err
+	}
+	return 0, fmt.Errorf("cannot find the redeemer spending %x#%d", input.TransactionId, input.Index)
+}
+
+// receivedBy finds the output paid to the order of input among applied, the
+// orders sharing its receiver and datum are paid in turn
+func (b spendingBatch) receivedBy(applied []appliedOrder, input TransactionInput.TransactionInput) (Value.Value, error) {
+	i := slices.IndexFunc(applied, func(a appliedOrder) bool {
+		return sameInput(a.utxo.Input, input)
+	})
+	if i < 0 {
+		return Value.Value{}, fmt.Errorf("order %x#%d is not applied", input.TransactionId, input.Index)
+	}
+	order := applied[i].datum
+	turn := 0
+	for _, a := range applied[:i] {
+		if sameReceiver(a.datum, order) {
+			turn++
+		}
+	}
+
+	for _, output := range b.tx.Tx.TransactionBody.Outputs {
+		if !paidTo(output, order) {
+			continue
+		}
+		if turn == 0 {
+			return output.GetValue(), nil
+		}
+		turn--
+	}
+	return Value.Value{}, fmt.Errorf("cannot find the output paid to %s", order.SuccessReceiver.String())
+}
+
+func sameReceiver(a, b OrderDatum) bool {
+	return a.SuccessReceiver.String() == b.SuccessReceiver.String() &&
+		a.SuccessReceiverDatum.Type == b.SuccessReceiverDatum.Type &&
+		bytes.Equal(a.SuccessReceiverDatum.Hash, b.SuccessReceiverDatum.Hash)
+}
+
+// paidTo checks output is at the success receiver of order with its datum
+func paidTo(output TransactionOutput.TransactionOutput, order OrderDatum) bool {
+	if output.GetAddress().String() != order.SuccessReceiver.String() {
+		return false
+	}
+	datumHash := output.GetDatumHash()
+	hasHash := datumHash != nil && len(datumHash.Payload) != 0
+	datum := output.GetDatum()
+	switch order.SuccessReceiverDatum.Type {
+	case ExtraDatumType_Datum_Hash:
+		return hasHash && bytes.Equal(datumHash.Payload, order.SuccessReceiverDatum.Hash)
+	case ExtraDatumType_Inline_Datum:
+		if datum == nil {
+			return false
+		}
+		hash, err := PlutusData.PlutusDataHash(datum)
+		return err == nil && bytes.Equal(hash.Payload, order.SuccessReceiverDatum.Hash)
+	}
+	return !hasHash && datum == nil
+}
+
+// batcherFee computes the lovelace the batcher kept from order, see TrackOrder.
+// It reports whether the fee is estimated
+func (b spendingBatch) batcherFee(networkId c.Network, applied []appliedOrder, order appliedOrder, received Value.Value) (uint64, bool, error) {
+	orderDatum := order.datum
+	poolScriptHash := constants.V2Config[networkId].PoolScriptHash
+	var poolIn, poolOut *utils.V2PoolState
+	findPool := func(output TransactionOutput.TransactionOutput) *utils.V2PoolState {
+		addr := output.GetAddress()
+		datum := output.GetDatum()
+		if hex.EncodeToString(addr.PaymentPart) != poolScriptHash || datum == nil {
+			return nil
+		}
+		pool, err := utils.ConvertToV2PoolState(*datum)
+		if err != nil {
+			return nil
+		}
+		lp, err := lpAsset(networkId, pool.AssetA, pool.AssetB)
+		if err != nil || lp.String() != orderDatum.LpAsset.String() {
+			return nil
+		}
+		pool.Value = output.GetValue()
+		return &pool
+	}
+	for _, input := range b.inputs {
+		if pool := findPool(input.Output); pool != nil {
+			poolIn = pool
+		}
+	}
+	for _, output := range b.tx.Tx.TransactionBody.Outputs {
+		if pool := findPool(output); pool != nil {
+			poolOut = pool
+		}
+	}
+
+	lost := order.utxo.Output.GetValue().GetCoin() - received.GetCoin()
+	if poolIn != nil && poolIn.AssetA.String() != "lovelace" && poolIn.AssetB.String() != "lovelace" {
+		return orderBatcherFee(orderDatum, lost), false, nil
+	}
+	if poolIn == nil || poolOut == nil {
+		return 0, false, errors.New("cannot find the pool of " + orderDatum.LpAsset.String() + " in the batch")
+	}
+	if swapped, ok := swappedLovelace(orderDatum.Step); ok {
+		return orderBatcherFee(orderDatum, lost-swapped), false, nil
+	}
+
+	// the ADA the pool gains is what the orders swapped, the rest of the ADA
+	// they lost is the batch fee. Take out the fees known from the other
+	// orders and share the remainder by MaxBatcherFee
+	remainder := -(poolOut.Value.GetCoin() - poolIn.Value.GetCoin())
+	var maxFees int64
+	for _, a := range applied {
+		if a.datum.LpAsset.String() != orderDatum.LpAsset.String() {
+			continue
+		}
+		paid, err := b.receivedBy(applied, a.utxo.Input)
+		if err != nil {
+			return 0, false, err
+		}
+		aLost := a.utxo.Output.GetValue().GetCoin() - paid.GetCoin()
+		remainder += aLost
+		if swapped, ok := swappedLovelace(a.datum.Step); ok {
+			remainder -= aLost - swapped
+			continue
+		}
+		maxFees += int64(a.datum.MaxBatcherFee)
+	}
+	if maxFees == 0 {
+		return 0, true, nil
+	}
+	share := new(big.Int).Mul(big.NewInt(remainder), big.NewInt(int64(orderDatum.MaxBatcherFee)))
+	share.Quo(share, big.NewInt(maxFees))
+	return orderBatcherFee(orderDatum, share.Int64()), true, nil
+}
+
+// swappedLovelace returns the lovelace an order with step puts into an ADA
+// pool, when the datum fixes it
+func swappedLovelace(step StepI) (int64, bool) {
+	var direction Direction
+	var amount SwapAmount
+	switch s := step.(type) {
+	case SwapExactIn:
+		direction, amount = s.Direction, s.SwapAmount
+	case Stop:
+		direction, amount = s.Direction, s.SwapAmount
+	case OCO:
+		direction, amount = s.Direction, s.SwapAmount
+	case Deposit:
+		if s.DepositAmount.Type != AmountType_Specific_Amount {
+			return 0, false
+		}
+		return int64(s.DepositAmount.DepositAmountA), true
+	default:
+		return 0, false
+	}
+	if direction != Direction_A_To_B || amount.Type != AmountType_Specific_Amount {
+		return 0, false
+	}
+	return int64(amount.Amount), true
+}
+
+// orderBatcherFee bounds fee by the MaxBatcherFee of the order
+func orderBatcherFee(orderDatum OrderDatum, fee int64) uint64 {
+	return min(lovelaceFee(fee), orderDatum.MaxBatcherFee)
+}
+
+func lovelaceFee(fee int64) uint64 {
+	if fee < 0 {
+		return 0
+	}
+	return uint64(fee)
+}
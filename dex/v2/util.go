@@ -3,11 +3,16 @@ package v2
 import (
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"math"
 	"math/big"
+	"strconv"
 
+	"github.com/Newt6611/apollo"
 	c "github.com/Newt6611/apollo/constants"
 	"github.com/Newt6611/apollo/serialization/Address"
 	"github.com/Newt6611/apollo/serialization/AssetName"
+	"github.com/Newt6611/apollo/txBuilding/Backend/BlockFrostChainContext"
 	"github.com/Newt6611/go-minswap/constants"
 	"github.com/Newt6611/go-minswap/utils"
 )
@@ -29,6 +34,17 @@ func BuildOrderAddress(senderAddr Address.Address, network c.Network) Address.Ad
 	return *result
 }
 
+// setWalletAsChangeAddress works like builder.SetWalletAsChangeAddress, but also loads
+// the wallet's utxos for chain contexts other than apollo's Blockfrost one
+func setWalletAsChangeAddress(builder *apollo.Apollo) *apollo.Apollo {
+	builder = builder.SetWalletAsChangeAddress()
+	if _, ok := builder.Context.(*BlockFrostChainContext.BlockFrostChainContext); ok {
+		return builder
+	}
+	utxos := builder.Context.Utxos(*builder.GetWallet().GetAddress())
+	return builder.AddLoadedUTxOs(utxos...)
+}
+
 func GetOrderScriptHash(networkId c.Network) (string, error) {
 	orderAddress := constants.V2Config[networkId].OrderEnterpriseAddress
 	orderAddr, err := Address.DecodeAddress(orderAddress)
@@ -62,35 +78,101 @@ func ComputeLPAsset(assetAPolicyId, assetAName, assetBPolicyId, assetBName strin
 	return *result, nil
 }
 
+// CalculateAmountOut is the swap formula of the pool contract, see
+// utils.CalculateAmountOut
+func CalculateAmountOut(reserveIn, reserveOut, amountIn, tradingFeeNumerator uint64) uint64 {
+	return utils.CalculateAmountOut(reserveIn, reserveOut, amountIn, tradingFeeNumerator)
+}
+
 /*
-Functions using for DexV2 properties calculation
-pub fn calculate_amount_out(
+pub fn calculate_amount_in(
 
 	reserve_in: Int,
 	reserve_out: Int,
-	amount_in: Int,
+	amount_out: Int,
 	trading_fee_numerator: Int,
 	) -> Int {
 	  let diff = utils.default_fee_denominator - trading_fee_numerator
-	  let in_with_fee = diff * amount_in
-	  let numerator = in_with_fee * reserve_out
-	  let denominator = utils.default_fee_denominator * reserve_in + in_with_fee
-	  numerator / denominator
+	  let numerator = reserve_in * amount_out * utils.default_fee_denominator
+	  let denominator = ( reserve_out - amount_out ) * diff
+	  numerator / denominator + 1
 	}
 */
-func CalculateAmountOut(reserveIn, reserveOut, amountIn, tradingFeeNumerator uint64) uint64 {
-	diff := big.NewInt(0).
-		Sub(big.NewInt(int64(utils.DEFAULT_TRADING_FEE_DENOMINATOR)),
-			big.NewInt(int64(tradingFeeNumerator)))
+func CalculateAmountIn(reserveIn, reserveOut, amountOut, tradingFeeNumerator uint64) (uint64, error) {
+	if amountOut >= reserveOut {
+		return 0, fmt.Errorf("amount out %d must be less than reserve out %d", amountOut, reserveOut)
+	}
+	if tradingFeeNumerator >= utils.DEFAULT_TRADING_FEE_DENOMINATOR {
+		return 0, fmt.Errorf("trading fee numerator %d must be less than %d", tradingFeeNumerator, utils.DEFAULT_TRADING_FEE_DENOMINATOR)
+	}
+	diff := new(big.Int).SetUint64(utils.DEFAULT_TRADING_FEE_DENOMINATOR - tradingFeeNumerator)
+
+	numerator := new(big.Int).Mul(new(big.Int).SetUint64(reserveIn), new(big.Int).SetUint64(amountOut))
+	numerator.Mul(numerator, new(big.Int).SetUint64(utils.DEFAULT_TRADING_FEE_DENOMINATOR))
+
+	denominator := new(big.Int).SetUint64(reserveOut - amountOut)
+	denominator.Mul(denominator, diff)
+
+	amountIn := numerator.Div(numerator, denominator)
+	amountIn.Add(amountIn, big.NewInt(1))
+	if !amountIn.IsUint64() {
+		return 0, fmt.Errorf("amount in %s overflows uint64", amountIn)
+	}
+	return amountIn.Uint64(), nil
+}
 
-	inWithFee := big.NewInt(0).Mul(diff, big.NewInt(int64(amountIn)))
+// PriceToReceived converts price, the amount of output asset paid for one input
+// asset in display units, into the raw output amount of swapping amountIn. The
+// result is rounded down. Price is read through its shortest decimal form, so
+// 0.3 is exactly 3/10 and not the nearest binary float
+func PriceToReceived(amountIn uint64, price float64, decimalsIn, decimalsOut int) (uint64, error) {
+	rawPrice, err := rawPrice(price, decimalsIn, decimalsOut)
+	if err != nil {
+		return 0, err
+	}
 
-	numerator := big.NewInt(0).Mul(inWithFee, big.NewInt(int64(reserveOut)))
+	received := new(big.Int).Mul(new(big.Int).SetUint64(amountIn), rawPrice.Num())
+	received.Div(received, rawPrice.Denom())
+	if !received.IsUint64() {
+		return 0, fmt.Errorf("received amount %s overflows uint64", received)
+	}
+	return received.Uint64(), nil
+}
 
-	denominator := big.NewInt(0).Mul(big.NewInt(int64(utils.DEFAULT_TRADING_FEE_DENOMINATOR)), big.NewInt(int64(reserveIn)))
-	denominator = big.NewInt(0).Add(denominator, inWithFee)
+// PriceToIoRatio converts price, read as in PriceToReceived, into the reduced
+// input/output ratio of a PartialSwap
+func PriceToIoRatio(price float64, decimalsIn, decimalsOut int) (uint64, uint64, error) {
+	rawPrice, err := rawPrice(price, decimalsIn, decimalsOut)
+	if err != nil {
+		return 0, 0, err
+	}
+	// rawPrice is output over input, big.Rat keeps it reduced
+	numerator, denominator := rawPrice.Denom(), rawPrice.Num()
+	if !numerator.IsUint64() || !denominator.IsUint64() {
+		return 0, 0, fmt.Errorf("ratio %s/%s of price %v overflows uint64", numerator, denominator, price)
+	}
+	return numerator.Uint64(), denominator.Uint64(), nil
+}
+
+// rawPrice returns price in raw units of the output asset per raw unit of the
+// input asset
+func rawPrice(price float64, decimalsIn, decimalsOut int) (*big.Rat, error) {
+	if price <= 0 || math.IsInf(price, 0) || math.IsNaN(price) {
+		return nil, fmt.Errorf("invalid price %v", price)
+	}
+	if decimalsIn < 0 || decimalsOut < 0 {
+		return nil, fmt.Errorf("invalid decimals %d/%d", decimalsIn, decimalsOut)
+	}
+	rat, ok := new(big.Rat).SetString(strconv.FormatFloat(price, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("invalid price %v", price)
+	}
 
-	return numerator.Div(numerator, denominator).Uint64()
+	ten := big.NewInt(10)
+	scale := new(big.Rat).SetFrac(
+		new(big.Int).Exp(ten, big.NewInt(int64(decimalsOut)), nil),
+		new(big.Int).Exp(ten, big.NewInt(int64(decimalsIn)), nil))
+	return rat.Mul(rat, scale), nil
 }
 
 func getTagNr(tag uint64) uint64 {
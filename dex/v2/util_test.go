@@ -2,6 +2,7 @@ package v2_test
 
 import (
 	"testing"
+	"testing/quick"
 
 	c "github.com/Newt6611/apollo/constants"
 	"github.com/Newt6611/apollo/serialization/Address"
@@ -52,3 +53,109 @@ func TestCalculateAmountOut(t *testing.T) {
 		t.Errorf("Expected %d, but get %d\n", anwser, out)
 	}
 }
+
+func TestCalculateAmountIn(t *testing.T) {
+	in, err := v2.CalculateAmountIn(2_000_000_000, 500_000_000, 10_000_000, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anwser := uint64(40_939_144)
+	if in != anwser {
+		t.Errorf("Expected %d, but get %d\n", anwser, in)
+	}
+
+	_, err = v2.CalculateAmountIn(2_000_000_000, 500_000_000, 500_000_000, 30)
+	if err == nil {
+		t.Errorf("Expected error when amount out equals reserve out\n")
+	}
+	_, err = v2.CalculateAmountIn(2_000_000_000, 500_000_000, 10_000_000, 10_000)
+	if err == nil {
+		t.Errorf("Expected error when trading fee is 100%%\n")
+	}
+}
+
+// TestCalculateAmountInProperty checks against CalculateAmountOut that the
+// amount in buys at least amountOut, and that the contract rounding never
+// asks for more than one unit above the minimum
+func TestCalculateAmountInProperty(t *testing.T) {
+	property := func(reserveIn, reserveOut uint32, amountOutSeed uint32, fee uint16) bool {
+		if reserveIn == 0 || reserveOut < 2 {
+			return true
+		}
+		amountOut := uint64(amountOutSeed)%(uint64(reserveOut)-1) + 1
+		tradingFee := uint64(fee) % 1_000
+
+		in, err := v2.CalculateAmountIn(uint64(reserveIn), uint64(reserveOut), amountOut, tradingFee)
+		if err != nil {
+			t.Logf("CalculateAmountIn(%d, %d, %d, %d) error: %s", reserveIn, reserveOut, amountOut, tradingFee, err)
+			return false
+		}
+		if v2.CalculateAmountOut(uint64(reserveIn), uint64(reserveOut), in, tradingFee) < amountOut {
+			t.Logf("amount in %d does not buy %d", in, amountOut)
+			return false
+		}
+		if in >= 2 && v2.CalculateAmountOut(uint64(reserveIn), uint64(reserveOut), in-2, tradingFee) >= amountOut {
+			t.Logf("amount in %d is not minimal for %d", in, amountOut)
+			return false
+		}
+		return true
+	}
+	err := quick.Check(property, &quick.Config{MaxCount: 10_000})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPriceToReceived(t *testing.T) {
+	tests := []struct {
+		amountIn    uint64
+		price       float64
+		decimalsIn  int
+		decimalsOut int
+		received    uint64
+	}{
+		// 0.3 is not exact in binary
+		{10_000_000, 0.3, 6, 6, 3_000_000},
+		{1_000_000, 1.5, 6, 0, 1},
+		{5, 0.1, 0, 6, 500_000},
+		{123_456_789, 0.000123, 6, 8, 1_518_518},
+	}
+	for _, test := range tests {
+		received, err := v2.PriceToReceived(test.amountIn, test.price, test.decimalsIn, test.decimalsOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if received != test.received {
+			t.Errorf("PriceToReceived(%d, %v) expect %d, but get %d\n", test.amountIn, test.price, test.received, received)
+		}
+	}
+
+	_, err := v2.PriceToReceived(1_000_000, 0, 6, 6)
+	if err == nil {
+		t.Errorf("PriceToReceived expect an error for a zero price\n")
+	}
+}
+
+func TestPriceToIoRatio(t *testing.T) {
+	tests := []struct {
+		price       float64
+		decimalsIn  int
+		decimalsOut int
+		numerator   uint64
+		denominator uint64
+	}{
+		// 0.42 ADA per MIN is 50 MIN in for 21 ADA out
+		{0.42, 6, 6, 50, 21},
+		{0.42, 0, 6, 1, 420_000},
+		{2.5, 6, 2, 4_000, 1},
+	}
+	for _, test := range tests {
+		numerator, denominator, err := v2.PriceToIoRatio(test.price, test.decimalsIn, test.decimalsOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if numerator != test.numerator || denominator != test.denominator {
+			t.Errorf("PriceToIoRatio(%v) expect %d/%d, but get %d/%d\n", test.price, test.numerator, test.denominator, numerator, denominator)
+		}
+	}
+}
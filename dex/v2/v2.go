@@ -1,21 +1,27 @@
 package v2
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/Newt6611/apollo"
+	c "github.com/Newt6611/apollo/constants"
 	"github.com/Newt6611/apollo/serialization/Address"
 	"github.com/Newt6611/apollo/serialization/Fingerprint"
 	"github.com/Newt6611/apollo/serialization/Metadata"
 	"github.com/Newt6611/apollo/serialization/PlutusData"
 	"github.com/Newt6611/apollo/serialization/Policy"
+	"github.com/Newt6611/apollo/serialization/Redeemer"
 	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Utils"
 	"github.com/Newt6611/go-minswap/adapter"
 	"github.com/Newt6611/go-minswap/constants"
 	"github.com/Newt6611/go-minswap/utils"
-	"github.com/Salvionied/cbor/v2"
 )
 
 
@@ -28,8 +34,178 @@ func NewDexV2(adapter adapter.Adapter) *DexV2 {
 		adapter: adapter,
 	}
 }
-func (d *DexV2) CreateBulkOrdersTx() {
 
+// OrderSpec is one order of CreateBulkOrdersTx
+type OrderSpec struct {
+	Step StepI
+	// the order is placed on Pool, the pool of the first hop for SwapRouting
+	Pool utils.V2PoolState
+	// value of the order output, as the lovelace and units of
+	// BuildSwapExactInOrder. It covers the assets spent by Step, the batcher fee
+	// and the minimum ADA of the output with its datum, which may be more than
+	// OUTPUT_ADA
+	Lovelace uint64
+	Units    []apollo.Unit
+	// receivers, canceller and expiry, as for the other builders
+	Options []OrderOption
+}
+
+// CreateBulkOrdersTx places every order of orders in a single transaction
+// with one change output. The metadata message is the one of the order type,
+// or MetadataMessage_MIXED_ORDERS when the types differ. An order whose value
+// does not cover its step, its batcher fee and the minimum ADA of its output
+// is rejected
+func (d *DexV2) CreateBulkOrdersTx(ctx context.Context, builder *apollo.Apollo, orders []OrderSpec) (*apollo.Apollo, error) {
+	if len(orders) == 0 {
+		return builder, errors.New("orders are empty")
+	}
+
+	orderAddr := BuildOrderAddress(*builder.GetWallet().GetAddress(), d.adapter.NetworkId())
+	var message utils.MetadataMessage
+	payments := make([]orderPayment, 0, len(orders))
+	for i, order := range orders {
+		if order.Step == nil {
+			return builder, fmt.Errorf("order %d has no step", i)
+		}
+		datum, err := d.orderDatum(builder, order.Step, order.Pool.AssetA, order.Pool.AssetB, order.Options...)
+		if err != nil {
+			return builder, fmt.Errorf("order %d: %w", i, err)
+		}
+
+		payment := orderPayment{
+			datum:    datum,
+			lovelace: int(order.Lovelace),
+			units:    order.Units,
+		}
+		if err := d.checkOrderValue(builder, orderAddr, order, payment); err != nil {
+			return builder, fmt.Errorf("order %d: %w", i, err)
+		}
+		payments = append(payments, payment)
+
+		orderMessage := stepMessage(order.Step)
+		if i == 0 {
+			message = orderMessage
+		} else if message != orderMessage {
+			message = utils.MetadataMessage_MIXED_ORDERS
+		}
+	}
+	return d.payOrders(builder, message, payments...)
+}
+
+// checkOrderValue returns an error when payment, the output of order at
+// orderAddr, does not hold the assets spent by its step, its batcher fee and
+// the minimum ADA of the output
+func (d *DexV2) checkOrderValue(builder *apollo.Apollo, orderAddr Address.Address, order OrderSpec, payment orderPayment) error {
+	spentLovelace, spentUnits, err := stepSpending(d.adapter.NetworkId(), order.Step, order.Pool)
+	if err != nil {
+		return err
+	}
+	for _, spent := range spentUnits {
+		held := 0
+		for _, unit := range payment.units {
+			if unit.PolicyId == spent.PolicyId && unit.Name == spent.Name {
+				held += unit.Quantity
+			}
+		}
+		if held < spent.Quantity {
+			return fmt.Errorf("units hold %d of %s%s, the step spends %d", held, spent.PolicyId, spent.Name, spent.Quantity)
+		}
+	}
+
+	datum := payment.datum.ToPlutusData()
+	output := apollo.Payment{
+		Lovelace: payment.lovelace,
+		Receiver: orderAddr,
+		Units:    payment.units,
+		Datum:    &datum,
+		IsInline: true,
+	}
+	minLovelace := Utils.MinLovelacePostAlonzo(*output.ToTxOut(), builder.Context)
+	required := int64(spentLovelace) + int64(payment.datum.MaxBatcherFee) + minLovelace
+	if int64(payment.lovelace) < required {
+		return fmt.Errorf("%d lovelace does not cover the %d spent by the step, the batcher fee %d and the minimum ADA %d",
+			payment.lovelace, spentLovelace, payment.datum.MaxBatcherFee, minLovelace)
+	}
+	return nil
+}
+
+// stepSpending returns the lovelace and units an order with step on pool
+// spends. An AmountType_All amount spends what the order holds, so it adds nothing
+func stepSpending(networkId c.Network, step StepI, pool utils.V2PoolState) (int, []apollo.Unit, error) {
+	var lovelace int
+	var units []apollo.Unit
+	spend := func(asset Fingerprint.Fingerprint, amount SwapAmount) {
+		if amount.Type == AmountType_Specific_Amount {
+			lovelace, units = addOrderValue(lovelace, units, asset, amount.Amount)
+		}
+	}
+	withdraw := func(amount WithdrawalAmount) error {
+		lp, err := lpAsset(networkId, pool.AssetA, pool.AssetB)
+		if err != nil {
+			return err
+		}
+		spend(lp, SwapAmount{Type: amount.Type, Amount: amount.LPAmount})
+		return nil
+	}
+
+	var err error
+	switch step := step.(type) {
+	case SwapExactIn:
+		spend(inputAsset(pool, step.Direction), step.SwapAmount)
+	case Stop:
+		spend(inputAsset(pool, step.Direction), step.SwapAmount)
+	case OCO:
+		spend(inputAsset(pool, step.Direction), step.SwapAmount)
+	case SwapExactOut:
+		spend(inputAsset(pool, step.Direction), step.MaximumSwapAmount)
+	case PartialSwap:
+		spend(inputAsset(pool, step.Direction), SwapAmount{Amount: step.TotalSwapAmount})
+	case SwapRouting:
+		if len(step.Routings) == 0 {
+			return 0, nil, errors.New("swap routing has no route")
+		}
+		spend(inputAsset(pool, step.Routings[0].Direction), step.SwapAmount)
+	case Deposit:
+		spend(pool.AssetA, SwapAmount{Type: step.DepositAmount.Type, Amount: step.DepositAmount.DepositAmountA})
+		spend(pool.AssetB, SwapAmount{Type: step.DepositAmount.Type, Amount: step.DepositAmount.DepositAmountB})
+	case Withdraw:
+		err = withdraw(step.WithdrawalAmount)
+	case ZapOut:
+		err = withdraw(step.WithdrawalAmount)
+	case WithdrawImbalance:
+		err = withdraw(step.WithdrawAmount)
+	}
+	return lovelace, units, err
+}
+
+// stepMessage returns the metadata message of an order with step
+func stepMessage(step StepI) utils.MetadataMessage {
+	switch step := step.(type) {
+	case SwapExactIn:
+		return utils.MetadataMessage_SWAP_EXACT_IN_ORDER
+	case Stop:
+		return utils.MetadataMessage_STOP_ORDER
+	case OCO:
+		return utils.MetadataMessage_OCO_ORDER
+	case SwapExactOut:
+		return utils.MetadataMessage_SWAP_EXACT_OUT_ORDER
+	case Deposit:
+		if step.DepositAmount.DepositAmountA == 0 || step.DepositAmount.DepositAmountB == 0 {
+			return utils.MetadataMessage_ZAP_IN_ORDER
+		}
+		return utils.MetadataMessage_DEPOSIT_ORDER
+	case Withdraw, WithdrawImbalance:
+		return utils.MetadataMessage_WITHDRAW_ORDER
+	case ZapOut:
+		return utils.MetadataMessage_ZAP_OUT_ORDER
+	case PartialSwap:
+		return utils.MetadataMessage_PARTIAL_SWAP_ORDER
+	case SwapRouting:
+		return utils.MetadataMessage_ROUTING_ORDER
+	case Donation:
+		return utils.MetadataMessage_DONATION_ORDER
+	}
+	return utils.MetadataMessage_MIXED_ORDERS
 }
 
 func (d *DexV2) BuildSwapExactInOrder(ctx context.Context,
@@ -40,18 +216,549 @@ func (d *DexV2) BuildSwapExactInOrder(ctx context.Context,
 	lovelace int,
 	units ...apollo.Unit) (*apollo.Apollo, error) {
 
+	return d.BuildSwapExactInOrderWithOptions(ctx, builder, swapExactIn, assetA, assetB, lovelace, units)
+}
+
+// BuildSwapExactInOrderWithOptions is BuildSwapExactInOrder with order options
+func (d *DexV2) BuildSwapExactInOrderWithOptions(ctx context.Context,
+	builder *apollo.Apollo,
+	swapExactIn SwapExactIn,
+	assetA Fingerprint.Fingerprint,
+	assetB Fingerprint.Fingerprint,
+	lovelace int,
+	units []apollo.Unit,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	return d.payOrder(builder, swapExactIn, assetA, assetB, utils.MetadataMessage_SWAP_EXACT_IN_ORDER, lovelace, units, opts...)
+}
+
+// BuildSwapExactOutOrder creates an order receiving exactly desiredOut from pool.
+// The maximum input is computed from the pool reserves and trading fee, then
+// raised by slippage
+func (d *DexV2) BuildSwapExactOutOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	direction Direction,
+	desiredOut uint64,
+	slippage float64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	assetIn, reserveIn, reserveOut, feeNumerator := pool.AssetA, pool.ReserveA, pool.ReserveB, pool.BaseFeeANumerator
+	if direction == Direction_B_To_A {
+		assetIn, reserveIn, reserveOut, feeNumerator = pool.AssetB, pool.ReserveB, pool.ReserveA, pool.BaseFeeBNumerator
+	}
+	if desiredOut == 0 {
+		return builder, errors.New("desired output must be greater than 0")
+	}
+	if slippage < 0 {
+		return builder, errors.New("slippage must not be negative")
+	}
+
+	amountIn, err := CalculateAmountIn(reserveIn, reserveOut, desiredOut, feeNumerator)
+	if err != nil {
+		return builder, err
+	}
+	maximumIn := utils.ApplySlippage(slippage, amountIn, utils.SlippageTypeUp)
+
+	swapExactOut := SwapExactOut{
+		Type:      StepType_Swap_Exact_Out,
+		Direction: direction,
+		MaximumSwapAmount: SwapAmount{
+			Type:   AmountType_Specific_Amount,
+			Amount: maximumIn,
+		},
+		ExpectedReceived: desiredOut,
+		Killable:         Killable_Kill_On_Failed,
+	}
+
+	lovelace, units := orderValue(swapExactOut, assetIn, maximumIn)
+	return d.payOrder(builder, swapExactOut, pool.AssetA, pool.AssetB, utils.MetadataMessage_SWAP_EXACT_OUT_ORDER, lovelace, units, opts...)
+}
+
+// BuildStopOrder creates a stop-loss order selling swapAmount of the input asset
+// of direction once it would receive stopPrice or less. stopPrice is the amount
+// of output asset for one input asset, decimalsA and decimalsB are the decimals
+// of the pool assets
+func (d *DexV2) BuildStopOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	direction Direction,
+	swapAmount uint64,
+	stopPrice float64,
+	decimalsA int,
+	decimalsB int,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if swapAmount == 0 {
+		return builder, errors.New("swap amount must be greater than 0")
+	}
+	stopReceived, err := priceThreshold(direction, swapAmount, stopPrice, decimalsA, decimalsB)
+	if err != nil {
+		return builder, err
+	}
+
+	stop := Stop{
+		Type:      StepType_Stop,
+		Direction: direction,
+		SwapAmount: SwapAmount{
+			Type:   AmountType_Specific_Amount,
+			Amount: swapAmount,
+		},
+		StopReceived: stopReceived,
+	}
+
+	lovelace, units := orderValue(stop, inputAsset(pool, direction), swapAmount)
+	return d.payOrder(builder, stop, pool.AssetA, pool.AssetB, utils.MetadataMessage_STOP_ORDER, lovelace, units, opts...)
+}
+
+// BuildOCOOrder creates a one-cancels-the-other order selling swapAmount of the
+// input asset of direction once it would receive limitPrice or more, or
+// stopPrice or less. Prices are read as in BuildStopOrder
+func (d *DexV2) BuildOCOOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	direction Direction,
+	swapAmount uint64,
+	limitPrice float64,
+	stopPrice float64,
+	decimalsA int,
+	decimalsB int,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if swapAmount == 0 {
+		return builder, errors.New("swap amount must be greater than 0")
+	}
+	if limitPrice <= stopPrice {
+		return builder, fmt.Errorf("limit price %v must be greater than stop price %v", limitPrice, stopPrice)
+	}
+	minimumReceived, err := priceThreshold(direction, swapAmount, limitPrice, decimalsA, decimalsB)
+	if err != nil {
+		return builder, err
+	}
+	stopReceived, err := priceThreshold(direction, swapAmount, stopPrice, decimalsA, decimalsB)
+	if err != nil {
+		return builder, err
+	}
+
+	oco := OCO{
+		Type:      StepType_OCO,
+		Direction: direction,
+		SwapAmount: SwapAmount{
+			Type:   AmountType_Specific_Amount,
+			Amount: swapAmount,
+		},
+		MinimumReceived: minimumReceived,
+		StopReceived:    stopReceived,
+	}
+
+	lovelace, units := orderValue(oco, inputAsset(pool, direction), swapAmount)
+	return d.payOrder(builder, oco, pool.AssetA, pool.AssetB, utils.MetadataMessage_OCO_ORDER, lovelace, units, opts...)
+}
+
+// priceThreshold converts price into the raw amount received for swapAmount,
+// a price that rounds down to nothing is an error
+func priceThreshold(direction Direction, swapAmount uint64, price float64, decimalsA int, decimalsB int) (uint64, error) {
+	decimalsIn, decimalsOut := decimalsA, decimalsB
+	if direction == Direction_B_To_A {
+		decimalsIn, decimalsOut = decimalsB, decimalsA
+	}
+	received, err := PriceToReceived(swapAmount, price, decimalsIn, decimalsOut)
+	if err != nil {
+		return 0, err
+	}
+	if received == 0 {
+		return 0, fmt.Errorf("price %v is too low for swap amount %d", price, swapAmount)
+	}
+	return received, nil
+}
+
+func inputAsset(pool utils.V2PoolState, direction Direction) Fingerprint.Fingerprint {
+	if direction == Direction_B_To_A {
+		return pool.AssetB
+	}
+	return pool.AssetA
+}
+
+// BuildDepositOrder creates an order adding amountA and amountB to pool. When
+// one of them is 0 the order zaps in, the batcher swaps part of the other asset
+// first. MinimumLP is the expected LP amount lowered by slippage
+func (d *DexV2) BuildDepositOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	amountA uint64,
+	amountB uint64,
+	slippage float64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if amountA == 0 && amountB == 0 {
+		return builder, errors.New("deposit amounts must not both be 0")
+	}
+	if slippage < 0 {
+		return builder, errors.New("slippage must not be negative")
+	}
+
+	lpAmount := utils.CalculateDepositAmount(amountA, amountB, pool)
+	minimumLP := utils.ApplySlippage(slippage, lpAmount, utils.SlippageTypeDown)
+	if minimumLP == 0 {
+		return builder, fmt.Errorf("deposit of %d/%d is too small to receive LP", amountA, amountB)
+	}
+
+	deposit := Deposit{
+		Type: StepType_Deposit,
+		DepositAmount: DepositAmount{
+			Type:           AmountType_Specific_Amount,
+			DepositAmountA: amountA,
+			DepositAmountB: amountB,
+		},
+		MinimumLP: minimumLP,
+		Killable:  Killable_Pending_On_Failed,
+	}
+
+	message := utils.MetadataMessage_DEPOSIT_ORDER
+	if amountA == 0 || amountB == 0 {
+		message = utils.MetadataMessage_ZAP_IN_ORDER
+	}
+	lovelace, units := orderValue(deposit, pool.AssetA, amountA)
+	lovelace, units = addOrderValue(lovelace, units, pool.AssetB, amountB)
+	return d.payOrder(builder, deposit, pool.AssetA, pool.AssetB, message, lovelace, units, opts...)
+}
+
+// BuildLimitOrder creates a partial fill order selling swapAmount of the input
+// asset of direction at price or better, read as in BuildStopOrder. The order
+// can be filled in up to DEFAULT_LIMIT_ORDER_HOPS batches, each one swapping at
+// least an even share of swapAmount, and pays the batcher fee of every batch
+func (d *DexV2) BuildLimitOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	direction Direction,
+	swapAmount uint64,
+	price float64,
+	decimalsA int,
+	decimalsB int,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if swapAmount == 0 {
+		return builder, errors.New("swap amount must be greater than 0")
+	}
+	decimalsIn, decimalsOut := decimalsA, decimalsB
+	if direction == Direction_B_To_A {
+		decimalsIn, decimalsOut = decimalsB, decimalsA
+	}
+	ioRatioNumerator, ioRatioDenominator, err := PriceToIoRatio(price, decimalsIn, decimalsOut)
+	if err != nil {
+		return builder, err
+	}
+
+	hops := uint64(DEFAULT_LIMIT_ORDER_HOPS)
+	if swapAmount < hops {
+		hops = swapAmount
+	}
+	partialSwap := PartialSwap{
+		Type:                      StepType_Partial_Swap,
+		Direction:                 direction,
+		TotalSwapAmount:           swapAmount,
+		IoRatioNumerator:          ioRatioNumerator,
+		IoRatioDenominator:        ioRatioDenominator,
+		Hops:                      hops,
+		MinimumSwapAmountRequired: (swapAmount + hops - 1) / hops,
+		MaxBatcherFeeEachTime:     FIXED_BATCHER_FEE,
+	}
+
+	lovelace, units := orderValue(partialSwap, inputAsset(pool, direction), swapAmount)
+	return d.payOrder(builder, partialSwap, pool.AssetA, pool.AssetB, utils.MetadataMessage_PARTIAL_SWAP_ORDER, lovelace, units, opts...)
+}
+
+// BuildRoutingOrder creates an order swapping amountIn of path[0] into the last
+// asset of path through the pool of every consecutive pair. MinimumReceived is
+// the output of the last hop lowered by slippage
+func (d *DexV2) BuildRoutingOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	path []Fingerprint.Fingerprint,
+	amountIn uint64,
+	slippage float64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if len(path) < 2 {
+		return builder, errors.New("routing path needs at least 2 assets")
+	}
+	if amountIn == 0 {
+		return builder, errors.New("amount in must be greater than 0")
+	}
+	if slippage < 0 {
+		return builder, errors.New("slippage must not be negative")
+	}
+
 	networkId := d.adapter.NetworkId()
-	builderAddr := builder.GetWallet().GetAddress()
-	orderAddr := BuildOrderAddress(*builderAddr, networkId)
+	routings := make([]Route, 0, len(path)-1)
+	var firstPool utils.V2PoolState
+	amountOut := amountIn
+	for i := 0; i < len(path)-1; i++ {
+		pool, err := d.adapter.GetV2PoolByPair(ctx, path[i], path[i+1])
+		if err != nil {
+			return builder, fmt.Errorf("routing hop %s -> %s: %w", path[i].String(), path[i+1].String(), err)
+		}
+		lp, err := lpAsset(networkId, pool.AssetA, pool.AssetB)
+		if err != nil {
+			return builder, err
+		}
+
+		direction := Direction_A_To_B
+		reserveIn, reserveOut, feeNumerator := pool.ReserveA, pool.ReserveB, pool.BaseFeeANumerator
+		if pool.AssetA.String() != path[i].String() {
+			direction = Direction_B_To_A
+			reserveIn, reserveOut, feeNumerator = pool.ReserveB, pool.ReserveA, pool.BaseFeeBNumerator
+		}
+		amountOut = CalculateAmountOut(reserveIn, reserveOut, amountOut, feeNumerator)
+		if amountOut == 0 {
+			return builder, fmt.Errorf("routing hop %s -> %s: amount out is 0", path[i].String(), path[i+1].String())
+		}
+
+		routings = append(routings, Route{LPAsset: lp, Direction: direction})
+		if i == 0 {
+			firstPool = pool
+		}
+	}
+
+	minimumReceived := utils.ApplySlippage(slippage, amountOut, utils.SlippageTypeDown)
+	if minimumReceived == 0 {
+		return builder, errors.New("minimum received is 0 after slippage")
+	}
+
+	swapRouting := SwapRouting{
+		Type:     StepType_Swap_Routing,
+		Routings: routings,
+		SwapAmount: SwapAmount{
+			Type:   AmountType_Specific_Amount,
+			Amount: amountIn,
+		},
+		MinimumReceived: minimumReceived,
+	}
+
+	// the order is placed on the pool of the first hop
+	lovelace, units := orderValue(swapRouting, path[0], amountIn)
+	return d.payOrder(builder, swapRouting, firstPool.AssetA, firstPool.AssetB, utils.MetadataMessage_ROUTING_ORDER, lovelace, units, opts...)
+}
+
+// BuildDonationOrder creates an order donating amountA of assetA and amountB
+// of assetB to the pool of the pair, the donation goes to the reserves without
+// minting LP
+func (d *DexV2) BuildDonationOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	assetA Fingerprint.Fingerprint,
+	assetB Fingerprint.Fingerprint,
+	amountA uint64,
+	amountB uint64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if amountA == 0 && amountB == 0 {
+		return builder, errors.New("donation amounts must not both be 0")
+	}
+	pool, err := d.adapter.GetV2PoolByPair(ctx, assetA, assetB)
+	if err != nil {
+		return builder, err
+	}
+	switch {
+	case pool.AssetA.String() == assetA.String() && pool.AssetB.String() == assetB.String():
+	case pool.AssetA.String() == assetB.String() && pool.AssetB.String() == assetA.String():
+		amountA, amountB = amountB, amountA
+	default:
+		return builder, fmt.Errorf("pool %s/%s does not hold %s and %s",
+			pool.AssetA.String(), pool.AssetB.String(), assetA.String(), assetB.String())
+	}
+
+	donation := Donation{
+		Type: StepType_Donation,
+	}
+
+	lovelace, units := orderValue(donation, pool.AssetA, amountA)
+	lovelace, units = addOrderValue(lovelace, units, pool.AssetB, amountB)
+	return d.payOrder(builder, donation, pool.AssetA, pool.AssetB, utils.MetadataMessage_DONATION_ORDER, lovelace, units, opts...)
+}
+
+// BuildWithdrawOrder creates an order withdrawing lpAmount from pool, or the
+// whole LP balance of builder's wallet when lpAmount is 0. The minimum amounts
+// are the expected ones lowered by slippage
+func (d *DexV2) BuildWithdrawOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	lpAmount uint64,
+	slippage float64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	withdrawalAmount, err := d.withdrawalAmount(builder, pool, lpAmount, slippage)
+	if err != nil {
+		return builder, err
+	}
+	amountA, amountB := utils.CalculateWithdrawAmount(withdrawalAmount.LPAmount, pool)
+
+	withdraw := Withdraw{
+		Type:             StepType_Withdraw,
+		WithdrawalAmount: withdrawalAmount,
+		MinimumAssetA:    utils.ApplySlippage(slippage, amountA, utils.SlippageTypeDown),
+		MinimumAssetB:    utils.ApplySlippage(slippage, amountB, utils.SlippageTypeDown),
+		Killable:         Killable_Pending_On_Failed,
+	}
+	return d.payWithdrawal(builder, pool, withdraw, withdrawalAmount.LPAmount, utils.MetadataMessage_WITHDRAW_ORDER, opts...)
+}
+
+// BuildZapOutOrder creates an order withdrawing lpAmount from pool, or the whole
+// LP balance of builder's wallet when lpAmount is 0, and swapping the input
+// asset of direction so only the output asset is received
+func (d *DexV2) BuildZapOutOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	direction Direction,
+	lpAmount uint64,
+	slippage float64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	withdrawalAmount, err := d.withdrawalAmount(builder, pool, lpAmount, slippage)
+	if err != nil {
+		return builder, err
+	}
+	received := utils.CalculateZapOutAmount(withdrawalAmount.LPAmount, pool.ReserveA, pool.ReserveB, pool.TotalLiquidity, pool.BaseFeeANumerator)
+	if direction == Direction_B_To_A {
+		received = utils.CalculateZapOutAmount(withdrawalAmount.LPAmount, pool.ReserveB, pool.ReserveA, pool.TotalLiquidity, pool.BaseFeeBNumerator)
+	}
+
+	zapOut := ZapOut{
+		Type:             StepType_Zap_Out,
+		Direction:        direction,
+		WithdrawalAmount: withdrawalAmount,
+		MinimumReceived:  utils.ApplySlippage(slippage, received, utils.SlippageTypeDown),
+		Killable:         Killable_Pending_On_Failed,
+	}
+	return d.payWithdrawal(builder, pool, zapOut, withdrawalAmount.LPAmount, utils.MetadataMessage_ZAP_OUT_ORDER, opts...)
+}
+
+// BuildWithdrawImbalanceOrder creates an order withdrawing lpAmount from pool,
+// or the whole LP balance of builder's wallet when lpAmount is 0, received as
+// asset A and B in ratioA:ratioB
+func (d *DexV2) BuildWithdrawImbalanceOrder(ctx context.Context,
+	builder *apollo.Apollo,
+	pool utils.V2PoolState,
+	lpAmount uint64,
+	ratioA uint64,
+	ratioB uint64,
+	slippage float64,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	if ratioA == 0 && ratioB == 0 {
+		return builder, errors.New("ratios must not both be 0")
+	}
+	withdrawalAmount, err := d.withdrawalAmount(builder, pool, lpAmount, slippage)
+	if err != nil {
+		return builder, err
+	}
+	amountA := utils.CalculateWithdrawImbalanceAmount(withdrawalAmount.LPAmount, ratioA, ratioB, pool)
+
+	withdrawImbalance := WithdrawImbalance{
+		Type:           StepType_Withdraw_Imbalance,
+		WithdrawAmount: withdrawalAmount,
+		RatioAssetA:    ratioA,
+		RatioAssetB:    ratioB,
+		MinimumAssetA:  utils.ApplySlippage(slippage, amountA, utils.SlippageTypeDown),
+		Killable:       Killable_Pending_On_Failed,
+	}
+	return d.payWithdrawal(builder, pool, withdrawImbalance, withdrawalAmount.LPAmount, utils.MetadataMessage_WITHDRAW_ORDER, opts...)
+}
+
+// withdrawalAmount returns a specific lpAmount, or AmountType_All with the LP
+// balance of builder's wallet when lpAmount is 0
+func (d *DexV2) withdrawalAmount(builder *apollo.Apollo, pool utils.V2PoolState, lpAmount uint64, slippage float64) (WithdrawalAmount, error) {
+	if slippage < 0 {
+		return WithdrawalAmount{}, errors.New("slippage must not be negative")
+	}
+	if lpAmount != 0 {
+		return WithdrawalAmount{Type: AmountType_Specific_Amount, LPAmount: lpAmount}, nil
+	}
+
+	lp, err := lpAsset(d.adapter.NetworkId(), pool.AssetA, pool.AssetB)
+	if err != nil {
+		return WithdrawalAmount{}, err
+	}
+	for _, utxo := range builder.Context.Utxos(*builder.GetWallet().GetAddress()) {
+		value := utxo.Output.GetValue()
+		lpAmount += uint64(value.GetAssets().GetByPolicyAndId(lp.PolicyId, lp.AssetName))
+	}
+	if lpAmount == 0 {
+		return WithdrawalAmount{}, errors.New("wallet has no LP of pool " + lp.String())
+	}
+	return WithdrawalAmount{Type: AmountType_All, LPAmount: lpAmount}, nil
+}
+
+// payWithdrawal pays an order with step locking lpAmount of the LP of pool
+func (d *DexV2) payWithdrawal(builder *apollo.Apollo, pool utils.V2PoolState, step StepI, lpAmount uint64, message utils.MetadataMessage, opts ...OrderOption) (*apollo.Apollo, error) {
+	lp, err := lpAsset(d.adapter.NetworkId(), pool.AssetA, pool.AssetB)
+	if err != nil {
+		return builder, err
+	}
+	lovelace, units := orderValue(step, lp, lpAmount)
+	return d.payOrder(builder, step, pool.AssetA, pool.AssetB, message, lovelace, units, opts...)
+}
+
+// orderValue returns the lovelace and units an order with step locks to spend
+// amount of asset, on top of its batcher fee and the output ADA
+func orderValue(step StepI, asset Fingerprint.Fingerprint, amount uint64) (int, []apollo.Unit) {
+	return addOrderValue(int(maxBatcherFee(step)+OUTPUT_ADA), nil, asset, amount)
+}
+
+// maxBatcherFee returns the batcher fee an order with step pays in total, a
+// partial swap pays it once per hop. The V2 global setting only lists the
+// batchers and the fee updaters, it holds no batcher fee to compute it from
+func maxBatcherFee(step StepI) uint64 {
+	if partialSwap, ok := step.(PartialSwap); ok {
+		return partialSwap.MaxBatcherFeeEachTime * partialSwap.Hops
+	}
+	return FIXED_BATCHER_FEE
+}
+
+// addOrderValue adds amount of asset to the lovelace and units of an order
+func addOrderValue(lovelace int, units []apollo.Unit, asset Fingerprint.Fingerprint, amount uint64) (int, []apollo.Unit) {
+	if amount == 0 {
+		return lovelace, units
+	}
+	if asset.String() == "lovelace" {
+		return lovelace + int(amount), units
+	}
+	return lovelace, append(units, apollo.NewUnit(asset.PolicyId.Value, asset.AssetName.String(), int(amount)))
+}
 
+// lpAsset returns the LP asset of the pool of assetA and assetB
+func lpAsset(networkId c.Network, assetA Fingerprint.Fingerprint, assetB Fingerprint.Fingerprint) (Fingerprint.Fingerprint, error) {
 	assetName, err := ComputeLPAsset(assetA.PolicyId.Value, assetA.AssetName.Value,
 		assetB.PolicyId.Value, assetB.AssetName.Value)
 	if err != nil {
-		return builder, err
+		return Fingerprint.Fingerprint{}, err
 	}
 	lpPolicy, err := Policy.New(constants.V2Config[networkId].LpPolicyId)
 	if err != nil {
-		return builder, err
+		return Fingerprint.Fingerprint{}, err
+	}
+	return *Fingerprint.New(*lpPolicy, assetName), nil
+}
+
+// orderPayment is an order output, lovelace and units include the batcher fee
+// and the output ADA
+type orderPayment struct {
+	datum    OrderDatum
+	lovelace int
+	units    []apollo.Unit
+}
+
+// orderDatum returns the datum of an order with step on the pool of assetA and
+// assetB, builder's wallet can cancel it and receives the output unless opts
+// say otherwise
+func (d *DexV2) orderDatum(builder *apollo.Apollo,
+	step StepI,
+	assetA Fingerprint.Fingerprint,
+	assetB Fingerprint.Fingerprint,
+	opts ...OrderOption) (OrderDatum, error) {
+
+	builderAddr := builder.GetWallet().GetAddress()
+	lpAsset, err := lpAsset(d.adapter.NetworkId(), assetA, assetB)
+	if err != nil {
+		return OrderDatum{}, err
 	}
 
 	orderDatum := OrderDatum{
@@ -64,23 +771,55 @@ func (d *DexV2) BuildSwapExactInOrder(ctx context.Context,
 			Type: ExtraDatumType_No_Datum,
 		},
 		SuccessReceiver: *builderAddr,
-		LpAsset:         *Fingerprint.New(*lpPolicy, assetName),
-		Step:            swapExactIn,
-		MaxBatcherFee:   FIXED_BATCHER_FEE, //TODO: caculate batcher fee
+		LpAsset:         lpAsset,
+		Step:            step,
+		MaxBatcherFee:   maxBatcherFee(step),
 		ExpiredOptions:  ExpirySetting{},
 	}
+	for _, opt := range opts {
+		opt(&orderDatum)
+	}
+	return orderDatum, nil
+}
+
+// payOrder pays an order with step on the pool of assetA and assetB to the order
+// address of builder's wallet, see orderDatum
+func (d *DexV2) payOrder(builder *apollo.Apollo,
+	step StepI,
+	assetA Fingerprint.Fingerprint,
+	assetB Fingerprint.Fingerprint,
+	message utils.MetadataMessage,
+	lovelace int,
+	units []apollo.Unit,
+	opts ...OrderOption) (*apollo.Apollo, error) {
+
+	orderDatum, err := d.orderDatum(builder, step, assetA, assetB, opts...)
+	if err != nil {
+		return builder, err
+	}
+	return d.payOrders(builder, message, orderPayment{datum: orderDatum, lovelace: lovelace, units: units})
+}
+
+// payOrders pays every order to the order address of builder's wallet and
+// completes the transaction
+func (d *DexV2) payOrders(builder *apollo.Apollo, message utils.MetadataMessage, orders ...orderPayment) (*apollo.Apollo, error) {
+	builderAddr := builder.GetWallet().GetAddress()
+	orderAddr := BuildOrderAddress(*builderAddr, d.adapter.NetworkId())
 
-	orderDatumPlutusData := orderDatum.ToPlutusData()
-	builder, err = builder.
-		SetWalletAsChangeAddress().
-		PayToContract(orderAddr, &orderDatumPlutusData, lovelace, true, units...).
+	builder = setWalletAsChangeAddress(builder)
+	for _, order := range orders {
+		orderDatumPlutusData := order.datum.ToPlutusData()
+		builder = builder.PayToContract(orderAddr, &orderDatumPlutusData, order.lovelace, true, order.units...)
+	}
+
+	builder, err := builder.
 		SetShelleyMetadata(Metadata.ShelleyMaryMetadata{
 			Metadata: Metadata.Metadata{
 				674: struct {
 					Msg []string `json:"msg"`
 				}{
 					Msg: []string{
-						string(utils.MetadataMessage_SWAP_EXACT_IN_ORDER),
+						string(message),
 					},
 				},
 			},
@@ -92,11 +831,13 @@ func (d *DexV2) BuildSwapExactInOrder(ctx context.Context,
 	return builder, nil
 }
 
-func (d *DexV2) BuildCancelOrder(ctx context.Context, builder *apollo.Apollo, outRefs []constants.OutRef) (*apollo.Apollo, error) {
+// loadOrders returns the utxos and datums of the orders at outRefs, refs that
+// are not found are skipped
+func (d *DexV2) loadOrders(ctx context.Context, outRefs []constants.OutRef) ([]*UTxO.UTxO, []OrderDatum, error) {
 	networkId := d.adapter.NetworkId()
 	v2OrderScriptHash, err := GetOrderScriptHash(networkId)
 	if err != nil {
-		return builder, err
+		return nil, nil, err
 	}
 
 	var orderUtxos []*UTxO.UTxO
@@ -107,7 +848,108 @@ func (d *DexV2) BuildCancelOrder(ctx context.Context, builder *apollo.Apollo, ou
 		}
 	}
 	if len(orderUtxos) == 0 {
-		return builder, errors.New("order utxos are empty")
+		return nil, nil, errors.New("order utxos are empty")
+	}
+
+	orderDatums := make([]OrderDatum, 0, len(orderUtxos))
+	for _, orderUtxo := range orderUtxos {
+		orderUtxoAddr := orderUtxo.Output.GetAddress()
+		if !utils.IsScriptAddress(orderUtxoAddr) {
+			return nil, nil, errors.New("utxo is not belonged Minswap's order address, utxo: " + orderUtxo.GetKey())
+		}
+		if hex.EncodeToString(orderUtxoAddr.PaymentPart) != v2OrderScriptHash {
+			return nil, nil, errors.New("utxo is not belonged Minswap's order address, utxo: " + orderUtxo.GetKey())
+		}
+
+		orderDatum, err := d.orderDatumOf(ctx, *orderUtxo)
+		if err != nil {
+			return nil, nil, err
+		}
+		orderDatums = append(orderDatums, orderDatum)
+	}
+	return orderUtxos, orderDatums, nil
+}
+
+// datumByHash fetches the datum of hash through the adapter
+func (d *DexV2) datumByHash(ctx context.Context, hash []byte) (PlutusData.PlutusData, error) {
+	rawdatum, err := d.adapter.GetDatumByDatumHash(ctx, hex.EncodeToString(hash))
+	if err != nil {
+		return PlutusData.PlutusData{}, err
+	}
+	b, err := hex.DecodeString(rawdatum)
+	if err != nil {
+		return PlutusData.PlutusData{}, err
+	}
+	return utils.UnmarshalPlutusData(b)
+}
+
+// CancelAuthorization satisfies a script Canceller of the orders cancelled by
+// BuildCancelOrder. Depending on the canceller type, Input is spent, Hash is
+// withdrawn 0 lovelace from as a stake script, or Mint is minted, each with
+// Redeemer. The script is read from ScriptRef when set, otherwise it has to be
+// attached to the builder
+type CancelAuthorization struct {
+	Canceller AuthorizationMethod
+	Redeemer  PlutusData.PlutusData
+	// an input at the canceller script, for AuthorizationMethodType_Spend_Script
+	Input *UTxO.UTxO
+	// assets of the canceller policy, for AuthorizationMethodType_Mint_Script
+	Mint      []apollo.Unit
+	ScriptRef *constants.OutRef
+}
+
+// authorize adds a to builder so the order contract sees the canceller
+func (a CancelAuthorization) authorize(builder *apollo.Apollo, networkId c.Network) (*apollo.Apollo, error) {
+	hash := hex.EncodeToString(a.Canceller.Hash)
+	switch a.Canceller.Type {
+	case AuthorizationMethodType_Spend_Script:
+		if a.Input == nil {
+			return builder, errors.New("spend script canceller " + hash + " needs an input")
+		}
+		inputAddr := a.Input.Output.GetAddress()
+		if !utils.IsScriptAddress(inputAddr) || hex.EncodeToString(inputAddr.PaymentPart) != hash {
+			return builder, errors.New("input " + a.Input.GetKey() + " is not at spend script canceller " + hash)
+		}
+		builder = builder.CollectFrom(*a.Input, Redeemer.Redeemer{Tag: Redeemer.SPEND, Data: a.Redeemer})
+	case AuthorizationMethodType_Withdraw_Script:
+		network := byte(Address.TESTNET)
+		if networkId == c.MAINNET {
+			network = Address.MAINNET
+		}
+		stakeAddr := Address.Address{
+			StakingPart: a.Canceller.Hash,
+			Network:     network,
+			AddressType: Address.NONE_SCRIPT,
+			HeaderByte:  Address.NONE_SCRIPT<<4 | network,
+			Hrp:         Address.ComputeHrp(Address.NONE_SCRIPT, network),
+		}
+		builder = builder.AddWithdrawal(stakeAddr, 0, a.Redeemer)
+	case AuthorizationMethodType_Mint_Script:
+		if len(a.Mint) == 0 {
+			return builder, errors.New("mint script canceller " + hash + " needs assets to mint")
+		}
+		for _, unit := range a.Mint {
+			if unit.PolicyId != hash {
+				return builder, errors.New("policy " + unit.PolicyId + " is not mint script canceller " + hash)
+			}
+			builder = builder.MintAssetsWithRedeemer(unit, Redeemer.Redeemer{Tag: Redeemer.MINT, Data: a.Redeemer})
+		}
+	default:
+		return builder, fmt.Errorf("canceller type %d is not a script", a.Canceller.Type)
+	}
+	if a.ScriptRef != nil {
+		builder = builder.AddReferenceInput(a.ScriptRef.TxHash, a.ScriptRef.Index)
+	}
+	return builder, nil
+}
+
+// BuildCancelOrder cancels the orders at outRefs. Signature cancellers sign the
+// transaction, script cancellers need one of auths with the same Canceller
+func (d *DexV2) BuildCancelOrder(ctx context.Context, builder *apollo.Apollo, outRefs []constants.OutRef, auths ...CancelAuthorization) (*apollo.Apollo, error) {
+	networkId := d.adapter.NetworkId()
+	orderUtxos, orderDatums, err := d.loadOrders(ctx, outRefs)
+	if err != nil {
+		return builder, err
 	}
 
 	depolyedOrderScript := constants.V2DeployedScripts[networkId].Order
@@ -119,66 +961,145 @@ func (d *DexV2) BuildCancelOrder(ctx context.Context, builder *apollo.Apollo, ou
 	redeemer := OrderRedeemer_CancelOrderByOwner
 	builder = builder.AddReferenceInput(depolyedOrderScript.TxHash, depolyedOrderScript.Index)
 
-	for _, orderUtxo := range orderUtxos {
-		orderUtxoAddr := orderUtxo.Output.GetAddress()
-		if !utils.IsScriptAddress(orderUtxoAddr) {
-			return builder, errors.New("utxo is not belonged Minswap's order address, utxo: " + orderUtxo.GetKey())
+	authorized := make([]bool, len(auths))
+	for i, orderUtxo := range orderUtxos {
+		orderDatum := orderDatums[i]
+		builder = builder.CollectFrom(*orderUtxo, redeemer)
+		if orderDatum.Canceller.Type == AuthorizationMethodType_Signature {
+			addr := Address.WalletAddressFromBytes(orderDatum.Canceller.Hash, nil, networkId)
+			builder = builder.AddRequiredSignerFromAddress(*addr, true, false)
+			continue
 		}
-		if hex.EncodeToString(orderUtxoAddr.PaymentPart) != v2OrderScriptHash {
-			return builder, errors.New("utxo is not belonged Minswap's order address, utxo: " + orderUtxo.GetKey())
+
+		j := slices.IndexFunc(auths, func(auth CancelAuthorization) bool {
+			return auth.Canceller.Type == orderDatum.Canceller.Type && bytes.Equal(auth.Canceller.Hash, orderDatum.Canceller.Hash)
+		})
+		if j < 0 {
+			return builder, fmt.Errorf("no authorization for canceller type %d %s, utxo: %s",
+				orderDatum.Canceller.Type, hex.EncodeToString(orderDatum.Canceller.Hash), orderUtxo.GetKey())
+		}
+		// orders sharing a canceller are authorized once
+		if authorized[j] {
+			continue
+		}
+		builder, err = auths[j].authorize(builder, networkId)
+		if err != nil {
+			return builder, err
 		}
+		authorized[j] = true
+	}
 
-		var orderDatum OrderDatum
-		if datum := orderUtxo.Output.GetDatum(); datum != nil {
-			orderDatum, err = OrderDatumFromPlutusData(datum, networkId)
-			if err != nil {
-				return builder, err
-			}
-		} else if dataHash := orderUtxo.Output.GetDatumHash(); dataHash != nil {
-			rawdatum, err := d.adapter.GetDatumByDatumHash(ctx, hex.EncodeToString(dataHash.Payload))
-			if err != nil {
-				return builder, err
-			}
-			b, _ := hex.DecodeString(rawdatum)
-			var p PlutusData.PlutusData
-			err = cbor.Unmarshal(b, &p)
-			if err != nil {
-				return builder, err
-			}
-			orderDatum, err = OrderDatumFromPlutusData(&p, networkId)
+	builder = setWalletAsChangeAddress(builder).
+		SetShelleyMetadata(cancelOrderMetadata)
+
+	builder, err = builder.Complete()
+	if err != nil {
+		return builder, err
+	}
+
+	return builder, nil
+}
+
+var cancelOrderMetadata = Metadata.ShelleyMaryMetadata{
+	Metadata: Metadata.Metadata{
+		674: struct {
+			Msg []string `json:"msg"`
+		}{
+			Msg: []string{
+				string(utils.MetadataMessage_CANCEL_ORDER),
+			},
+		},
+	},
+}
+
+// expiredCancelValidity is how long a transaction cancelling expired orders
+// stays valid
+const expiredCancelValidity = 3 * time.Hour
+
+// BuildCancelExpiredOrders cancels the expired orders at outRefs on behalf of
+// anyone. The transaction is valid from the current slot, every order must
+// have expired before it. Each order is refunded to its RefundReceiver with its
+// RefundReceiverDatum, less its MaxCancellationTip which goes to builder's
+// wallet. The expired order cancellation script authorizes the spend through a
+// zero withdrawal from ExpiredOrderCancelAddress
+func (d *DexV2) BuildCancelExpiredOrders(ctx context.Context, builder *apollo.Apollo, outRefs []constants.OutRef) (*apollo.Apollo, error) {
+	networkId := d.adapter.NetworkId()
+	orderUtxos, orderDatums, err := d.loadOrders(ctx, outRefs)
+	if err != nil {
+		return builder, err
+	}
+
+	scripts := constants.V2DeployedScripts[networkId]
+	if d.adapter.GetUtxoFromRef(ctx, scripts.Order.TxHash, scripts.Order.Index) == nil {
+		return builder, errors.New("cannot find deployed script for V2 Order")
+	}
+	if d.adapter.GetUtxoFromRef(ctx, scripts.ExpiredOrderCancellation.TxHash, scripts.ExpiredOrderCancellation.Index) == nil {
+		return builder, errors.New("cannot find deployed script for V2 Expired Order Cancellation")
+	}
+	cancelAddr, err := Address.DecodeAddress(constants.V2Config[networkId].ExpiredOrderCancelAddress)
+	if err != nil {
+		return builder, err
+	}
+
+	validFrom := int64(builder.Context.LastBlockSlot())
+	validFromTime := utils.SlotToUnixMilli(networkId, validFrom)
+	validTo := utils.UnixMilliToSlot(networkId, validFromTime+expiredCancelValidity.Milliseconds())
+
+	builder = builder.
+		AddReferenceInput(scripts.Order.TxHash, scripts.Order.Index).
+		AddReferenceInput(scripts.ExpiredOrderCancellation.TxHash, scripts.ExpiredOrderCancellation.Index)
+
+	for i, orderUtxo := range orderUtxos {
+		orderDatum := orderDatums[i]
+		expiry := orderDatum.ExpiredOptions
+		if expiry.ExpiredTime == 0 && expiry.MaxCancellationTip == 0 {
+			return builder, errors.New("order has no expiry, utxo: " + orderUtxo.GetKey())
+		}
+		if int64(expiry.ExpiredTime) >= validFromTime {
+			return builder, fmt.Errorf("order expires at %d, after the transaction starts at %d, utxo: %s",
+				expiry.ExpiredTime, validFromTime, orderUtxo.GetKey())
+		}
+
+		value := orderUtxo.Output.GetValue()
+		if uint64(value.GetCoin()) <= expiry.MaxCancellationTip {
+			return builder, errors.New("order cannot pay its cancellation tip, utxo: " + orderUtxo.GetKey())
+		}
+		refund := apollo.NewPaymentFromValue(orderDatum.RefundReceiver, value)
+		refund.Lovelace -= int(expiry.MaxCancellationTip)
+
+		switch orderDatum.RefundReceiverDatum.Type {
+		case ExtraDatumType_Datum_Hash:
+			refund.DatumHash = orderDatum.RefundReceiverDatum.Hash
+		case ExtraDatumType_Inline_Datum:
+			datum, err := d.datumByHash(ctx, orderDatum.RefundReceiverDatum.Hash)
 			if err != nil {
-				return builder, err
+				return builder, fmt.Errorf("refund receiver datum of utxo %s: %w", orderUtxo.GetKey(), err)
 			}
-		} else {
-			return builder, errors.New("utxo without Datum Hash or Inline Datum can not be spent")
+			refund.Datum = &datum
+			refund.IsInline = true
 		}
-
-		if orderDatum.Canceller.Type != AuthorizationMethodType_Signature {
-			return builder, errors.New("only support PubKey canceller on this function")
+		if minLovelace := Utils.MinLovelacePostAlonzo(*refund.ToTxOut(), builder.Context); int64(refund.Lovelace) < minLovelace {
+			return builder, fmt.Errorf("order refund of %d lovelace after its cancellation tip is below the minimum %d, utxo: %s",
+				refund.Lovelace, minLovelace, orderUtxo.GetKey())
 		}
 
-		addr := Address.WalletAddressFromBytes(orderDatum.Canceller.Hash, nil, networkId)
-		builder = builder.CollectFrom(*orderUtxo, redeemer).
-			AddRequiredSignerFromAddress(*addr, true, false)
+		builder = builder.CollectFrom(*orderUtxo, OrderRedeemer_CancelExpiredOrderByAnyone).
+			AddPayment(refund)
 	}
 
-	builder = builder.SetWalletAsChangeAddress().
-		SetShelleyMetadata(Metadata.ShelleyMaryMetadata{
-			Metadata: Metadata.Metadata{
-				674: struct {
-					Msg []string `json:"msg"`
-				}{
-					Msg: []string{
-						string(utils.MetadataMessage_CANCEL_ORDER),
-					},
-				},
-			},
-		})
+	builder = setWalletAsChangeAddress(builder).
+		AddWithdrawal(cancelAddr, 0, PlutusData.PlutusData{
+			TagNr:          121,
+			PlutusDataType: PlutusData.PlutusArray,
+			Value:          PlutusData.PlutusIndefArray{},
+		}).
+		SetValidityStart(validFrom).
+		SetTtl(validTo).
+		SetShelleyMetadata(cancelOrderMetadata)
 
 	builder, err = builder.Complete()
 	if err != nil {
 		return builder, err
 	}
-
 	return builder, nil
 }
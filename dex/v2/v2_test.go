@@ -0,0 +1,1312 @@
+package v2_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"testing"
+
+	"github.com/Newt6611/apollo"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/AssetName"
+	"github.com/Newt6611/apollo/serialization/Fingerprint"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/apollo/serialization/Policy"
+	"github.com/Newt6611/apollo/serialization/Transaction"
+	"github.com/Newt6611/apollo/serialization/TransactionInput"
+	"github.com/Newt6611/apollo/serialization/TransactionOutput"
+	"github.com/Newt6611/apollo/serialization/UTxO"
+	"github.com/Newt6611/apollo/txBuilding/Backend/Base"
+	"github.com/Newt6611/go-minswap/adapter/fake"
+	"github.com/Newt6611/go-minswap/constants"
+	v2 "github.com/Newt6611/go-minswap/dex/v2"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+// newTestDex returns a DexV2 over the fake Testnet fixture
+func newTestDex(t *testing.T) (*v2.DexV2, *fake.Adapter) {
+	t.Helper()
+	a, err := fake.Testnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v2.NewDexV2(a), a
+}
+
+func newTestBuilder(a *fake.Adapter) *apollo.Apollo {
+	return a.NewBuilder().SetWalletFromBech32(fake.TestWalletAddress)
+}
+
+// submit adds the outputs of builder's tx to the fake ledger and returns its hash
+func submit(t *testing.T, a *fake.Adapter, builder *apollo.Apollo) string {
+	t.Helper()
+	txId, err := a.ChainContext().SubmitTx(*builder.GetTx())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(txId.Payload)
+}
+
+// findOrder returns the index and datum of the order output of builder's tx
+func findOrder(t *testing.T, a *fake.Adapter, builder *apollo.Apollo) (int, v2.OrderDatum) {
+	t.Helper()
+	orderScriptHash, _ := v2.GetOrderScriptHash(a.NetworkId())
+	for i, output := range builder.GetTx().TransactionBody.Outputs {
+		addr := output.GetAddress()
+		if hex.EncodeToString(addr.PaymentPart) != orderScriptHash {
+			continue
+		}
+		orderDatum, err := v2.OrderDatumFromPlutusData(output.GetDatum(), a.NetworkId())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return i, orderDatum
+	}
+	t.Fatal("expect an output at the order address")
+	return -1, v2.OrderDatum{}
+}
+
+// hasMessage reports whether the CIP-674 metadata of builder's tx has message
+func hasMessage(t *testing.T, builder *apollo.Apollo, message utils.MetadataMessage) bool {
+	t.Helper()
+	b, err := builder.GetTx().Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Contains(b, []byte(message))
+}
+
+func TestBuildSwapExactInOrderAndCancel(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+
+	swapExactIn := v2.SwapExactIn{
+		Type:      v2.StepType_Swap_Exact_In,
+		Direction: v2.Direction_A_To_B,
+		SwapAmount: v2.SwapAmount{
+			Type:   v2.AmountType_Specific_Amount,
+			Amount: 10_000_000,
+		},
+		MinimumReceived: 1,
+		Killable:        v2.Killable_Pending_On_Failed,
+	}
+	builder, err := dex.BuildSwapExactInOrder(ctx, newTestBuilder(a), swapExactIn, utils.ADA, utils.MIN,
+		10_000_000+int(v2.FIXED_BATCHER_FEE)+2_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHash := submit(t, a, builder)
+
+	orderIndex, _ := findOrder(t, a, builder)
+
+	builder, err = dex.BuildCancelOrder(ctx, newTestBuilder(a), []constants.OutRef{{TxHash: txHash, Index: orderIndex}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := builder.GetTx()
+	if len(tx.TransactionWitnessSet.Redeemer) != 1 {
+		t.Errorf("BuildCancelOrder expect 1 redeemer, but get %d\n", len(tx.TransactionWitnessSet.Redeemer))
+	}
+	if len(tx.TransactionBody.ReferenceInputs) != 1 {
+		t.Errorf("BuildCancelOrder expect 1 reference input, but get %d\n", len(tx.TransactionBody.ReferenceInputs))
+	}
+	submit(t, a, builder)
+}
+
+func TestBuildSwapExactOutOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2000 ADA / 500 MIN with a 0.3% fee, 10 MIN out needs 40.939144 ADA in
+	builder, err := dex.BuildSwapExactOutOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, 10_000_000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	swapExactOut, ok := orderDatum.Step.(v2.SwapExactOut)
+	if !ok {
+		t.Fatalf("BuildSwapExactOutOrder expect SwapExactOut step, but get %T\n", orderDatum.Step)
+	}
+	amountIn := uint64(40_939_144)
+	maximumIn := utils.ApplySlippage(0.01, amountIn, utils.SlippageTypeUp)
+	if swapExactOut.ExpectedReceived != 10_000_000 || swapExactOut.MaximumSwapAmount.Amount != maximumIn {
+		t.Errorf("BuildSwapExactOutOrder unexpected step %+v\n", swapExactOut)
+	}
+	if swapExactOut.Killable != v2.Killable_Kill_On_Failed {
+		t.Errorf("BuildSwapExactOutOrder expect Killable_Kill_On_Failed, but get %d\n", swapExactOut.Killable)
+	}
+	lovelace := builder.GetTx().TransactionBody.Outputs[i].GetValue().GetCoin()
+	if lovelace != int64(maximumIn+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA) {
+		t.Errorf("BuildSwapExactOutOrder expect %d lovelace, but get %d\n", maximumIn+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA, lovelace)
+	}
+
+	builder, err = dex.BuildSwapExactOutOrder(ctx, newTestBuilder(a), pool, v2.Direction_B_To_A, 10_000_000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum = findOrder(t, a, builder)
+	swapExactOut = orderDatum.Step.(v2.SwapExactOut)
+	value := builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	minAmount := value.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+	if uint64(minAmount) != swapExactOut.MaximumSwapAmount.Amount {
+		t.Errorf("BuildSwapExactOutOrder expect %d MIN locked, but get %d\n", swapExactOut.MaximumSwapAmount.Amount, minAmount)
+	}
+
+	_, err = dex.BuildSwapExactOutOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, pool.ReserveB, 0)
+	if err == nil {
+		t.Error("BuildSwapExactOutOrder expect an error when desired output drains the pool")
+	}
+}
+
+func TestBuildStopOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pool trades 1 ADA for 0.25 MIN, stop when 10 ADA gets 2 MIN or less
+	builder, err := dex.BuildStopOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, 10_000_000, 0.2, 6, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	stop, ok := orderDatum.Step.(v2.Stop)
+	if !ok {
+		t.Fatalf("BuildStopOrder expect Stop step, but get %T\n", orderDatum.Step)
+	}
+	if stop.StopReceived != 2_000_000 || stop.SwapAmount.Amount != 10_000_000 {
+		t.Errorf("BuildStopOrder unexpected step %+v\n", stop)
+	}
+	lovelace := builder.GetTx().TransactionBody.Outputs[i].GetValue().GetCoin()
+	if lovelace != int64(10_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA) {
+		t.Errorf("BuildStopOrder expect %d lovelace, but get %d\n", 10_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA, lovelace)
+	}
+
+	_, err = dex.BuildStopOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, 10, 0.01, 6, 6)
+	if err == nil {
+		t.Error("BuildStopOrder expect an error when the stop price rounds to nothing")
+	}
+}
+
+func TestBuildOCOOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the pool trades 1 MIN for 4 ADA
+	builder, err := dex.BuildOCOOrder(ctx, newTestBuilder(a), pool, v2.Direction_B_To_A, 10_000_000, 4.5, 3.5, 6, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	oco, ok := orderDatum.Step.(v2.OCO)
+	if !ok {
+		t.Fatalf("BuildOCOOrder expect OCO step, but get %T\n", orderDatum.Step)
+	}
+	if oco.MinimumReceived != 45_000_000 || oco.StopReceived != 35_000_000 {
+		t.Errorf("BuildOCOOrder unexpected step %+v\n", oco)
+	}
+	value := builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	minAmount := value.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+	if minAmount != 10_000_000 {
+		t.Errorf("BuildOCOOrder expect 10000000 MIN locked, but get %d\n", minAmount)
+	}
+
+	_, err = dex.BuildOCOOrder(ctx, newTestBuilder(a), pool, v2.Direction_B_To_A, 10_000_000, 3.5, 4.5, 6, 6)
+	if err == nil {
+		t.Error("BuildOCOOrder expect an error when the limit price is below the stop price")
+	}
+}
+
+func TestBuildDepositOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 ADA and 5 MIN match the pool ratio, 1% of the total liquidity
+	builder, err := dex.BuildDepositOrder(ctx, newTestBuilder(a), pool, 20_000_000, 5_000_000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	deposit, ok := orderDatum.Step.(v2.Deposit)
+	if !ok {
+		t.Fatalf("BuildDepositOrder expect Deposit step, but get %T\n", orderDatum.Step)
+	}
+	minimumLP := utils.ApplySlippage(0.01, 10_000_000, utils.SlippageTypeDown)
+	if deposit.MinimumLP != minimumLP {
+		t.Errorf("BuildDepositOrder expect MinimumLP %d, but get %d\n", minimumLP, deposit.MinimumLP)
+	}
+	value := builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	if value.GetCoin() != int64(20_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA) {
+		t.Errorf("BuildDepositOrder expect %d lovelace, but get %d\n", 20_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA, value.GetCoin())
+	}
+	minAmount := value.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+	if minAmount != 5_000_000 {
+		t.Errorf("BuildDepositOrder expect 5000000 MIN locked, but get %d\n", minAmount)
+	}
+	if !hasMessage(t, builder, utils.MetadataMessage_DEPOSIT_ORDER) {
+		t.Errorf("BuildDepositOrder expect %s metadata\n", utils.MetadataMessage_DEPOSIT_ORDER)
+	}
+
+	// zap in with MIN only
+	builder, err = dex.BuildDepositOrder(ctx, newTestBuilder(a), pool, 0, 5_000_000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum = findOrder(t, a, builder)
+	deposit = orderDatum.Step.(v2.Deposit)
+	lpAmount := utils.CalculateDepositAmount(0, 5_000_000, pool)
+	if deposit.MinimumLP != lpAmount || lpAmount == 0 || lpAmount >= 10_000_000 {
+		t.Errorf("BuildDepositOrder expect zap in MinimumLP %d below 10000000, but get %d\n", lpAmount, deposit.MinimumLP)
+	}
+	value = builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	if value.GetCoin() != int64(v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA) {
+		t.Errorf("BuildDepositOrder expect %d lovelace, but get %d\n", v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA, value.GetCoin())
+	}
+	if !hasMessage(t, builder, utils.MetadataMessage_ZAP_IN_ORDER) {
+		t.Errorf("BuildDepositOrder expect %s metadata\n", utils.MetadataMessage_ZAP_IN_ORDER)
+	}
+
+	_, err = dex.BuildDepositOrder(ctx, newTestBuilder(a), pool, 0, 0, 0)
+	if err == nil {
+		t.Error("BuildDepositOrder expect an error without amounts")
+	}
+}
+
+// fundLP adds a utxo holding lpAmount of the ADA/MIN LP to the test wallet
+func fundLP(t *testing.T, a *fake.Adapter, lpAmount uint64) {
+	t.Helper()
+	lpAssetName, err := v2.ComputeLPAsset(utils.ADA.PolicyId.String(), utils.ADA.AssetName.HexString(),
+		utils.MIN.PolicyId.String(), utils.MIN.AssetName.HexString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := Base.Output{
+		Address: fake.TestWalletAddress,
+		Amount: []Base.AddressAmount{
+			{Unit: "lovelace", Quantity: "2000000"},
+			{Unit: constants.V2Config[a.NetworkId()].LpPolicyId + lpAssetName.HexString(), Quantity: strconv.FormatUint(lpAmount, 10)},
+		},
+	}
+	a.AddUtxos(*output.ToUTxO("d4f0ddf49f4db6b8813fad6378f0f2e4343fde8c7cfcffe056d5a93f44de6e56"))
+}
+
+func TestBuildWithdrawOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fundLP(t, a, 10_000_000)
+
+	builder, err := dex.BuildWithdrawOrder(ctx, newTestBuilder(a), pool, 4_000_000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	withdraw, ok := orderDatum.Step.(v2.Withdraw)
+	if !ok {
+		t.Fatalf("BuildWithdrawOrder expect Withdraw step, but get %T\n", orderDatum.Step)
+	}
+	minimumA := utils.ApplySlippage(0.01, 8_000_000, utils.SlippageTypeDown)
+	minimumB := utils.ApplySlippage(0.01, 2_000_000, utils.SlippageTypeDown)
+	if withdraw.WithdrawalAmount.Type != v2.AmountType_Specific_Amount || withdraw.MinimumAssetA != minimumA || withdraw.MinimumAssetB != minimumB {
+		t.Errorf("BuildWithdrawOrder unexpected step %+v\n", withdraw)
+	}
+	value := builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	lpAmount := value.GetAssets().GetByPolicyAndId(orderDatum.LpAsset.PolicyId, orderDatum.LpAsset.AssetName)
+	if lpAmount != 4_000_000 {
+		t.Errorf("BuildWithdrawOrder expect 4000000 LP locked, but get %d\n", lpAmount)
+	}
+
+	// the whole LP balance
+	builder, err = dex.BuildWithdrawOrder(ctx, newTestBuilder(a), pool, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum = findOrder(t, a, builder)
+	withdraw = orderDatum.Step.(v2.Withdraw)
+	if withdraw.WithdrawalAmount.Type != v2.AmountType_All || withdraw.WithdrawalAmount.LPAmount != 10_000_000 {
+		t.Errorf("BuildWithdrawOrder expect all of 10000000 LP, but get %+v\n", withdraw.WithdrawalAmount)
+	}
+	if withdraw.MinimumAssetA != 20_000_000 || withdraw.MinimumAssetB != 5_000_000 {
+		t.Errorf("BuildWithdrawOrder unexpected step %+v\n", withdraw)
+	}
+
+	_, err = dex.BuildWithdrawOrder(ctx, newTestBuilder(a), pool, 0, -1)
+	if err == nil {
+		t.Error("BuildWithdrawOrder expect an error for a negative slippage")
+	}
+}
+
+func TestBuildWithdrawOrderWithoutLP(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dex.BuildWithdrawOrder(ctx, newTestBuilder(a), pool, 0, 0)
+	if err == nil {
+		t.Error("BuildWithdrawOrder expect an error when the wallet has no LP")
+	}
+}
+
+func TestBuildZapOutOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fundLP(t, a, 10_000_000)
+
+	builder, err := dex.BuildZapOutOrder(ctx, newTestBuilder(a), pool, v2.Direction_B_To_A, 10_000_000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum := findOrder(t, a, builder)
+	zapOut, ok := orderDatum.Step.(v2.ZapOut)
+	if !ok {
+		t.Fatalf("BuildZapOutOrder expect ZapOut step, but get %T\n", orderDatum.Step)
+	}
+	// 20 ADA withdrawn plus 5 MIN swapped against 1980 ADA / 495 MIN
+	if zapOut.Direction != v2.Direction_B_To_A || zapOut.MinimumReceived != 39_741_192 {
+		t.Errorf("BuildZapOutOrder unexpected step %+v\n", zapOut)
+	}
+	if !hasMessage(t, builder, utils.MetadataMessage_ZAP_OUT_ORDER) {
+		t.Errorf("BuildZapOutOrder expect %s metadata\n", utils.MetadataMessage_ZAP_OUT_ORDER)
+	}
+}
+
+func TestBuildWithdrawImbalanceOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fundLP(t, a, 10_000_000)
+
+	builder, err := dex.BuildWithdrawImbalanceOrder(ctx, newTestBuilder(a), pool, 10_000_000, 1, 1, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum := findOrder(t, a, builder)
+	withdrawImbalance, ok := orderDatum.Step.(v2.WithdrawImbalance)
+	if !ok {
+		t.Fatalf("BuildWithdrawImbalanceOrder expect WithdrawImbalance step, but get %T\n", orderDatum.Step)
+	}
+	amountA := utils.CalculateWithdrawImbalanceAmount(10_000_000, 1, 1, pool)
+	minimumA := utils.ApplySlippage(0.01, amountA, utils.SlippageTypeDown)
+	if withdrawImbalance.RatioAssetA != 1 || withdrawImbalance.RatioAssetB != 1 || withdrawImbalance.MinimumAssetA != minimumA {
+		t.Errorf("BuildWithdrawImbalanceOrder unexpected step %+v\n", withdrawImbalance)
+	}
+
+	_, err = dex.BuildWithdrawImbalanceOrder(ctx, newTestBuilder(a), pool, 10_000_000, 0, 0, 0)
+	if err == nil {
+		t.Error("BuildWithdrawImbalanceOrder expect an error when both ratios are 0")
+	}
+}
+
+func TestBuildLimitOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sell 100 MIN at 0.42 ADA per MIN
+	builder, err := dex.BuildLimitOrder(ctx, newTestBuilder(a), pool, v2.Direction_B_To_A, 100_000_000, 0.42, 6, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	partialSwap, ok := orderDatum.Step.(v2.PartialSwap)
+	if !ok {
+		t.Fatalf("BuildLimitOrder expect PartialSwap step, but get %T\n", orderDatum.Step)
+	}
+	if partialSwap.IoRatioNumerator != 50 || partialSwap.IoRatioDenominator != 21 {
+		t.Errorf("BuildLimitOrder expect io ratio 50/21, but get %d/%d\n", partialSwap.IoRatioNumerator, partialSwap.IoRatioDenominator)
+	}
+	if partialSwap.Hops != v2.DEFAULT_LIMIT_ORDER_HOPS || partialSwap.MinimumSwapAmountRequired != 33_333_334 {
+		t.Errorf("BuildLimitOrder unexpected step %+v\n", partialSwap)
+	}
+	batcherFee := uint64(v2.FIXED_BATCHER_FEE * v2.DEFAULT_LIMIT_ORDER_HOPS)
+	if orderDatum.MaxBatcherFee != batcherFee {
+		t.Errorf("BuildLimitOrder expect MaxBatcherFee %d, but get %d\n", batcherFee, orderDatum.MaxBatcherFee)
+	}
+	value := builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	if value.GetCoin() != int64(batcherFee+v2.OUTPUT_ADA) {
+		t.Errorf("BuildLimitOrder expect %d lovelace, but get %d\n", batcherFee+v2.OUTPUT_ADA, value.GetCoin())
+	}
+	minAmount := value.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+	if minAmount != 100_000_000 {
+		t.Errorf("BuildLimitOrder expect 100000000 MIN locked, but get %d\n", minAmount)
+	}
+
+	_, err = dex.BuildLimitOrder(ctx, newTestBuilder(a), pool, v2.Direction_B_To_A, 100_000_000, -1, 6, 6)
+	if err == nil {
+		t.Error("BuildLimitOrder expect an error for a negative price")
+	}
+}
+
+// addMinDjedPool adds a MIN/tDJED pool with reserves 500 MIN and 1000 tDJED
+func addMinDjedPool(t *testing.T, a *fake.Adapter) Fingerprint.Fingerprint {
+	t.Helper()
+	output := Base.Output{
+		Address: "addr_test1zrtt4xm4p84vse3g3l6swtf2rqs943t0w39ustwdszxt3l5rajt8r8wqtygrfduwgukk73m5gcnplmztc5tl5ngy0upqhns793",
+		Amount: []Base.AddressAmount{
+			{Unit: "lovelace", Quantity: "2000000"},
+			{Unit: constants.V2Config[a.NetworkId()].PoolAuthenAsset, Quantity: "1"},
+			{Unit: "e16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed724d494e", Quantity: "500000000"},
+			{Unit: "e16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed7274444a4544", Quantity: "1000000000"},
+		},
+		InlineDatum: "d8799fd8799fd87a9f581cd6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8feffffd8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72434d494effd8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed724574444a4544ff1a3b9aca001a1dcd65001a3b9aca00181e181ed87a80d87980ff",
+	}
+	a.AddUtxos(*output.ToUTxO("e5a1eea50a5ec7c9924be7e7489a03f5454e0e9d8d0d0e167e6ba04055ef7f67"))
+
+	policy, _ := Policy.New("e16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72")
+	return *Fingerprint.New(*policy, *AssetName.NewAssetNameFromHexString("74444a4544"))
+}
+
+func TestBuildRoutingOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	djed := addMinDjedPool(t, a)
+
+	builder, err := dex.BuildRoutingOrder(ctx, newTestBuilder(a), []Fingerprint.Fingerprint{utils.ADA, utils.MIN, djed}, 10_000_000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	swapRouting, ok := orderDatum.Step.(v2.SwapRouting)
+	if !ok {
+		t.Fatalf("BuildRoutingOrder expect SwapRouting step, but get %T\n", orderDatum.Step)
+	}
+	if len(swapRouting.Routings) != 2 {
+		t.Fatalf("BuildRoutingOrder expect 2 routes, but get %d\n", len(swapRouting.Routings))
+	}
+	adaMinLP, _ := v2.ComputeLPAsset(utils.ADA.PolicyId.String(), utils.ADA.AssetName.HexString(),
+		utils.MIN.PolicyId.String(), utils.MIN.AssetName.HexString())
+	minDjedLP, _ := v2.ComputeLPAsset(utils.MIN.PolicyId.String(), utils.MIN.AssetName.HexString(),
+		djed.PolicyId.String(), djed.AssetName.HexString())
+	for j, expect := range []string{adaMinLP.HexString(), minDjedLP.HexString()} {
+		route := swapRouting.Routings[j]
+		if route.LPAsset.AssetName.HexString() != expect || route.Direction != v2.Direction_A_To_B {
+			t.Errorf("BuildRoutingOrder route %d expect %s A_To_B, but get %s %d\n", j, expect, route.LPAsset.AssetName.HexString(), route.Direction)
+		}
+	}
+	if orderDatum.LpAsset.AssetName.HexString() != adaMinLP.HexString() {
+		t.Errorf("BuildRoutingOrder expect the order on the first pool, but get %s\n", orderDatum.LpAsset.AssetName.HexString())
+	}
+	minOut := v2.CalculateAmountOut(2_000_000_000, 500_000_000, 10_000_000, 30)
+	djedOut := v2.CalculateAmountOut(500_000_000, 1_000_000_000, minOut, 30)
+	minimumReceived := utils.ApplySlippage(0.01, djedOut, utils.SlippageTypeDown)
+	if swapRouting.MinimumReceived != minimumReceived {
+		t.Errorf("BuildRoutingOrder expect MinimumReceived %d, but get %d\n", minimumReceived, swapRouting.MinimumReceived)
+	}
+	lovelace := builder.GetTx().TransactionBody.Outputs[i].GetValue().GetCoin()
+	if lovelace != int64(10_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA) {
+		t.Errorf("BuildRoutingOrder expect %d lovelace, but get %d\n", 10_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA, lovelace)
+	}
+
+	// a single hop against the pool order
+	builder, err = dex.BuildRoutingOrder(ctx, newTestBuilder(a), []Fingerprint.Fingerprint{utils.MIN, utils.ADA}, 10_000_000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum = findOrder(t, a, builder)
+	swapRouting = orderDatum.Step.(v2.SwapRouting)
+	if swapRouting.Routings[0].Direction != v2.Direction_B_To_A {
+		t.Errorf("BuildRoutingOrder expect B_To_A, but get %d\n", swapRouting.Routings[0].Direction)
+	}
+
+	_, err = dex.BuildRoutingOrder(ctx, newTestBuilder(a), []Fingerprint.Fingerprint{utils.ADA, djed}, 10_000_000, 0)
+	if err == nil {
+		t.Error("BuildRoutingOrder expect an error for a hop without pool")
+	}
+
+	_, err = dex.BuildRoutingOrder(ctx, newTestBuilder(a), []Fingerprint.Fingerprint{utils.ADA, utils.MIN, djed}, 1, 0)
+	if err == nil {
+		t.Error("BuildRoutingOrder expect an error for a hop with 0 amount out")
+	}
+	_, err = dex.BuildRoutingOrder(ctx, newTestBuilder(a), []Fingerprint.Fingerprint{utils.ADA, utils.MIN}, 10, 10)
+	if err == nil {
+		t.Error("BuildRoutingOrder expect an error for 0 minimum received")
+	}
+}
+
+func TestBuildDonationOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+
+	// assets in the reverse of the pool order
+	builder, err := dex.BuildDonationOrder(ctx, newTestBuilder(a), utils.MIN, utils.ADA, 3_000_000, 5_000_000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, orderDatum := findOrder(t, a, builder)
+	if _, ok := orderDatum.Step.(v2.Donation); !ok {
+		t.Fatalf("BuildDonationOrder expect Donation step, but get %T\n", orderDatum.Step)
+	}
+	value := builder.GetTx().TransactionBody.Outputs[i].GetValue()
+	if value.GetCoin() != int64(5_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA) {
+		t.Errorf("BuildDonationOrder expect %d lovelace, but get %d\n", 5_000_000+v2.FIXED_BATCHER_FEE+v2.OUTPUT_ADA, value.GetCoin())
+	}
+	minAmount := value.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+	if minAmount != 3_000_000 {
+		t.Errorf("BuildDonationOrder expect 3000000 MIN donated, but get %d\n", minAmount)
+	}
+	if !hasMessage(t, builder, utils.MetadataMessage_DONATION_ORDER) {
+		t.Errorf("BuildDonationOrder expect %s metadata\n", utils.MetadataMessage_DONATION_ORDER)
+	}
+
+	_, err = dex.BuildDonationOrder(ctx, newTestBuilder(a), utils.ADA, utils.MIN, 0, 0)
+	if err == nil {
+		t.Error("BuildDonationOrder expect an error without amounts")
+	}
+	_, err = dex.BuildDonationOrder(ctx, newTestBuilder(a), utils.ADA, addMinDjedPool(t, a), 1_000_000, 0)
+	if err == nil {
+		t.Error("BuildDonationOrder expect an error for a pair without pool")
+	}
+}
+
+// orderADA is above the minimum ADA of the order outputs of the tests, their
+// datums hold two addresses
+const orderADA = 3_000_000
+
+func TestCreateBulkOrdersTx(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := Address.DecodeAddress("addr_test1qqpfnkrx0wv3zty7c3uw9j6tvvj2tvuh7spgw80v8c353yydvyatxqgacw6azcshwwywv0nkxkdp2l2uq5qrn628mw0ssws0re")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiredTime := time.UnixMilli(1_700_000_000_000)
+	expiry := v2.ExpirySetting{ExpiredTime: 1_700_000_000_000, MaxCancellationTip: 300_000}
+
+	orders := []v2.OrderSpec{
+		{
+			Step: v2.SwapExactIn{
+				Direction:       v2.Direction_A_To_B,
+				SwapAmount:      v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: 10_000_000},
+				MinimumReceived: 1,
+			},
+			Pool:            pool,
+			Lovelace:        10_000_000 + v2.FIXED_BATCHER_FEE + orderADA,
+			Options:  []v2.OrderOption{v2.WithSuccessReceiver(receiver, v2.ExtraDatum{})},
+		},
+		{
+			Step: v2.Stop{
+				Direction:    v2.Direction_B_To_A,
+				SwapAmount:   v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: 5_000_000},
+				StopReceived: 15_000_000,
+			},
+			Pool:           pool,
+			Lovelace:       v2.FIXED_BATCHER_FEE + orderADA,
+			Units:          []apollo.Unit{apollo.NewUnit(utils.MIN.PolicyId.Value, utils.MIN.AssetName.String(), 5_000_000)},
+			Options:        []v2.OrderOption{v2.WithExpiry(expiredTime, 300_000)},
+		},
+		{
+			Step: v2.PartialSwap{
+				Direction:                 v2.Direction_A_To_B,
+				TotalSwapAmount:           20_000_000,
+				IoRatioNumerator:          4,
+				IoRatioDenominator:        1,
+				Hops:                      2,
+				MinimumSwapAmountRequired: 10_000_000,
+				MaxBatcherFeeEachTime:     v2.FIXED_BATCHER_FEE,
+			},
+			Pool:     pool,
+			Lovelace: 20_000_000 + 2*v2.FIXED_BATCHER_FEE + orderADA,
+		},
+	}
+	builder, err := dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orderScriptHash, _ := v2.GetOrderScriptHash(a.NetworkId())
+	outputs := builder.GetTx().TransactionBody.Outputs
+	if len(outputs) != len(orders)+1 {
+		t.Fatalf("CreateBulkOrdersTx expect %d outputs, but get %d\n", len(orders)+1, len(outputs))
+	}
+	expectLovelace := []int64{
+		10_000_000 + v2.FIXED_BATCHER_FEE + orderADA,
+		v2.FIXED_BATCHER_FEE + orderADA,
+		20_000_000 + 2*v2.FIXED_BATCHER_FEE + orderADA,
+	}
+	var datums []v2.OrderDatum
+	for _, output := range outputs {
+		addr := output.GetAddress()
+		if hex.EncodeToString(addr.PaymentPart) != orderScriptHash {
+			continue
+		}
+		orderDatum, err := v2.OrderDatumFromPlutusData(output.GetDatum(), a.NetworkId())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output.GetValue().GetCoin() != expectLovelace[len(datums)] {
+			t.Errorf("CreateBulkOrdersTx order %d expect %d lovelace, but get %d\n", len(datums), expectLovelace[len(datums)], output.GetValue().GetCoin())
+		}
+		datums = append(datums, orderDatum)
+	}
+	if len(datums) != len(orders) {
+		t.Fatalf("CreateBulkOrdersTx expect %d orders, but get %d\n", len(orders), len(datums))
+	}
+	if datums[0].SuccessReceiver.String() != receiver.String() || datums[0].RefundReceiver.String() != fake.TestWalletAddress {
+		t.Errorf("CreateBulkOrdersTx unexpected receivers %s/%s\n", datums[0].SuccessReceiver.String(), datums[0].RefundReceiver.String())
+	}
+	if datums[1].ExpiredOptions != expiry {
+		t.Errorf("CreateBulkOrdersTx expect expiry %+v, but get %+v\n", expiry, datums[1].ExpiredOptions)
+	}
+	if datums[2].MaxBatcherFee != 2*v2.FIXED_BATCHER_FEE {
+		t.Errorf("CreateBulkOrdersTx expect MaxBatcherFee %d, but get %d\n", 2*v2.FIXED_BATCHER_FEE, datums[2].MaxBatcherFee)
+	}
+	if !hasMessage(t, builder, utils.MetadataMessage_MIXED_ORDERS) {
+		t.Errorf("CreateBulkOrdersTx expect %s metadata\n", utils.MetadataMessage_MIXED_ORDERS)
+	}
+
+	// orders of one type keep its message
+	builder, err = dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), []v2.OrderSpec{orders[0], orders[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasMessage(t, builder, utils.MetadataMessage_SWAP_EXACT_IN_ORDER) {
+		t.Errorf("CreateBulkOrdersTx expect %s metadata\n", utils.MetadataMessage_SWAP_EXACT_IN_ORDER)
+	}
+
+	_, err = dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), nil)
+	if err == nil {
+		t.Error("CreateBulkOrdersTx expect an error without orders")
+	}
+
+	// the value has to cover the step, the batcher fee and the minimum ADA
+	uncovered := map[string]v2.OrderSpec{
+		"no batcher fee": {Step: orders[0].Step, Pool: pool, Lovelace: 10_000_000 + orderADA},
+		"no output ADA":  {Step: orders[0].Step, Pool: pool, Lovelace: 10_000_000 + v2.FIXED_BATCHER_FEE},
+		"short units": {
+			Step:     orders[1].Step,
+			Pool:     pool,
+			Lovelace: v2.FIXED_BATCHER_FEE + orderADA,
+			Units:    []apollo.Unit{apollo.NewUnit(utils.MIN.PolicyId.Value, utils.MIN.AssetName.String(), 4_000_000)},
+		},
+	}
+	for name, order := range uncovered {
+		_, err = dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), []v2.OrderSpec{orders[0], order})
+		if err == nil || !strings.HasPrefix(err.Error(), "order 1:") {
+			t.Errorf("CreateBulkOrdersTx expect an error for order 1 with %s, but get %v\n", name, err)
+		}
+	}
+}
+
+func TestOrderOptions(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, err := Address.DecodeAddress("addr_test1zrdf2f2x8pq3wwk3yv936ksmt59rz94mm66yzge8zj9pk75dvyatxqgacw6azcshwwywv0nkxkdp2l2uq5qrn628mw0s7r0f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vaultDatum := v2.ExtraDatum{Type: v2.ExtraDatumType_Inline_Datum, Hash: mustHex("9a1b3c5e7f9a1b3c5d7e9f1a3b5c7d9e1f3a5b7c9d1e3f5a7b9c1d3e5f7a9b1c")}
+	canceller := v2.AuthorizationMethod{Type: v2.AuthorizationMethodType_Spend_Script, Hash: vault.PaymentPart}
+	expiredTime := time.UnixMilli(1_700_000_000_000)
+
+	builder, err := dex.BuildStopOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, 10_000_000, 0.2, 6, 6,
+		v2.WithSuccessReceiver(vault, vaultDatum),
+		v2.WithRefundReceiver(vault, v2.ExtraDatum{}),
+		v2.WithCanceller(canceller),
+		v2.WithExpiry(expiredTime, 500_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum := findOrder(t, a, builder)
+	if orderDatum.SuccessReceiver.String() != vault.String() || orderDatum.RefundReceiver.String() != vault.String() {
+		t.Errorf("OrderOption unexpected receivers %s/%s\n", orderDatum.SuccessReceiver.String(), orderDatum.RefundReceiver.String())
+	}
+	if orderDatum.SuccessReceiverDatum.Type != v2.ExtraDatumType_Inline_Datum || !bytes.Equal(orderDatum.SuccessReceiverDatum.Hash, vaultDatum.Hash) {
+		t.Errorf("OrderOption unexpected success receiver datum %+v\n", orderDatum.SuccessReceiverDatum)
+	}
+	if orderDatum.Canceller.Type != canceller.Type || !bytes.Equal(orderDatum.Canceller.Hash, canceller.Hash) {
+		t.Errorf("OrderOption unexpected canceller %+v\n", orderDatum.Canceller)
+	}
+	expiry := v2.ExpirySetting{ExpiredTime: 1_700_000_000_000, MaxCancellationTip: 500_000}
+	if orderDatum.ExpiredOptions != expiry {
+		t.Errorf("OrderOption expect expiry %+v, but get %+v\n", expiry, orderDatum.ExpiredOptions)
+	}
+
+	swapExactIn := v2.SwapExactIn{
+		Type:      v2.StepType_Swap_Exact_In,
+		Direction: v2.Direction_A_To_B,
+		SwapAmount: v2.SwapAmount{
+			Type:   v2.AmountType_Specific_Amount,
+			Amount: 10_000_000,
+		},
+		MinimumReceived: 1,
+		Killable:        v2.Killable_Pending_On_Failed,
+	}
+	builder, err = dex.BuildSwapExactInOrderWithOptions(ctx, newTestBuilder(a), swapExactIn, utils.ADA, utils.MIN,
+		10_000_000+int(v2.FIXED_BATCHER_FEE)+2_000_000, nil, v2.WithCanceller(canceller))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum = findOrder(t, a, builder)
+	if orderDatum.Canceller.Type != canceller.Type || !bytes.Equal(orderDatum.Canceller.Hash, canceller.Hash) {
+		t.Errorf("BuildSwapExactInOrderWithOptions unexpected canceller %+v\n", orderDatum.Canceller)
+	}
+}
+
+func TestBuildCancelExpiredOrders(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := Address.DecodeAddress("addr_test1qqpfnkrx0wv3zty7c3uw9j6tvvj2tvuh7spgw80v8c353yydvyatxqgacw6azcshwwywv0nkxkdp2l2uq5qrn628mw0ssws0re")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverDatum, err := utils.UnmarshalPlutusData(mustHex("d87980"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiverDatumHash, err := PlutusData.PlutusDataHash(&receiverDatum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.AddDatum(hex.EncodeToString(receiverDatumHash.Payload), "d87980")
+
+	expiredTime := time.UnixMilli(1_700_000_000_000)
+	builder, err := dex.BuildStopOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, 10_000_000, 0.2, 6, 6,
+		v2.WithRefundReceiver(receiver, v2.ExtraDatum{Type: v2.ExtraDatumType_Inline_Datum, Hash: receiverDatumHash.Payload}),
+		v2.WithExpiry(expiredTime, 300_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderIndex, _ := findOrder(t, a, builder)
+	orderLovelace := builder.GetTx().TransactionBody.Outputs[orderIndex].GetValue().GetCoin()
+	outRefs := []constants.OutRef{{TxHash: submit(t, a, builder), Index: orderIndex}}
+
+	// the tip of the chain is before the expiry
+	a.FakeChainContext().SetLastBlockSlot(int(utils.UnixMilliToSlot(a.NetworkId(), expiredTime.UnixMilli())))
+	_, err = dex.BuildCancelExpiredOrders(ctx, newTestBuilder(a), outRefs)
+	if err == nil {
+		t.Error("BuildCancelExpiredOrders expect an error for an order not expired yet")
+	}
+
+	slot := utils.UnixMilliToSlot(a.NetworkId(), expiredTime.Add(time.Hour).UnixMilli())
+	a.FakeChainContext().SetLastBlockSlot(int(slot))
+	builder, err = dex.BuildCancelExpiredOrders(ctx, newTestBuilder(a), outRefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := builder.GetTx()
+	if tx.TransactionBody.ValidityStart != slot || tx.TransactionBody.Ttl != slot+3*60*60 {
+		t.Errorf("BuildCancelExpiredOrders expect validity %d-%d, but get %d-%d\n", slot, slot+3*60*60, tx.TransactionBody.ValidityStart, tx.TransactionBody.Ttl)
+	}
+	if tx.TransactionBody.Withdrawals == nil || tx.TransactionBody.Withdrawals.Size() != 1 {
+		t.Error("BuildCancelExpiredOrders expect a withdrawal from the expired order cancel address")
+	}
+	if len(tx.TransactionWitnessSet.Redeemer) != 2 {
+		t.Errorf("BuildCancelExpiredOrders expect 2 redeemers, but get %d\n", len(tx.TransactionWitnessSet.Redeemer))
+	}
+	if len(tx.TransactionBody.ReferenceInputs) != 2 {
+		t.Errorf("BuildCancelExpiredOrders expect 2 reference inputs, but get %d\n", len(tx.TransactionBody.ReferenceInputs))
+	}
+	refunded := false
+	for _, output := range tx.TransactionBody.Outputs {
+		if output.GetAddress().String() != receiver.String() {
+			continue
+		}
+		refunded = true
+		if output.GetValue().GetCoin() != orderLovelace-300_000 {
+			t.Errorf("BuildCancelExpiredOrders expect refund of %d lovelace, but get %d\n", orderLovelace-300_000, output.GetValue().GetCoin())
+		}
+		if datum := output.GetDatum(); datum == nil || !datum.Equal(receiverDatum) {
+			t.Errorf("BuildCancelExpiredOrders expect the refund receiver datum inline, but get %v\n", datum)
+		}
+	}
+	if !refunded {
+		t.Error("BuildCancelExpiredOrders expect an output to the refund receiver")
+	}
+	submit(t, a, builder)
+
+	// the tip leaves less than the minimum ADA of the refund output
+	builder, err = dex.BuildStopOrder(ctx, newTestBuilder(a), pool, v2.Direction_A_To_B, 10_000_000, 0.2, 6, 6,
+		v2.WithExpiry(expiredTime, uint64(orderLovelace)-500_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderIndex, _ = findOrder(t, a, builder)
+	outRefs = []constants.OutRef{{TxHash: submit(t, a, builder), Index: orderIndex}}
+	_, err = dex.BuildCancelExpiredOrders(ctx, newTestBuilder(a), outRefs)
+	if err == nil || !strings.Contains(err.Error(), "below the minimum") {
+		t.Errorf("BuildCancelExpiredOrders expect a refund below the minimum ADA error, but get %v\n", err)
+	}
+}
+
+func TestBuildCancelOrderScriptCanceller(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := Base.Output{
+		Address:     "addr_test1zrdf2f2x8pq3wwk3yv936ksmt59rz94mm66yzge8zj9pk75dvyatxqgacw6azcshwwywv0nkxkdp2l2uq5qrn628mw0s7r0f20",
+		Amount:      []Base.AddressAmount{{Unit: "lovelace", Quantity: "5000000"}},
+		InlineDatum: "d87980",
+	}
+	vaultUtxo := vault.ToUTxO("f1c9b2a3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f")
+	a.AddUtxos(*vaultUtxo)
+
+	spend := v2.AuthorizationMethod{Type: v2.AuthorizationMethodType_Spend_Script, Hash: vaultUtxo.Output.GetAddress().PaymentPart}
+	withdraw := v2.AuthorizationMethod{Type: v2.AuthorizationMethodType_Withdraw_Script, Hash: mustHex("1b6a3f5c7e9d2b4a6c8e0f1d3b5a7c9e2d4f6b8a0c1e3d5f7a9b2c4e")}
+	mint := v2.AuthorizationMethod{Type: v2.AuthorizationMethodType_Mint_Script, Hash: mustHex("2c7b4e6d8f0a3c5b7d9f1e2c4a6b8d0f3e5a7c9b1d2f4e6a8c0b3d5f")}
+	swapExactIn := v2.SwapExactIn{
+		Direction:       v2.Direction_A_To_B,
+		SwapAmount:      v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: 5_000_000},
+		MinimumReceived: 1,
+	}
+	orders := []v2.OrderSpec{}
+	// the withdraw canceller owns two orders
+	for _, canceller := range []v2.AuthorizationMethod{spend, withdraw, withdraw, mint} {
+		orders = append(orders, v2.OrderSpec{
+			Step:     swapExactIn,
+			Pool:     pool,
+			Lovelace: 5_000_000 + v2.FIXED_BATCHER_FEE + orderADA,
+			Options:  []v2.OrderOption{v2.WithCanceller(canceller)},
+		})
+	}
+	builder, err := dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), orders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHash := submit(t, a, builder)
+	outRefs := []constants.OutRef{}
+	for i := range orders {
+		outRefs = append(outRefs, constants.OutRef{TxHash: txHash, Index: i})
+	}
+
+	redeemer := PlutusData.PlutusData{TagNr: 121, PlutusDataType: PlutusData.PlutusArray, Value: PlutusData.PlutusIndefArray{}}
+	auths := []v2.CancelAuthorization{
+		{Canceller: spend, Redeemer: redeemer, Input: vaultUtxo},
+		{Canceller: withdraw, Redeemer: redeemer},
+		{Canceller: mint, Redeemer: redeemer, Mint: []apollo.Unit{apollo.NewUnit(hex.EncodeToString(mint.Hash), "cancel", 1)}},
+	}
+	_, err = dex.BuildCancelOrder(ctx, newTestBuilder(a), outRefs, auths[:2]...)
+	if err == nil {
+		t.Error("BuildCancelOrder expect an error for a canceller without authorization")
+	}
+	badMint := auths[2]
+	badMint.Mint = []apollo.Unit{apollo.NewUnit(utils.MIN.PolicyId.Value, "cancel", 1)}
+	_, err = dex.BuildCancelOrder(ctx, newTestBuilder(a), outRefs, auths[0], auths[1], badMint)
+	if err == nil {
+		t.Error("BuildCancelOrder expect an error for a mint of another policy")
+	}
+
+	builder, err = dex.BuildCancelOrder(ctx, newTestBuilder(a), outRefs, auths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := builder.GetTx()
+	// 4 orders, the vault input, the withdrawal and the mint
+	if len(tx.TransactionWitnessSet.Redeemer) != 7 {
+		t.Errorf("BuildCancelOrder expect 7 redeemers, but get %d\n", len(tx.TransactionWitnessSet.Redeemer))
+	}
+	if tx.TransactionBody.Withdrawals == nil || tx.TransactionBody.Withdrawals.Size() != 1 {
+		t.Error("BuildCancelOrder expect a withdrawal from the withdraw script canceller")
+	}
+	if len(tx.TransactionBody.Mint) != 1 {
+		t.Errorf("BuildCancelOrder expect a mint of the mint script canceller, but get %d policies\n", len(tx.TransactionBody.Mint))
+	}
+	if len(tx.TransactionBody.RequiredSigners) != 0 {
+		t.Errorf("BuildCancelOrder expect no required signers, but get %d\n", len(tx.TransactionBody.RequiredSigners))
+	}
+}
+
+func TestGetOpenOrders(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	djed := addMinDjedPool(t, a)
+
+	builder, err := dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), []v2.OrderSpec{
+		{
+			Step: v2.SwapExactIn{
+				Direction:       v2.Direction_A_To_B,
+				SwapAmount:      v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: 10_000_000},
+				MinimumReceived: 1,
+			},
+			Pool:     pool,
+			Lovelace: 10_000_000 + v2.FIXED_BATCHER_FEE + orderADA,
+		},
+		{
+			Step: v2.Stop{
+				Direction:    v2.Direction_A_To_B,
+				SwapAmount:   v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: 5_000_000},
+				StopReceived: 1_000_000,
+			},
+			Pool:     pool,
+			Lovelace: 5_000_000 + v2.FIXED_BATCHER_FEE + orderADA,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, orderDatum := findOrder(t, a, builder)
+	txHash := submit(t, a, builder)
+
+	// an order of another owner with its datum by hash, and an output that is not an order
+	vault, err := Address.DecodeAddress("addr_test1zrdf2f2x8pq3wwk3yv936ksmt59rz94mm66yzge8zj9pk75dvyatxqgacw6azcshwwywv0nkxkdp2l2uq5qrn628mw0s7r0f20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	datum := orderDatum.ToPlutusData()
+	datumHash, err := PlutusData.PlutusDataHash(&datum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.AddDatum(hex.EncodeToString(datumHash.Payload), hex.EncodeToString(orderDatumCbor(t, orderDatum)))
+	hashOrder := Base.Output{
+		Address:  vault.String(),
+		Amount:   []Base.AddressAmount{{Unit: "lovelace", Quantity: "14000000"}},
+		DataHash: hex.EncodeToString(datumHash.Payload),
+	}
+	notOrder := Base.Output{
+		Address:     vault.String(),
+		Amount:      []Base.AddressAmount{{Unit: "lovelace", Quantity: "2000000"}},
+		OutputIndex: 1,
+		InlineDatum: "d87980",
+	}
+	a.AddUtxos(*hashOrder.ToUTxO("6b1e4c9a3f0d2e8b7a5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a"),
+		*notOrder.ToUTxO("6b1e4c9a3f0d2e8b7a5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a"))
+
+	orders, errs := dex.GetOpenOrders(ctx, v2.OrderFilter{})
+	if len(orders) != 3 {
+		t.Fatalf("GetOpenOrders expect 3 orders, but get %d\n", len(orders))
+	}
+	if len(errs) != 1 {
+		t.Errorf("GetOpenOrders expect 1 error for the output that is not an order, but get %v\n", errs)
+	}
+	for _, order := range orders {
+		if order.Pool.OutRef != pool.OutRef {
+			t.Errorf("GetOpenOrders expect pool %v, but get %v\n", pool.OutRef, order.Pool.OutRef)
+		}
+	}
+	if orders[0].OutRef != (constants.OutRef{TxHash: txHash, Index: 0}) {
+		t.Errorf("GetOpenOrders expect out ref %s#0, but get %v\n", txHash, orders[0].OutRef)
+	}
+	if orders[0].Value.GetCoin() != 10_000_000+v2.FIXED_BATCHER_FEE+orderADA {
+		t.Errorf("GetOpenOrders unexpected locked value %d\n", orders[0].Value.GetCoin())
+	}
+
+	wallet, err := Address.DecodeAddress(fake.TestWalletAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minDjedLp := orderDatum.LpAsset
+	minDjedLp.AssetName, err = v2.ComputeLPAsset(utils.MIN.PolicyId.String(), utils.MIN.AssetName.HexString(),
+		djed.PolicyId.String(), djed.AssetName.HexString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		filter v2.OrderFilter
+		expect int
+	}{
+		{"owner", v2.OrderFilter{Owner: wallet.StakingPart}, 2},
+		{"other owner", v2.OrderFilter{Owner: vault.StakingPart}, 1},
+		{"step type", v2.OrderFilter{StepTypes: []v2.StepType{v2.StepType_Stop}}, 1},
+		{"owner and step type", v2.OrderFilter{Owner: vault.StakingPart, StepTypes: []v2.StepType{v2.StepType_Stop}}, 0},
+		{"pool", v2.OrderFilter{LpAsset: &orderDatum.LpAsset}, 3},
+		{"other pool", v2.OrderFilter{LpAsset: &minDjedLp}, 0},
+	}
+	for _, test := range tests {
+		orders, _ := dex.GetOpenOrders(ctx, test.filter)
+		if len(orders) != test.expect {
+			t.Errorf("GetOpenOrders %s expect %d orders, but get %d\n", test.name, test.expect, len(orders))
+		}
+	}
+}
+
+// applyBatch submits a batch applying orders to the pool at poolRef, the pool
+// gains poolLovelace and paid[i] is the output of orders[i] at the wallet
+func applyBatch(t *testing.T, a *fake.Adapter, poolRef constants.OutRef, orders []UTxO.UTxO, paid []Base.Output, poolLovelace int64) string {
+	t.Helper()
+	poolUtxo := a.GetUtxoFromRef(context.Background(), poolRef.TxHash, poolRef.Index)
+	if poolUtxo == nil {
+		t.Fatal("cannot find the pool utxo")
+	}
+	poolOutput := poolUtxo.Output.Clone()
+	poolValue := poolOutput.GetValue()
+	poolValue.AddLovelace(poolLovelace)
+	poolOutput.SetAmount(poolValue)
+
+	inputs := []TransactionInput.TransactionInput{poolUtxo.Input}
+	for _, order := range orders {
+		inputs = append(inputs, order.Input)
+	}
+	slices.SortFunc(inputs, func(a, b TransactionInput.TransactionInput) int {
+		if n := bytes.Compare(a.TransactionId, b.TransactionId); n != 0 {
+			return n
+		}
+		return a.Index - b.Index
+	})
+	tx := Transaction.Transaction{}
+	tx.TransactionBody.Inputs = inputs
+	tx.TransactionBody.Outputs = []TransactionOutput.TransactionOutput{poolOutput}
+	for i, input := range inputs {
+		j := slices.IndexFunc(orders, func(order UTxO.UTxO) bool {
+			return bytes.Equal(order.Input.TransactionId, input.TransactionId) && order.Input.Index == input.Index
+		})
+		if j < 0 {
+			continue
+		}
+		redeemer := v2.OrderRedeemer_ApplyOrder
+		redeemer.Index = i
+		tx.TransactionWitnessSet.Redeemer = append(tx.TransactionWitnessSet.Redeemer, redeemer)
+		tx.TransactionBody.Outputs = append(tx.TransactionBody.Outputs, paid[j].ToUTxO("").Output)
+	}
+	txId, err := a.ChainContext().SubmitTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(txId.Payload)
+}
+
+func TestTrackOrder(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swap := func(amount uint64, opts ...v2.OrderOption) v2.OrderSpec {
+		return v2.OrderSpec{
+			Step: v2.SwapExactIn{
+				Direction:       v2.Direction_A_To_B,
+				SwapAmount:      v2.SwapAmount{Type: v2.AmountType_Specific_Amount, Amount: amount},
+				MinimumReceived: 1,
+			},
+			Pool:     pool,
+			Lovelace: amount + v2.FIXED_BATCHER_FEE + orderADA,
+			Options:  opts,
+		}
+	}
+	expiredTime := time.UnixMilli(1_700_000_000_000)
+	builder, err := dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), []v2.OrderSpec{
+		swap(10_000_000),
+		swap(5_000_000),
+		swap(1_000_000),
+		swap(1_000_000, v2.WithExpiry(expiredTime, 300_000)),
+		{
+			Step: v2.SwapExactIn{
+				Direction:       v2.Direction_A_To_B,
+				SwapAmount:      v2.SwapAmount{Type: v2.AmountType_All, Amount: 3_000_000},
+				MinimumReceived: 1,
+			},
+			Pool:     pool,
+			Lovelace: 3_000_000 + v2.FIXED_BATCHER_FEE + orderADA,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHash := submit(t, a, builder)
+	outRefs := []constants.OutRef{}
+	orders := []UTxO.UTxO{}
+	for i := 0; i < 5; i++ {
+		outRefs = append(outRefs, constants.OutRef{TxHash: txHash, Index: i})
+		orders = append(orders, *a.GetUtxoFromRef(ctx, txHash, i))
+	}
+
+	track, err := dex.TrackOrder(ctx, outRefs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.Status != v2.OrderStatus_Pending || track.SpentBy != "" || track.Datum.Step.(v2.SwapExactIn).SwapAmount.Amount != 10_000_000 {
+		t.Errorf("TrackOrder expect a pending swap of 10000000, but get %+v\n", track)
+	}
+
+	// the MIN received tells the outputs apart
+	paid := func(order UTxO.UTxO, swapped int64, fee int64, min string) Base.Output {
+		return Base.Output{
+			Address: fake.TestWalletAddress,
+			Amount: []Base.AddressAmount{
+				{Unit: "lovelace", Quantity: strconv.FormatInt(order.Output.GetValue().GetCoin()-swapped-fee, 10)},
+				{Unit: utils.MIN.PolicyId.String() + utils.MIN.AssetName.HexString(), Quantity: min},
+			},
+		}
+	}
+	// the swap of all ADA does not fix its swapped ADA, its fee is what the
+	// others leave of the batch fee
+	batchHash := applyBatch(t, a, pool.OutRef, []UTxO.UTxO{orders[0], orders[1], orders[4]}, []Base.Output{
+		paid(orders[0], 10_000_000, 1_500_000, "2400000"),
+		paid(orders[1], 5_000_000, 1_000_000, "1200000"),
+		paid(orders[4], 3_000_000, 800_000, "700000"),
+	}, 18_000_000)
+
+	batchTests := []struct {
+		outRef    constants.OutRef
+		min       int64
+		fee       uint64
+		estimated bool
+	}{
+		{outRefs[0], 2_400_000, 1_500_000, false},
+		{outRefs[1], 1_200_000, 1_000_000, false},
+		{outRefs[4], 700_000, 800_000, true},
+	}
+	for i, test := range batchTests {
+		track, err := dex.TrackOrder(ctx, test.outRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track.Status != v2.OrderStatus_Executed || track.SpentBy != batchHash {
+			t.Errorf("TrackOrder expect order %d executed by %s, but get %d by %s\n", i, batchHash, track.Status, track.SpentBy)
+		}
+		minAmount := track.Received.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+		if minAmount != test.min {
+			t.Errorf("TrackOrder expect order %d received %d MIN, but get %d\n", i, test.min, minAmount)
+		}
+		if track.BatcherFee != test.fee || track.BatcherFeeEstimated != test.estimated {
+			t.Errorf("TrackOrder expect order %d batcher fee %d estimated %t, but get %d %t\n", i, test.fee, test.estimated, track.BatcherFee, track.BatcherFeeEstimated)
+		}
+	}
+
+	builder, err = dex.BuildCancelOrder(ctx, newTestBuilder(a), outRefs[2:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancelHash := submit(t, a, builder)
+	slot := utils.UnixMilliToSlot(a.NetworkId(), expiredTime.Add(time.Hour).UnixMilli())
+	a.FakeChainContext().SetLastBlockSlot(int(slot))
+	builder, err = dex.BuildCancelExpiredOrders(ctx, newTestBuilder(a), outRefs[3:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expireHash := submit(t, a, builder)
+
+	tests := []struct {
+		outRef  constants.OutRef
+		status  v2.OrderStatus
+		spentBy string
+	}{
+		{outRefs[2], v2.OrderStatus_Cancelled, cancelHash},
+		{outRefs[3], v2.OrderStatus_Expired, expireHash},
+	}
+	for _, test := range tests {
+		track, err := dex.TrackOrder(ctx, test.outRef)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track.Status != test.status || track.SpentBy != test.spentBy {
+			t.Errorf("TrackOrder expect status %d by %s, but get %d by %s\n", test.status, test.spentBy, track.Status, track.SpentBy)
+		}
+	}
+
+	_, err = dex.TrackOrder(ctx, constants.OutRef{TxHash: txHash, Index: 9})
+	if err == nil {
+		t.Error("TrackOrder expect an error for an unknown output")
+	}
+}
+
+func TestTrackOrderSharedReceiver(t *testing.T) {
+	dex, a := newTestDex(t)
+	ctx := context.Background()
+	pool, err := a.GetV2PoolByPair(ctx, utils.ADA, utils.MIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// both orders swap all their ADA to the wallet, their datums fix no fee
+	swapAll := func(amount uint64) v2.OrderSpec {
+		return v2.OrderSpec{
+			Step: v2.SwapExactIn{
+				Direction:       v2.Direction_A_To_B,
+				SwapAmount:      v2.SwapAmount{Type: v2.AmountType_All, Amount: amount},
+				MinimumReceived: 1,
+			},
+			Pool:     pool,
+			Lovelace: amount + v2.FIXED_BATCHER_FEE + orderADA,
+		}
+	}
+	builder, err := dex.CreateBulkOrdersTx(ctx, newTestBuilder(a), []v2.OrderSpec{swapAll(4_000_000), swapAll(6_000_000)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHash := submit(t, a, builder)
+	orders := []UTxO.UTxO{*a.GetUtxoFromRef(ctx, txHash, 0), *a.GetUtxoFromRef(ctx, txHash, 1)}
+
+	paid := func(order UTxO.UTxO, swapped int64, fee int64, min string) Base.Output {
+		return Base.Output{
+			Address: fake.TestWalletAddress,
+			Amount: []Base.AddressAmount{
+				{Unit: "lovelace", Quantity: strconv.FormatInt(order.Output.GetValue().GetCoin()-swapped-fee, 10)},
+				{Unit: utils.MIN.PolicyId.String() + utils.MIN.AssetName.HexString(), Quantity: min},
+			},
+		}
+	}
+	// the batcher keeps 1.2 and 0.8 ADA, the 2 ADA batch fee is shared evenly
+	// by their MaxBatcherFee
+	batchHash := applyBatch(t, a, pool.OutRef, orders, []Base.Output{
+		paid(orders[0], 4_000_000, 1_200_000, "900000"),
+		paid(orders[1], 6_000_000, 800_000, "1300000"),
+	}, 10_000_000)
+
+	tests := []struct {
+		min int64
+		fee uint64
+	}{
+		{900_000, 1_000_000},
+		{1_300_000, 1_000_000},
+	}
+	for i, test := range tests {
+		track, err := dex.TrackOrder(ctx, constants.OutRef{TxHash: txHash, Index: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track.Status != v2.OrderStatus_Executed || track.SpentBy != batchHash {
+			t.Errorf("TrackOrder expect order %d executed by %s, but get %d by %s\n", i, batchHash, track.Status, track.SpentBy)
+		}
+		// the outputs of the receiver are matched to the orders in input order
+		minAmount := track.Received.GetAssets().GetByPolicyAndId(utils.MIN.PolicyId, utils.MIN.AssetName)
+		if minAmount != test.min {
+			t.Errorf("TrackOrder expect order %d received %d MIN, but get %d\n", i, test.min, minAmount)
+		}
+		if track.BatcherFee != test.fee || !track.BatcherFeeEstimated {
+			t.Errorf("TrackOrder expect order %d an estimated batcher fee %d, but get %d %t\n", i, test.fee, track.BatcherFee, track.BatcherFeeEstimated)
+		}
+	}
+}
@@ -3,19 +3,19 @@ module github.com/Newt6611/go-minswap
 go 1.22.0
 
 require (
+	github.com/Newt6611/apollo v0.0.0-20240812170532-f38969b26d57
+	github.com/Salvionied/cbor/v2 v2.6.0
 	github.com/blinklabs-io/gouroboros v0.91.1
 	github.com/blockfrost/blockfrost-go v0.2.2
+	github.com/maestro-org/go-sdk v1.1.3
 	golang.org/x/crypto v0.25.0
 )
 
 require (
-	github.com/Newt6611/apollo v0.0.0-20240812170532-f38969b26d57 // indirect
-	github.com/Salvionied/cbor/v2 v2.6.0 // indirect
 	github.com/fxamacker/cbor/v2 v2.7.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-retryablehttp v0.7.5 // indirect
 	github.com/jinzhu/copier v0.4.0 // indirect
-	github.com/maestro-org/go-sdk v1.1.3 // indirect
 	github.com/tyler-smith/go-bip39 v1.1.0 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/exp v0.0.0-20230522175609-2e198f4a06a1 // indirect
@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/Address"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Salvionied/cbor/v2"
+)
+
+// DecodeError is returned by the datum decoders when a field does not have the
+// expected shape. Path locates the field from the decoded type, for example
+// "V2PoolState.AssetA.PolicyId"
+type DecodeError struct {
+	Path     string
+	Expected string
+	Got      string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s: expected %s, got %s", e.Path, e.Expected, e.Got)
+}
+
+// NestDecodeError moves a DecodeError returned by a nested decoder under path,
+// the root of its Path is replaced by path. Other errors are returned as is
+func NestDecodeError(err error, path string) error {
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		return err
+	}
+	nested := *decodeErr
+	if i := strings.IndexByte(nested.Path, '.'); i >= 0 {
+		nested.Path = path + nested.Path[i:]
+	} else {
+		nested.Path = path
+	}
+	return &nested
+}
+
+// UnmarshalPlutusData decodes CBOR into PlutusData. The apollo decoder can panic
+// on malformed input, the panic is returned as an error
+func UnmarshalPlutusData(b []byte) (plutusData PlutusData.PlutusData, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			plutusData = PlutusData.PlutusData{}
+			err = fmt.Errorf("invalid plutus data: %v", r)
+		}
+	}()
+	err = cbor.Unmarshal(b, &plutusData)
+	return plutusData, err
+}
+
+// constrIndex maps a CBOR tag to a constructor index, 121..127 are 0..6 and
+// 1280..1400 are 7..127
+func constrIndex(tagNr uint64) (uint64, bool) {
+	if tagNr >= 121 && tagNr <= 127 {
+		return tagNr - 121, true
+	}
+	if tagNr >= 1280 && tagNr <= 1400 {
+		return tagNr - 1280 + 7, true
+	}
+	return 0, false
+}
+
+func arrayFields(plutusData *PlutusData.PlutusData) ([]PlutusData.PlutusData, bool) {
+	switch fields := plutusData.Value.(type) {
+	case PlutusData.PlutusIndefArray:
+		return fields, true
+	case PlutusData.PlutusDefArray:
+		return fields, true
+	}
+	return nil, false
+}
+
+// describe summarizes plutusData for DecodeError.Got
+func describe(plutusData *PlutusData.PlutusData) string {
+	if plutusData == nil {
+		return "nothing"
+	}
+	switch value := plutusData.Value.(type) {
+	case nil:
+		return "unsupported value"
+	case uint64, big.Int, *big.Int:
+		return "int"
+	case []byte:
+		return "bytes"
+	case PlutusData.PlutusIndefArray, PlutusData.PlutusDefArray:
+		fields, _ := arrayFields(plutusData)
+		if plutusData.TagNr == 0 {
+			return fmt.Sprintf("list of %d", len(fields))
+		}
+		if index, ok := constrIndex(plutusData.TagNr); ok {
+			return fmt.Sprintf("constructor %d with %d fields", index, len(fields))
+		}
+		return fmt.Sprintf("tag %d", plutusData.TagNr)
+	default:
+		if plutusData.PlutusDataType == PlutusData.PlutusMap {
+			return "map"
+		}
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// DecodeConstr returns the constructor index and fields of plutusData
+func DecodeConstr(plutusData *PlutusData.PlutusData, path string) (uint64, []PlutusData.PlutusData, error) {
+	fields, ok := arrayFields(plutusData)
+	if !ok {
+		return 0, nil, &DecodeError{Path: path, Expected: "constructor", Got: describe(plutusData)}
+	}
+	index, ok := constrIndex(plutusData.TagNr)
+	if !ok {
+		return 0, nil, &DecodeError{Path: path, Expected: "constructor", Got: describe(plutusData)}
+	}
+	return index, fields, nil
+}
+
+// DecodeConstrFields checks that plutusData is constructor index with n fields
+// and returns the fields
+func DecodeConstrFields(plutusData *PlutusData.PlutusData, path string, index uint64, n int) ([]PlutusData.PlutusData, error) {
+	got, fields, err := DecodeConstr(plutusData, path)
+	if err == nil && (got != index || len(fields) != n) {
+		err = &DecodeError{Path: path, Expected: fmt.Sprintf("constructor %d with %d fields", index, n), Got: describe(plutusData)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// DecodeConstrOf checks that plutusData is one of len(arities) constructors,
+// constructor i having arities[i] fields, and returns its index and fields
+func DecodeConstrOf(plutusData *PlutusData.PlutusData, path string, arities ...int) (uint64, []PlutusData.PlutusData, error) {
+	index, fields, err := DecodeConstr(plutusData, path)
+	if err != nil {
+		return 0, nil, err
+	}
+	if index >= uint64(len(arities)) || len(fields) != arities[index] {
+		expected := make([]string, len(arities))
+		for i, n := range arities {
+			expected[i] = fmt.Sprintf("constructor %d with %d fields", i, n)
+		}
+		return 0, nil, &DecodeError{Path: path, Expected: strings.Join(expected, " or "), Got: describe(plutusData)}
+	}
+	return index, fields, nil
+}
+
+// DecodeUint returns plutusData as an uint64, big integers are accepted as long
+// as they fit
+func DecodeUint(plutusData *PlutusData.PlutusData, path string) (uint64, error) {
+	switch value := plutusData.Value.(type) {
+	case uint64:
+		return value, nil
+	case big.Int:
+		if value.IsUint64() {
+			return value.Uint64(), nil
+		}
+	case *big.Int:
+		if value != nil && value.IsUint64() {
+			return value.Uint64(), nil
+		}
+	}
+	return 0, &DecodeError{Path: path, Expected: "unsigned int", Got: describe(plutusData)}
+}
+
+func DecodeBytes(plutusData *PlutusData.PlutusData, path string) ([]byte, error) {
+	value, ok := plutusData.Value.([]byte)
+	if !ok {
+		return nil, &DecodeError{Path: path, Expected: "bytes", Got: describe(plutusData)}
+	}
+	return value, nil
+}
+
+// DecodeList returns the items of an untagged list
+func DecodeList(plutusData *PlutusData.PlutusData, path string) ([]PlutusData.PlutusData, error) {
+	items, ok := arrayFields(plutusData)
+	if !ok || plutusData.TagNr != 0 {
+		return nil, &DecodeError{Path: path, Expected: "list", Got: describe(plutusData)}
+	}
+	return items, nil
+}
+
+// paymentCredential decodes VerificationKey(hash) or Script(hash)
+func paymentCredential(plutusData *PlutusData.PlutusData, path string) (Credential, error) {
+	var credential Credential
+	index, fields, err := DecodeConstrOf(plutusData, path, 1, 1)
+	if err != nil {
+		return credential, err
+	}
+	credential.Type = CredentialType(index)
+	credential.Hash, err = DecodeBytes(&fields[0], path+".Hash")
+	return credential, err
+}
+
+// AddressFromPlutusData decodes an Aiken Address, stake pointers are not
+// supported
+func AddressFromPlutusData(plutusData *PlutusData.PlutusData, network c.Network) (Address.Address, error) {
+	fields, err := DecodeConstrFields(plutusData, "Address", 0, 2)
+	if err != nil {
+		return Address.Address{}, err
+	}
+	payment, err := paymentCredential(&fields[0], "Address.PaymentCredential")
+	if err != nil {
+		return Address.Address{}, err
+	}
+
+	var stake *Credential
+	index, stakeFields, err := DecodeConstrOf(&fields[1], "Address.StakeCredential", 1, 0)
+	if err != nil {
+		return Address.Address{}, err
+	}
+	if index == 0 {
+		// Inline(credential), Pointer is constructor 1
+		inline, err := DecodeConstrFields(&stakeFields[0], "Address.StakeCredential", 0, 1)
+		if err != nil {
+			return Address.Address{}, err
+		}
+		credential, err := paymentCredential(&inline[0], "Address.StakeCredential")
+		if err != nil {
+			return Address.Address{}, err
+		}
+		stake = &credential
+	}
+
+	addr := Address.Address{
+		PaymentPart: payment.Hash,
+		StakingPart: []byte{},
+		Network:     Address.TESTNET,
+	}
+	if network == c.MAINNET {
+		addr.Network = Address.MAINNET
+	}
+	switch {
+	case stake == nil && payment.Type == CredentialTypeKey:
+		addr.AddressType = Address.KEY_NONE
+	case stake == nil:
+		addr.AddressType = Address.SCRIPT_NONE
+	case payment.Type == CredentialTypeKey && stake.Type == CredentialTypeKey:
+		addr.AddressType = Address.KEY_KEY
+	case payment.Type == CredentialTypeKey:
+		addr.AddressType = Address.KEY_SCRIPT
+	case stake.Type == CredentialTypeKey:
+		addr.AddressType = Address.SCRIPT_KEY
+	default:
+		addr.AddressType = Address.SCRIPT_SCRIPT
+	}
+	if stake != nil {
+		addr.StakingPart = stake.Hash
+	}
+	addr.HeaderByte = addr.AddressType<<4 | addr.Network
+	addr.Hrp = Address.ComputeHrp(addr.AddressType, addr.Network)
+	return addr, nil
+}
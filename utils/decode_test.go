@@ -0,0 +1,134 @@
+package utils_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	c "github.com/Newt6611/apollo/constants"
+	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/go-minswap/utils"
+)
+
+const (
+	testV2PoolDatum     = "d8799fd8799fd87a9f581cd6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8feffffd8799f4040ffd8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72434d494eff1a3b9aca001a773594001a1dcd6500181e181ed87a80d87980ff"
+	testStablePoolDatum = "d8799f9f1a000f42401a001e8480ff1a002dc6c00a581ce08460587b08cca542bd2856b8d5e1d23bf3f63f9916fb81f6d95fdaff"
+	// addr_test1qpssc0r090a9u0pyvdr9y76sm2xzx04n6d4j0y5hukcx6rxz4dtgkhfdynadkea0qezv99wljdl076xkg2krm96nn8jszmh3w7
+	testAddressDatum = "d8799fd8799f581c610c3c6f2bfa5e3c246346527b50da8c233eb3d36b279297e5b06d0cffd8799fd8799fd8799f581cc2ab568b5d2d24fadb67af0644c295df937eff68d642ac3d975399e5ffffffff"
+)
+
+func mustUnmarshal(t testing.TB, s string) PlutusData.PlutusData {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plutusData, err := utils.UnmarshalPlutusData(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plutusData
+}
+
+func TestConvertToV2PoolStateDecodeError(t *testing.T) {
+	pool, err := utils.ConvertToV2PoolState(mustUnmarshal(t, testV2PoolDatum))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.ReserveA != 2_000_000_000 || pool.ReserveB != 500_000_000 || pool.TotalLiquidity != 1_000_000_000 {
+		t.Errorf("ConvertToV2PoolState expect reserves 2000000000/500000000, but get %d/%d\n", pool.ReserveA, pool.ReserveB)
+	}
+
+	tests := []struct {
+		name  string
+		datum string
+		path  string
+	}{
+		{"not a constructor", "1a3b9aca00", "V2PoolState"},
+		{"missing fields", "d8799f1a3b9aca00ff", "V2PoolState"},
+		// ReserveA is bytes
+		{"wrong field type", "d8799fd8799fd87a9f581cd6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8feffffd8799f4040ffd8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72434d494eff1a3b9aca0041001a1dcd6500181e181ed87a80d87980ff", "V2PoolState.ReserveA"},
+		// AssetA policy is an int
+		{"nested field", "d8799fd8799fd87a9f581cd6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8feffffd8799f0040ffd8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72434d494eff1a3b9aca001a773594001a1dcd6500181e181ed87a80d87980ff", "V2PoolState.AssetA.PolicyId"},
+		// AllowDynamicFee is constructor 2
+		{"wrong constructor", "d8799fd8799fd87a9f581cd6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8feffffd8799f4040ffd8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72434d494eff1a3b9aca001a773594001a1dcd6500181e181ed87a80d87b80ff", "V2PoolState.AllowDynamicFee"},
+	}
+	for _, test := range tests {
+		_, err := utils.ConvertToV2PoolState(mustUnmarshal(t, test.datum))
+		var decodeErr *utils.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%s: expect DecodeError, but get %v\n", test.name, err)
+			continue
+		}
+		if decodeErr.Path != test.path {
+			t.Errorf("%s: expect path %s, but get %s\n", test.name, test.path, decodeErr.Path)
+		}
+	}
+}
+
+func TestAddressFromPlutusData(t *testing.T) {
+	plutusData := mustUnmarshal(t, testAddressDatum)
+	address, err := utils.AddressFromPlutusData(&plutusData, c.TESTNET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "addr_test1qpssc0r090a9u0pyvdr9y76sm2xzx04n6d4j0y5hukcx6rxz4dtgkhfdynadkea0qezv99wljdl076xkg2krm96nn8jszmh3w7"
+	if address.String() != expect {
+		t.Errorf("AddressFromPlutusData expect %s, but get %s\n", expect, address.String())
+	}
+}
+
+// fuzzDecoder checks that decode never panics on arbitrary CBOR and only fails
+// with a DecodeError
+func fuzzDecoder(f *testing.F, seeds []string, decode func(PlutusData.PlutusData) error) {
+	for _, seed := range seeds {
+		b, _ := hex.DecodeString(seed)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		plutusData, err := utils.UnmarshalPlutusData(b)
+		if err != nil {
+			return
+		}
+		err = decode(plutusData)
+		var decodeErr *utils.DecodeError
+		if err != nil && !errors.As(err, &decodeErr) {
+			t.Errorf("expect DecodeError, but get %v", err)
+		}
+	})
+}
+
+func FuzzConvertToV2PoolState(f *testing.F) {
+	fuzzDecoder(f, []string{testV2PoolDatum, testStablePoolDatum}, func(plutusData PlutusData.PlutusData) error {
+		_, err := utils.ConvertToV2PoolState(plutusData)
+		return err
+	})
+}
+
+func FuzzConvertToStablePoolState(f *testing.F) {
+	fuzzDecoder(f, []string{testStablePoolDatum, testV2PoolDatum}, func(plutusData PlutusData.PlutusData) error {
+		_, err := utils.ConvertToStablePoolState(plutusData)
+		return err
+	})
+}
+
+func FuzzCredentialFromPlutusData(f *testing.F) {
+	fuzzDecoder(f, []string{"d8799fd87a9f581cd6ba9b7509eac866288ff5072d2a18205ac56f744bc82dcd808cb8feffff"}, func(plutusData PlutusData.PlutusData) error {
+		_, err := utils.CredentialFromPlutusData(&plutusData)
+		return err
+	})
+}
+
+func FuzzFingerprintFromPlutusData(f *testing.F) {
+	fuzzDecoder(f, []string{"d8799f4040ff", "d8799f581ce16c2dc8ae937e8d3790c7fd7168d7b994621ba14ca11415f39fed72434d494eff"}, func(plutusData PlutusData.PlutusData) error {
+		_, err := utils.FingerprintFromPlutusData(&plutusData)
+		return err
+	})
+}
+
+func FuzzAddressFromPlutusData(f *testing.F) {
+	fuzzDecoder(f, []string{testAddressDatum}, func(plutusData PlutusData.PlutusData) error {
+		_, err := utils.AddressFromPlutusData(&plutusData, c.MAINNET)
+		return err
+	})
+}
@@ -173,3 +173,106 @@ func CalculateDepositSwapAmount(amountIn, amountOut, reserveIn, reserveOut, trad
 		Denominator: denominator,
 	}
 }
+
+// CalculateWithdrawAmount returns the amounts of asset A and B withdrawn from
+// pool for lpAmount
+func CalculateWithdrawAmount(lpAmount uint64, pool V2PoolState) (uint64, uint64) {
+	lpAmount_b := new(big.Int).SetUint64(lpAmount)
+	totalLiquidity_b := new(big.Int).SetUint64(pool.TotalLiquidity)
+	if totalLiquidity_b.Sign() == 0 {
+		return 0, 0
+	}
+
+	// amount_a = lp_amount * reserve_a / total_liquidity
+	amountA := new(big.Int).Mul(lpAmount_b, new(big.Int).SetUint64(pool.ReserveA))
+	amountA.Div(amountA, totalLiquidity_b)
+
+	amountB := new(big.Int).Mul(lpAmount_b, new(big.Int).SetUint64(pool.ReserveB))
+	amountB.Div(amountB, totalLiquidity_b)
+
+	return amountA.Uint64(), amountB.Uint64()
+}
+
+// CalculateZapOutAmount returns the amount of the out asset received for
+// lpAmount, the withdrawn out asset plus the withdrawn in asset swapped against
+// what is left in the pool after the withdrawal
+func CalculateZapOutAmount(lpAmount, reserveIn, reserveOut, totalLiquidity, tradingFeeNumerator uint64) uint64 {
+	if totalLiquidity == 0 {
+		return 0
+	}
+	withdrawIn, withdrawOut := CalculateWithdrawAmount(lpAmount, V2PoolState{
+		ReserveA:       reserveIn,
+		ReserveB:       reserveOut,
+		TotalLiquidity: totalLiquidity,
+	})
+	swapOut := CalculateAmountOut(reserveIn-withdrawIn, reserveOut-withdrawOut, withdrawIn, tradingFeeNumerator)
+	return withdrawOut + swapOut
+}
+
+// CalculateWithdrawImbalanceAmount estimates the amount of asset A received for
+// lpAmount when the withdrawal is rebalanced to ratioA:ratioB. The asset in
+// excess is swapped against the pool left after the withdrawal, the largest
+// swap keeping it in excess is found by bisection
+func CalculateWithdrawImbalanceAmount(lpAmount, ratioA, ratioB uint64, pool V2PoolState) uint64 {
+	amountA, amountB := CalculateWithdrawAmount(lpAmount, pool)
+	reserveA, reserveB := pool.ReserveA-amountA, pool.ReserveB-amountB
+	ratioA_b := new(big.Int).SetUint64(ratioA)
+	ratioB_b := new(big.Int).SetUint64(ratioB)
+
+	// inExcess reports whether in * ratioIn >= out * ratioOut
+	inExcess := func(in, out uint64, ratioIn, ratioOut *big.Int) bool {
+		lhs := new(big.Int).Mul(new(big.Int).SetUint64(in), ratioOut)
+		rhs := new(big.Int).Mul(new(big.Int).SetUint64(out), ratioIn)
+		return lhs.Cmp(rhs) >= 0
+	}
+	// largestSwap returns the largest swap of amountIn keeping it in excess
+	largestSwap := func(amountIn, amountOut, reserveIn, reserveOut, feeNumerator uint64, ratioIn, ratioOut *big.Int) uint64 {
+		low, high := uint64(0), amountIn
+		for low < high {
+			mid := low + (high-low+1)/2
+			out := CalculateAmountOut(reserveIn, reserveOut, mid, feeNumerator)
+			if inExcess(amountIn-mid, amountOut+out, ratioIn, ratioOut) {
+				low = mid
+			} else {
+				high = mid - 1
+			}
+		}
+		return low
+	}
+
+	if inExcess(amountA, amountB, ratioA_b, ratioB_b) {
+		swap := largestSwap(amountA, amountB, reserveA, reserveB, pool.BaseFeeANumerator, ratioA_b, ratioB_b)
+		return amountA - swap
+	}
+	swap := largestSwap(amountB, amountA, reserveB, reserveA, pool.BaseFeeBNumerator, ratioB_b, ratioA_b)
+	return amountA + CalculateAmountOut(reserveB, reserveA, swap, pool.BaseFeeBNumerator)
+}
+
+/*
+CalculateAmountOut is the swap formula of the pool contract
+pub fn calculate_amount_out(
+
+	reserve_in: Int,
+	reserve_out: Int,
+	amount_in: Int,
+	trading_fee_numerator: Int,
+	) -> Int {
+	  let diff = utils.default_fee_denominator - trading_fee_numerator
+	  let in_with_fee = diff * amount_in
+	  let numerator = in_with_fee * reserve_out
+	  let denominator = utils.default_fee_denominator * reserve_in + in_with_fee
+	  numerator / denominator
+	}
+*/
+func CalculateAmountOut(reserveIn, reserveOut, amountIn, tradingFeeNumerator uint64) uint64 {
+	diff := new(big.Int).SetUint64(DEFAULT_TRADING_FEE_DENOMINATOR - tradingFeeNumerator)
+	inWithFee := new(big.Int).Mul(diff, new(big.Int).SetUint64(amountIn))
+
+	numerator := new(big.Int).Mul(inWithFee, new(big.Int).SetUint64(reserveOut))
+	denominator := new(big.Int).Mul(new(big.Int).SetUint64(DEFAULT_TRADING_FEE_DENOMINATOR), new(big.Int).SetUint64(reserveIn))
+	denominator.Add(denominator, inWithFee)
+	if denominator.Sign() == 0 {
+		return 0
+	}
+	return numerator.Div(numerator, denominator).Uint64()
+}
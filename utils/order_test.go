@@ -41,3 +41,95 @@ func TestCalculateDepositSwapAmount(t *testing.T) {
 		t.Errorf("CalculateDepositSwapAmount() got = %v, want %v", result, 29932544594688)
 	}
 }
+
+func TestCalculateWithdrawAmount(t *testing.T) {
+	pool := utils.V2PoolState{
+		ReserveA:          2_000_000_000,
+		ReserveB:          500_000_000,
+		TotalLiquidity:    1_000_000_000,
+		BaseFeeANumerator: 30,
+		BaseFeeBNumerator: 30,
+	}
+	amountA, amountB := utils.CalculateWithdrawAmount(10_000_000, pool)
+	if amountA != 20_000_000 || amountB != 5_000_000 {
+		t.Errorf("CalculateWithdrawAmount() got = %v/%v, want %v/%v", amountA, amountB, 20_000_000, 5_000_000)
+	}
+
+	// 5 MIN withdrawn plus 20 ADA swapped against 1980 ADA / 495 MIN
+	zapOutB := utils.CalculateZapOutAmount(10_000_000, pool.ReserveA, pool.ReserveB, pool.TotalLiquidity, pool.BaseFeeANumerator)
+	if zapOutB != 9_935_298 {
+		t.Errorf("CalculateZapOutAmount() got = %v, want %v", zapOutB, 9_935_298)
+	}
+	zapOutA := utils.CalculateZapOutAmount(10_000_000, pool.ReserveB, pool.ReserveA, pool.TotalLiquidity, pool.BaseFeeBNumerator)
+	if zapOutA != 39_741_192 {
+		t.Errorf("CalculateZapOutAmount() got = %v, want %v", zapOutA, 39_741_192)
+	}
+
+	tests := []struct {
+		ratioA  uint64
+		ratioB  uint64
+		amountA uint64
+	}{
+		// the pool ratio needs no swap
+		{4, 1, 20_000_000},
+		// all A is a zap out to A
+		{1, 0, 39_741_192},
+		{0, 1, 0},
+	}
+	for _, test := range tests {
+		amountA := utils.CalculateWithdrawImbalanceAmount(10_000_000, test.ratioA, test.ratioB, pool)
+		if amountA != test.amountA {
+			t.Errorf("CalculateWithdrawImbalanceAmount(%d:%d) got = %v, want %v", test.ratioA, test.ratioB, amountA, test.amountA)
+		}
+	}
+	// 1:1 swaps about 12 ADA into 3 MIN, leaving 8 of each
+	amountA = utils.CalculateWithdrawImbalanceAmount(10_000_000, 1, 1, pool)
+	if amountA < 7_900_000 || amountA > 8_000_000 {
+		t.Errorf("CalculateWithdrawImbalanceAmount(1:1) got = %v, want about %v", amountA, 8_000_000)
+	}
+}
+
+// The expected amounts solve the withdraw imbalance condition
+// (a - x) * ratioB = (b + amount_out(x)) * ratioA for the swap x in closed form,
+// x = (-B + isqrt(B^2 + 4AC)) / 2A with exact integers, independently of the
+// bisection
+func TestCalculateWithdrawImbalanceAmountClosedForm(t *testing.T) {
+	tests := []struct {
+		lpAmount uint64
+		ratioA   uint64
+		ratioB   uint64
+		pool     utils.V2PoolState
+		amountA  uint64
+	}{
+		{
+			lpAmount: 10_000_000_000, ratioA: 3, ratioB: 1,
+			pool: utils.V2PoolState{
+				ReserveA: 3_000_000_000_000, ReserveB: 1_500_000_000_000, TotalLiquidity: 2_100_000_000_000,
+				BaseFeeANumerator: 30, BaseFeeBNumerator: 30,
+			},
+			amountA: 17_136_071_898,
+		},
+		{
+			lpAmount: 10_000_000_000, ratioA: 1, ratioB: 4,
+			pool: utils.V2PoolState{
+				ReserveA: 3_000_000_000_000, ReserveB: 1_500_000_000_000, TotalLiquidity: 2_100_000_000_000,
+				BaseFeeANumerator: 30, BaseFeeBNumerator: 30,
+			},
+			amountA: 3_166_340_014,
+		},
+		{
+			lpAmount: 1_234_567_890, ratioA: 2, ratioB: 5,
+			pool: utils.V2PoolState{
+				ReserveA: 45_678_901_234, ReserveB: 987_654_321_000, TotalLiquidity: 200_000_000_000,
+				BaseFeeANumerator: 100, BaseFeeBNumerator: 50,
+			},
+			amountA: 503_513_241,
+		},
+	}
+	for _, test := range tests {
+		amountA := utils.CalculateWithdrawImbalanceAmount(test.lpAmount, test.ratioA, test.ratioB, test.pool)
+		if amountA != test.amountA {
+			t.Errorf("CalculateWithdrawImbalanceAmount(%d:%d) got = %v, want %v", test.ratioA, test.ratioB, amountA, test.amountA)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"fmt"
+
 	"github.com/Newt6611/apollo/serialization/PlutusData"
 )
 
@@ -13,18 +15,35 @@ type StablePoolState struct {
 
 func ConvertToStablePoolState(plutusData PlutusData.PlutusData) (StablePoolState, error) {
 	var stablePoolState StablePoolState
-	_ = stablePoolState
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
+	data, err := DecodeConstrFields(&plutusData, "StablePoolState", 0, 4)
+	if err != nil {
+		return StablePoolState{}, err
+	}
 
-	balanceArr := data[0].Value.(PlutusData.PlutusIndefArray)
-	for _, balance := range balanceArr {
-		i := balance.Value.(uint64)
-		stablePoolState.Balances = append(stablePoolState.Balances, i)
+	balanceArr, err := DecodeList(&data[0], "StablePoolState.Balances")
+	if err != nil {
+		return StablePoolState{}, err
+	}
+	for i, balance := range balanceArr {
+		b, err := DecodeUint(&balance, fmt.Sprintf("StablePoolState.Balances[%d]", i))
+		if err != nil {
+			return StablePoolState{}, err
+		}
+		stablePoolState.Balances = append(stablePoolState.Balances, b)
 	}
 
-	stablePoolState.TotalLiquidity = data[1].Value.(uint64)
-	stablePoolState.AMP = data[2].Value.(uint64)
-	stablePoolState.OrderHash = data[3].Value.([]byte)
+	stablePoolState.TotalLiquidity, err = DecodeUint(&data[1], "StablePoolState.TotalLiquidity")
+	if err != nil {
+		return StablePoolState{}, err
+	}
+	stablePoolState.AMP, err = DecodeUint(&data[2], "StablePoolState.AMP")
+	if err != nil {
+		return StablePoolState{}, err
+	}
+	stablePoolState.OrderHash, err = DecodeBytes(&data[3], "StablePoolState.OrderHash")
+	if err != nil {
+		return StablePoolState{}, err
+	}
 
 	return stablePoolState, nil
 }
@@ -2,13 +2,14 @@ package utils
 
 import (
 	"encoding/hex"
-	"fmt"
 
+	c "github.com/Newt6611/apollo/constants"
 	"github.com/Newt6611/apollo/serialization/Address"
 	"github.com/Newt6611/apollo/serialization/AssetName"
 	"github.com/Newt6611/apollo/serialization/Fingerprint"
 	"github.com/Newt6611/apollo/serialization/PlutusData"
 	"github.com/Newt6611/apollo/serialization/Policy"
+	"github.com/Newt6611/go-minswap/constants"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -35,20 +36,13 @@ type Credential struct {
 	Hash []byte
 }
 
+// CredentialFromPlutusData decodes an inline StakeCredential
 func CredentialFromPlutusData(plutusData *PlutusData.PlutusData) (Credential, error) {
-	var credential Credential
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)[0]
-	switch data.TagNr {
-	case 121:
-		credential.Type = CredentialTypeKey
-		credential.Hash = data.Value.(PlutusData.PlutusIndefArray)[0].Value.([]byte)
-	case 121 + 1:
-		credential.Type = CredentialTypeScript
-		credential.Hash = data.Value.(PlutusData.PlutusIndefArray)[0].Value.([]byte)
-	default:
-		return credential, fmt.Errorf("invalid CredentialFromPlutusData")
+	fields, err := DecodeConstrFields(plutusData, "Credential", 0, 1)
+	if err != nil {
+		return Credential{}, err
 	}
-	return credential, nil
+	return paymentCredential(&fields[0], "Credential")
 }
 
 func Sha3(hexString string) (string, error) {
@@ -77,17 +71,34 @@ func IsScriptAddress(address Address.Address) bool {
 
 func FingerprintFromPlutusData(plutusData *PlutusData.PlutusData) (Fingerprint.Fingerprint, error) {
 	var fingerprint Fingerprint.Fingerprint
-	policyHash, ok := plutusData.Value.(PlutusData.PlutusIndefArray)[0].Value.([]byte)
-	if !ok {
-		return fingerprint, fmt.Errorf("invalid FingerprintFromPlutusData Policy\n")
+	fields, err := DecodeConstrFields(plutusData, "Fingerprint", 0, 2)
+	if err != nil {
+		return fingerprint, err
+	}
+
+	policyHash, err := DecodeBytes(&fields[0], "Fingerprint.PolicyId")
+	if err != nil {
+		return fingerprint, err
 	}
 
-	assetNameHash, ok := plutusData.Value.(PlutusData.PlutusIndefArray)[1].Value.([]byte)
-	if !ok {
-		return fingerprint, fmt.Errorf("invalid FingerprintFromPlutusData AssetName\n")
+	assetNameHash, err := DecodeBytes(&fields[1], "Fingerprint.AssetName")
+	if err != nil {
+		return fingerprint, err
 	}
 
 	fingerprint.PolicyId.Value = hex.EncodeToString(policyHash)
 	fingerprint.AssetName.Value = hex.EncodeToString(assetNameHash)
 	return fingerprint, nil
 }
+
+// SlotToUnixMilli returns the POSIX time in milliseconds at the start of slot
+func SlotToUnixMilli(network c.Network, slot int64) int64 {
+	config := constants.SlotConfigs[network]
+	return config.ZeroTime + (slot-config.ZeroSlot)*config.SlotLength
+}
+
+// UnixMilliToSlot returns the slot holding the POSIX time unixMilli
+func UnixMilliToSlot(network c.Network, unixMilli int64) int64 {
+	config := constants.SlotConfigs[network]
+	return config.ZeroSlot + (unixMilli-config.ZeroTime)/config.SlotLength
+}
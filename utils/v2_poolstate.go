@@ -1,11 +1,13 @@
 package utils
 
 import (
-	"errors"
 	"fmt"
 
+	"github.com/Newt6611/apollo/serialization/Address"
 	"github.com/Newt6611/apollo/serialization/Fingerprint"
 	"github.com/Newt6611/apollo/serialization/PlutusData"
+	"github.com/Newt6611/apollo/serialization/Value"
+	"github.com/Newt6611/go-minswap/constants"
 )
 
 type FeeSharingOpt struct {
@@ -15,6 +17,13 @@ type FeeSharingOpt struct {
 
 type V2PoolState struct {
 	Datum string
+	// The pool UTxO, it changes with every batch applied to the pool
+	OutRef constants.OutRef
+	// Address of the pool UTxO
+	Address Address.Address
+	// Value locked in the pool UTxO, the reserves plus the pool NFT, the
+	// remaining LP tokens and the ADA buffer
+	Value Value.Value
 	// pool_batching_stake_credential: StakeCredential,
 	PoolBatchingStakeCredential Credential
 	// The Pool's Asset A
@@ -40,40 +49,94 @@ type V2PoolState struct {
 
 func ConvertToV2PoolState(plutusData PlutusData.PlutusData) (V2PoolState, error) {
 	poolState := V2PoolState{}
-	var err error
-	data := plutusData.Value.(PlutusData.PlutusIndefArray)
-	if plutusData.TagNr != 121 {
-		errStr := fmt.Sprintf("index of pool datum must be 0, actual: %d", plutusData.TagNr)
-		return V2PoolState{}, errors.New(errStr)
+	data, err := DecodeConstrFields(&plutusData, "V2PoolState", 0, 10)
+	if err != nil {
+		return V2PoolState{}, err
 	}
 
 	poolState.PoolBatchingStakeCredential, err = CredentialFromPlutusData(&data[0])
 	if err != nil {
-		return V2PoolState{}, err
+		return V2PoolState{}, NestDecodeError(err, "V2PoolState.PoolBatchingStakeCredential")
 	}
 
 	poolState.AssetA, err = FingerprintFromPlutusData(&data[1])
 	if err != nil {
-		return V2PoolState{}, err
+		return V2PoolState{}, NestDecodeError(err, "V2PoolState.AssetA")
 	}
 	poolState.AssetB, err = FingerprintFromPlutusData(&data[2])
 	if err != nil {
-		return V2PoolState{}, err
+		return V2PoolState{}, NestDecodeError(err, "V2PoolState.AssetB")
 	}
 
-	poolState.TotalLiquidity = data[3].Value.(uint64)
-	poolState.ReserveA = data[4].Value.(uint64)
-	poolState.ReserveB = data[5].Value.(uint64)
-	poolState.BaseFeeANumerator = data[6].Value.(uint64)
-	poolState.BaseFeeBNumerator = data[7].Value.(uint64)
+	amounts := []struct {
+		field *uint64
+		name  string
+	}{
+		{&poolState.TotalLiquidity, "TotalLiquidity"},
+		{&poolState.ReserveA, "ReserveA"},
+		{&poolState.ReserveB, "ReserveB"},
+		{&poolState.BaseFeeANumerator, "BaseFeeANumerator"},
+		{&poolState.BaseFeeBNumerator, "BaseFeeBNumerator"},
+	}
+	for i, amount := range amounts {
+		*amount.field, err = DecodeUint(&data[3+i], "V2PoolState."+amount.name)
+		if err != nil {
+			return V2PoolState{}, err
+		}
+	}
 
-	if data[8].TagNr == 121 {
+	index, feeSharing, err := DecodeConstrOf(&data[8], "V2PoolState.FeeSharingNumeratorOpt", 1, 0)
+	if err != nil {
+		return V2PoolState{}, err
+	}
+	if index == 0 {
 		poolState.FeeSharingNumeratorOpt.Enable = true
-		poolState.FeeSharingNumeratorOpt.Numerator = data[8].Value.(PlutusData.PlutusIndefArray)[0].Value.(uint64)
+		poolState.FeeSharingNumeratorOpt.Numerator, err = DecodeUint(&feeSharing[0], "V2PoolState.FeeSharingNumeratorOpt.Numerator")
+		if err != nil {
+			return V2PoolState{}, err
+		}
 	} else {
 		poolState.FeeSharingNumeratorOpt.Enable = false
 	}
 
-	poolState.AllowDynamicFee = data[9].TagNr == 122
+	index, _, err = DecodeConstrOf(&data[9], "V2PoolState.AllowDynamicFee", 0, 0)
+	if err != nil {
+		return V2PoolState{}, err
+	}
+	poolState.AllowDynamicFee = index == 1
 	return poolState, nil
 }
+
+// ValueAmount returns the quantity of asset locked in the pool UTxO
+func (p V2PoolState) ValueAmount(asset Fingerprint.Fingerprint) uint64 {
+	if asset.String() == "lovelace" {
+		return uint64(max(p.Value.GetCoin(), 0))
+	}
+	quantity := p.Value.GetAssets().GetByPolicyAndId(asset.PolicyId, asset.AssetName)
+	return uint64(max(quantity, 0))
+}
+
+// ADABuffer returns the lovelace locked in the pool UTxO that is not part of
+// the ADA reserve
+func (p V2PoolState) ADABuffer() uint64 {
+	lovelace := p.ValueAmount(ADA)
+	if p.AssetA.String() != "lovelace" {
+		return lovelace
+	}
+	if lovelace < p.ReserveA {
+		return 0
+	}
+	return lovelace - p.ReserveA
+}
+
+// VerifyReserves checks that the pool UTxO locks at least the reserves of its
+// datum
+func (p V2PoolState) VerifyReserves() error {
+	if amount := p.ValueAmount(p.AssetA); amount < p.ReserveA {
+		return fmt.Errorf("pool %s#%d locks %d of asset A, datum reserve is %d", p.OutRef.TxHash, p.OutRef.Index, amount, p.ReserveA)
+	}
+	if amount := p.ValueAmount(p.AssetB); amount < p.ReserveB {
+		return fmt.Errorf("pool %s#%d locks %d of asset B, datum reserve is %d", p.OutRef.TxHash, p.OutRef.Index, amount, p.ReserveB)
+	}
+	return nil
+}